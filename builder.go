@@ -0,0 +1,120 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package adaptive
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Builder constructs a tree from keys that are already sorted. Inserting them
+// one at a time grows every node through each size on the way to its final
+// one, copying its children each time. Tree instead lays out each node at the
+// size it needs, as all of the keys below it are known by then.
+type Builder[T any] struct {
+	keys   [][]byte
+	values []T
+}
+
+// NewBuilder returns an empty Builder.
+func NewBuilder[T any]() *Builder[T] {
+	return &Builder[T]{}
+}
+
+// Add adds a key and its value. Keys must be added in increasing order, with
+// no key added twice. If key does not sort after the last key added, Add
+// returns an error and the key is not added.
+func (b *Builder[T]) Add(key []byte, value T) error {
+	if n := len(b.keys); n > 0 {
+		if prev := getKey(b.keys[n-1]); bytes.Compare(prev, key) >= 0 {
+			return fmt.Errorf("adaptive: key %q added to builder after %q", key, prev)
+		}
+	}
+	b.keys = append(b.keys, getTreeKey(key))
+	b.values = append(b.values, value)
+	return nil
+}
+
+// Tree returns a tree holding every key added so far. More keys can be added
+// afterwards, and the trees returned by later calls include them as well.
+func (b *Builder[T]) Tree() *RadixTree[T] {
+	r := NewRadixTree[T]()
+	// A lone key is stored on the root itself, which is what Insert does
+	if len(b.keys) < 2 {
+		for i, k := range b.keys {
+			r, _, _ = r.Insert(getKey(k), b.values[i])
+		}
+		return r
+	}
+
+	txn := &Txn[T]{tree: r}
+	root := txn.build(b.keys, b.values, 0)
+	return &RadixTree[T]{
+		root,
+		uint64(len(b.keys)),
+		txn.tree.maxNodeId,
+		0,
+		r.opts,
+	}
+}
+
+// build returns a node holding keys, which are sorted and share their first
+// depth bytes, along with their values.
+func (t *Txn[T]) build(keys [][]byte, values []T, depth int) Node[T] {
+	if len(keys) == 1 {
+		return t.makeLeaf(keys[0], values[0])
+	}
+
+	// Being sorted, the first and last keys share the shortest prefix. It
+	// never takes in the terminator of either of them.
+	first, last := keys[0], keys[len(keys)-1]
+	prefix := depth
+	for prefix < len(first)-1 && prefix < len(last)-1 && first[prefix] == last[prefix] {
+		prefix++
+	}
+
+	// A key ending with the prefix sorts first and is the node's own leaf.
+	// Count the children of the rest so the node is allocated at its final
+	// size straight away.
+	start := 0
+	if len(first) == prefix+1 {
+		start = 1
+	}
+	children := 0
+	for i := start; i < len(keys); i++ {
+		if i == start || keys[i][prefix] != keys[i-1][prefix] {
+			children++
+		}
+	}
+	var n Node[T]
+	switch {
+	case children <= 4:
+		n = t.allocNode(node4)
+	case children <= 16:
+		n = t.allocNode(node16)
+	case children <= 48:
+		n = t.allocNode(node48)
+	default:
+		n = t.allocNode(node256)
+	}
+	n.setPartialLen(uint32(prefix - depth))
+	copy(n.getPartial(), first[depth:depth+min(maxPrefixLen, prefix-depth)])
+	if start == 1 {
+		l := t.allocNode(leafType)
+		t.setLeafKey(l, first)
+		l.setKeyLen(uint32(len(first)))
+		l.setValue(values[0])
+		n.setNodeLeaf(l.(*NodeLeaf[T]))
+	}
+
+	for i := start; i < len(keys); {
+		j := i + 1
+		for j < len(keys) && keys[j][prefix] == keys[i][prefix] {
+			j++
+		}
+		n = t.addChild(n, keys[i][prefix], t.build(keys[i:j], values[i:j], prefix+1))
+		i = j
+	}
+	return n
+}
@@ -0,0 +1,113 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package adaptive
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// entries returns every key and value in r in iteration order.
+func entries[T any](r *RadixTree[T]) []string {
+	var out []string
+	r.Walk(func(k []byte, v T) bool {
+		out = append(out, fmt.Sprintf("%q=%v", k, v))
+		return false
+	})
+	return out
+}
+
+func TestBuilder(t *testing.T) {
+	sets := map[string][]string{
+		"empty":  {},
+		"one":    {"foo"},
+		"nested": {"", "foo", "foo/", "foo/bar", "foo/bar/baz", "foo/zip", "foobar", "zip"},
+		"long":   {"0123456789abcdefghij", "0123456789abcdefghijk", "0123456789abcdefghijz"},
+		"dollar": {"", "$", "$$", "$a", "a", "a$", "a$a", "aa"},
+	}
+	var wide []string
+	for i := 0; i < 300; i++ {
+		wide = append(wide, fmt.Sprintf("k%c%d", byte(i), i))
+	}
+	sort.Strings(wide)
+	sets["wide"] = wide
+	var uuids []string
+	for _, k := range loadTestFile("test-text/uuid.txt") {
+		uuids = append(uuids, string(k))
+	}
+	sort.Strings(uuids)
+	sets["uuids"] = uuids
+
+	for name, keys := range sets {
+		b := NewBuilder[int]()
+		incremental := NewRadixTree[int]()
+		for i, k := range keys {
+			require.NoError(t, b.Add([]byte(k), i), name)
+			incremental, _, _ = incremental.Insert([]byte(k), i)
+		}
+		r := b.Tree()
+		require.Equal(t, len(keys), r.Len(), name)
+		require.Equal(t, entries(incremental), entries(r), name)
+		for i, k := range keys {
+			v, ok := r.Get([]byte(k))
+			require.True(t, ok, "%s: key %q", name, k)
+			require.Equal(t, i, v)
+		}
+		verifyTree(t, r)
+
+		// Nodes are never larger than they need to be
+		if len(keys) > 1 {
+			require.Equal(t, r.Stats(), r.Compact().Stats(), name)
+		}
+
+		// The tree can be changed like any other
+		for _, k := range keys {
+			r, _, _ = r.Delete([]byte(k))
+		}
+		require.Zero(t, r.Len(), name)
+		r, _, _ = r.Insert([]byte("new"), 1)
+		require.Equal(t, []string{"new"}, walkKeys(r))
+	}
+}
+
+func TestBuilder_Order(t *testing.T) {
+	b := NewBuilder[int]()
+	require.NoError(t, b.Add([]byte("b"), 1))
+	require.Error(t, b.Add([]byte("a"), 2))
+	require.Error(t, b.Add([]byte("b"), 3))
+	require.NoError(t, b.Add([]byte("ba"), 4))
+
+	r := b.Tree()
+	require.Equal(t, []string{"b", "ba"}, walkKeys(r))
+
+	// Keys added after Tree show up in later trees only
+	require.NoError(t, b.Add([]byte("c"), 5))
+	require.Equal(t, 2, r.Len())
+	require.Equal(t, []string{"b", "ba", "c"}, walkKeys(b.Tree()))
+}
+
+func BenchmarkBuilder(b *testing.B) {
+	for n := 0; n < b.N; n++ {
+		bl := NewBuilder[int]()
+		for i := 0; i < 1000000; i++ {
+			if err := bl.Add(EncodeUint64BigEndian(uint64(i)), i); err != nil {
+				b.Fatal(err)
+			}
+		}
+		bl.Tree()
+	}
+}
+
+func BenchmarkBuilder_Incremental(b *testing.B) {
+	for n := 0; n < b.N; n++ {
+		txn := NewRadixTree[int]().Txn(false)
+		for i := 0; i < 1000000; i++ {
+			txn.Insert(EncodeUint64BigEndian(uint64(i)), i)
+		}
+		txn.Commit()
+	}
+}
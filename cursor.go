@@ -0,0 +1,123 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package adaptive
+
+import (
+	"bytes"
+)
+
+// Cursor scans outward from a point in the tree in both directions. Next
+// yields the keys greater or equal to the point in ascending order, and Prev
+// the keys lower or equal to it in descending order, so a key equal to the
+// point comes out of both. The two directions advance independently.
+type Cursor[T any] struct {
+	next *LowerBoundIterator[T]
+	prev *ReverseIterator[T]
+}
+
+// SeekAt returns a cursor positioned at key. The path to key is walked only
+// once, with the subtrees on either side of it going to the direction they
+// belong to.
+func (t *RadixTree[T]) SeekAt(key []byte) *Cursor[T] {
+	c := &Cursor[T]{
+		next: &LowerBoundIterator[T]{node: t.root, stack: []Node[T]{}},
+		prev: &ReverseIterator[T]{
+			i:               &Iterator[T]{stack: []Node[T]{}},
+			expandedParents: make(map[Node[T]]struct{}),
+		},
+	}
+	// The empty root carries a leaf with no key, which is not a stored key
+	if t.size == 0 {
+		return c
+	}
+	c.prev.i.path = getTreeKey(key)
+	c.seek(t.root, key)
+	if len(key) == 0 {
+		// Every key is greater or equal to the empty key
+		c.next.stack = []Node[T]{t.root}
+	}
+	return c
+}
+
+// seek walks down the path of key, pushing the subtrees after the path onto
+// the forward stack and those before it onto the reverse stack. Keys are
+// compared without their terminators, as in SeekLowerBound.
+func (c *Cursor[T]) seek(n Node[T], key []byte) {
+	depth := 0
+	for n != nil {
+		// A node holding just a leaf sorts before the key, after it, or both
+		// when it is the key
+		if n.getArtNodeType() == leafType || n.isLeaf() {
+			l := n.getNodeLeaf()
+			if n.getArtNodeType() == leafType {
+				l = n.(*NodeLeaf[T])
+			}
+			cmp := bytes.Compare(getKey(l.getKey()), key)
+			if cmp >= 0 {
+				c.next.stack = append(c.next.stack, n)
+			}
+			if cmp <= 0 && len(l.getKey()) > 0 {
+				c.prev.i.stack = append(c.prev.i.stack, l)
+			}
+			return
+		}
+
+		// Only the first maxPrefixLen bytes of the prefix are stored on the
+		// node, so a longer prefix is read from a leaf below it instead
+		partialLen := int(n.getPartialLen())
+		nodePrefix := n.getPartial()[:min(maxPrefixLen, partialLen)]
+		if partialLen > maxPrefixLen {
+			if l := minimum[T](n); l != nil && len(l.key) >= depth+partialLen {
+				nodePrefix = l.key[depth : depth+partialLen]
+			}
+		}
+		switch bytes.Compare(nodePrefix, key[depth:min(depth+partialLen, len(key))]) {
+		case 1:
+			c.next.stack = append(c.next.stack, n)
+			return
+		case -1:
+			c.prev.i.stack = append(c.prev.i.stack, n)
+			return
+		}
+		depth += partialLen
+
+		// The node's own leaf is a prefix of every key below it. If it sorts
+		// at or after the key the whole node does; otherwise only the leaf
+		// comes before it, so the node is marked as expanded to keep its
+		// children out of the reverse direction.
+		if l := n.getNodeLeaf(); l != nil && len(l.getKey()) > 0 {
+			cmp := bytes.Compare(getKey(l.getKey()), key)
+			if cmp <= 0 {
+				c.prev.i.stack = append(c.prev.i.stack, n)
+				c.prev.expandedParents[n] = struct{}{}
+			}
+			if cmp >= 0 {
+				c.next.stack = append(c.next.stack, n)
+				return
+			}
+		}
+
+		// Every key below extends the key and sorts after it
+		if depth >= len(key) {
+			c.next.pushChildrenAfter(n, -1)
+			return
+		}
+		c.next.pushChildrenAfter(n, int(key[depth]))
+		c.prev.pushChildrenBefore(n, key[depth])
+		n, _ = findChild(n, key[depth])
+		depth++
+	}
+}
+
+// Next returns the next key at or after the cursor's position in ascending
+// order, along with its value.
+func (c *Cursor[T]) Next() ([]byte, T, bool) {
+	return c.next.Next()
+}
+
+// Prev returns the next key at or before the cursor's position in descending
+// order, along with its value.
+func (c *Cursor[T]) Prev() ([]byte, T, bool) {
+	return c.prev.Previous()
+}
@@ -0,0 +1,179 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package adaptive
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursor(t *testing.T) {
+	r := NewRadixTree[int]()
+	for i := 0; i < 100; i += 2 {
+		r, _, _ = r.Insert([]byte(fmt.Sprintf("key%03d", i)), i)
+	}
+
+	step := func(c *Cursor[int], n int, next bool) []string {
+		var out []string
+		for len(out) < n {
+			var k []byte
+			var ok bool
+			if next {
+				k, _, ok = c.Next()
+			} else {
+				k, _, ok = c.Prev()
+			}
+			if !ok {
+				break
+			}
+			out = append(out, string(k))
+		}
+		return out
+	}
+
+	// A stored key comes out in both directions
+	c := r.SeekAt([]byte("key050"))
+	require.Equal(t, []string{"key050", "key052", "key054"}, step(c, 3, true))
+	require.Equal(t, []string{"key050", "key048", "key046"}, step(c, 3, false))
+	require.Equal(t, []string{"key056"}, step(c, 1, true))
+	require.Equal(t, []string{"key044"}, step(c, 1, false))
+
+	// A missing key sits between its neighbours
+	c = r.SeekAt([]byte("key051"))
+	require.Equal(t, []string{"key052", "key054"}, step(c, 2, true))
+	require.Equal(t, []string{"key050", "key048"}, step(c, 2, false))
+
+	// Past either end one direction is empty
+	c = r.SeekAt([]byte("zzz"))
+	require.Empty(t, step(c, 1, true))
+	require.Len(t, step(c, 100, false), 50)
+	c = r.SeekAt(nil)
+	require.Len(t, step(c, 100, true), 50)
+	require.Empty(t, step(c, 1, false))
+
+	c = NewRadixTree[int]().SeekAt([]byte("key050"))
+	require.Empty(t, step(c, 1, true))
+	require.Empty(t, step(c, 1, false))
+}
+
+func TestCursor_MatchesSortedKeys(t *testing.T) {
+	// Keys that are prefixes of each other, and long shared prefixes that do
+	// not fit on a node, are where the seek path is least obvious
+	long := strings.Repeat("x", 20)
+	keys := []string{"", "a", "ab", "abc", "abd", "b", "foo", "foo/", "foo/bar",
+		"foo/bar/baz", "foobar", long, long + "a", long + "b", long + "bc"}
+	for _, k := range loadTestFile("test-text/words.txt")[:2000] {
+		keys = append(keys, string(k))
+	}
+	r := NewRadixTree[int]()
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+	sorted := walkKeys(r)
+	require.True(t, sort.StringsAreSorted(sorted))
+
+	rng := rand.New(rand.NewSource(1))
+	seeks := append([]string{}, keys[:15]...)
+	seeks = append(seeks, "fo", "foo/a", "foo/c", long[:15], long+"c", "zzzz")
+	for i := 0; i < 200; i++ {
+		k := keys[rng.Intn(len(keys))]
+		seeks = append(seeks, k[:rng.Intn(len(k)+1)], k+"a")
+	}
+
+	for _, seek := range seeks {
+		var wantNext, wantPrev []string
+		for _, k := range sorted {
+			if k >= seek {
+				wantNext = append(wantNext, k)
+			}
+		}
+		for i := len(sorted) - 1; i >= 0; i-- {
+			if sorted[i] <= seek {
+				wantPrev = append(wantPrev, sorted[i])
+			}
+		}
+
+		// Interleave the two directions to show they do not interfere
+		c := r.SeekAt([]byte(seek))
+		var gotNext, gotPrev []string
+		for {
+			kn, _, okn := c.Next()
+			if okn {
+				gotNext = append(gotNext, string(kn))
+			}
+			kp, _, okp := c.Prev()
+			if okp {
+				gotPrev = append(gotPrev, string(kp))
+			}
+			if !okn && !okp {
+				break
+			}
+		}
+		require.Equal(t, wantNext, gotNext, "next from %q", seek)
+		require.Equal(t, wantPrev, gotPrev, "prev from %q", seek)
+	}
+}
+
+func TestCursor_LowBytes(t *testing.T) {
+	// Bytes below the '$' terminator sort before the end of a shorter key
+	// would if terminators were compared, so check against a sorted slice
+	collect := func(c *Cursor[int]) (next, prev []string) {
+		for k, _, ok := c.Next(); ok; k, _, ok = c.Next() {
+			next = append(next, string(k))
+		}
+		for k, _, ok := c.Prev(); ok; k, _, ok = c.Prev() {
+			prev = append(prev, string(k))
+		}
+		return next, prev
+	}
+	check := func(keys []string, seek string) {
+		r := NewRadixTree[int]()
+		for i, k := range keys {
+			r, _, _ = r.Insert([]byte(k), i)
+		}
+		sorted := slices.Clone(keys)
+		sort.Strings(sorted)
+		sorted = slices.Compact(sorted)
+		var wantNext, wantPrev []string
+		for _, k := range sorted {
+			if k >= seek {
+				wantNext = append(wantNext, k)
+			}
+		}
+		for i := len(sorted) - 1; i >= 0; i-- {
+			if sorted[i] <= seek {
+				wantPrev = append(wantPrev, sorted[i])
+			}
+		}
+		gotNext, gotPrev := collect(r.SeekAt([]byte(seek)))
+		require.Equal(t, wantNext, gotNext, "keys %q next from %q", keys, seek)
+		require.Equal(t, wantPrev, gotPrev, "keys %q prev from %q", keys, seek)
+	}
+
+	check([]string{"a\x00x", "a\x00y"}, "a")
+	check([]string{"b"}, "b\x00")
+	check([]string{"", "!"}, "\x00a")
+
+	rng := rand.New(rand.NewSource(1))
+	randKey := func() string {
+		b := make([]byte, rng.Intn(5))
+		for i := range b {
+			b[i] = "\x00!$ab"[rng.Intn(5)]
+		}
+		return string(b)
+	}
+	for i := 0; i < 300; i++ {
+		keys := make([]string, 1+rng.Intn(20))
+		for j := range keys {
+			keys[j] = randKey()
+		}
+		check(keys, randKey())
+	}
+}
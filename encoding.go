@@ -0,0 +1,407 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package adaptive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+)
+
+// The binary format written by MarshalBinary stores the node structure of the
+// tree as it is, so that loading it back does not have to insert every key
+// again. All integers are unsigned varints.
+//
+//	magic        "ARTB"
+//	version      one byte, 1 for values encoded with gob and 2 for values
+//	             encoded by the caller through MarshalBinaryFunc
+//	maxPrefixLen the partial length the tree was built with
+//	size         number of keys
+//	maxNodeId    highest node id handed out so far
+//	generation   as returned by Generation
+//	nodesLen     length in bytes of the node section
+//	nodes        the root node record
+//	values       one value per leaf record, in the order the leaf records
+//	             appear in the node section. In version 1 this is a gob
+//	             stream, and in version 2 each value is the length of its
+//	             encoding followed by the encoding.
+//
+// A node record starts with its type byte and id. A leaf record follows them
+// with the length of its key and the key itself, including the terminator.
+// An inner node record follows them with its partial length, the stored
+// partial bytes (at most maxPrefixLen of them), a byte that is 1 if a leaf
+// record for the node's own leaf comes next, the number of children, and
+// then for each child in key order its key byte and its node record.
+//
+// Trees are only read back with the maxPrefixLen they were written with, as
+// the stored partials depend on it.
+const (
+	encodingMagic       = "ARTB"
+	encodingVersion     = 1
+	encodingVersionFunc = 2
+)
+
+// encodedValue wraps each value so that the zero value of an interface type
+// can be encoded as well.
+type encodedValue[T any] struct {
+	V T
+}
+
+// MarshalBinary encodes the tree, including its node structure, in the
+// format described above. Values are encoded with encoding/gob, so they must
+// be gob encodable, and concrete types stored behind an interface value type
+// need to be registered with gob.Register.
+func (t *RadixTree[T]) MarshalBinary() ([]byte, error) {
+	var nodes []byte
+	var leaves []*NodeLeaf[T]
+	nodes, leaves = appendNode(nodes, leaves, t.root)
+
+	var values bytes.Buffer
+	enc := gob.NewEncoder(&values)
+	for _, l := range leaves {
+		if err := enc.Encode(encodedValue[T]{l.getValue()}); err != nil {
+			return nil, fmt.Errorf("adaptive: encoding value for key %q: %w", getKey(l.getKey()), err)
+		}
+	}
+	return t.appendEncoding(encodingVersion, nodes, values.Bytes()), nil
+}
+
+// MarshalBinaryFunc encodes the tree like MarshalBinary, but with each value
+// encoded by encode instead of gob. gob writes maps in no particular order,
+// so for values such as maps an encode that writes them in a fixed order
+// makes encoding a tree give the same bytes every time, which suits hashing
+// its contents. The result is read back with UnmarshalBinaryFunc.
+func (t *RadixTree[T]) MarshalBinaryFunc(encode func(T) []byte) []byte {
+	var nodes []byte
+	var leaves []*NodeLeaf[T]
+	nodes, leaves = appendNode(nodes, leaves, t.root)
+
+	var values []byte
+	for _, l := range leaves {
+		v := encode(l.getValue())
+		values = binary.AppendUvarint(values, uint64(len(v)))
+		values = append(values, v...)
+	}
+	return t.appendEncoding(encodingVersionFunc, nodes, values)
+}
+
+// appendEncoding puts together the encoding of the tree from its node and
+// value sections.
+func (t *RadixTree[T]) appendEncoding(version byte, nodes, values []byte) []byte {
+	out := make([]byte, 0, len(encodingMagic)+1+5*binary.MaxVarintLen64+len(nodes)+len(values))
+	out = append(out, encodingMagic...)
+	out = append(out, version)
+	out = binary.AppendUvarint(out, maxPrefixLen)
+	out = binary.AppendUvarint(out, t.size)
+	out = binary.AppendUvarint(out, t.maxNodeId)
+	out = binary.AppendUvarint(out, t.generation)
+	out = binary.AppendUvarint(out, uint64(len(nodes)))
+	out = append(out, nodes...)
+	out = append(out, values...)
+	return out
+}
+
+// appendNode appends the record for n and everything below it, collecting the
+// leaves in the order they are written.
+func appendNode[T any](b []byte, leaves []*NodeLeaf[T], n Node[T]) ([]byte, []*NodeLeaf[T]) {
+	b = append(b, byte(n.getArtNodeType()))
+	b = binary.AppendUvarint(b, n.getId())
+	if n.getArtNodeType() == leafType {
+		l := n.(*NodeLeaf[T])
+		b = binary.AppendUvarint(b, uint64(len(l.getKey())))
+		b = append(b, l.getKey()...)
+		return b, append(leaves, l)
+	}
+
+	b = binary.AppendUvarint(b, uint64(n.getPartialLen()))
+	b = append(b, n.getPartial()[:min(maxPrefixLen, int(n.getPartialLen()))]...)
+	if l := n.getNodeLeaf(); l != nil {
+		b = append(b, 1)
+		b, leaves = appendNode[T](b, leaves, l)
+	} else {
+		b = append(b, 0)
+	}
+
+	// Node256 cannot count all 256 children in its uint8, so count them here
+	type child struct {
+		key  byte
+		node Node[T]
+	}
+	var children []child
+	switch n.getArtNodeType() {
+	case node4, node16:
+		for i := 0; i < int(n.getNumChildren()); i++ {
+			if ch := n.getChild(i); ch != nil {
+				children = append(children, child{n.getKeyAtIdx(i), ch})
+			}
+		}
+	case node48:
+		for c := 0; c < 256; c++ {
+			if idx := n.getKeyAtIdx(c); idx != 0 {
+				if ch := n.getChild(int(idx - 1)); ch != nil {
+					children = append(children, child{byte(c), ch})
+				}
+			}
+		}
+	case node256:
+		for c := 0; c < 256; c++ {
+			if ch := n.getChild(c); ch != nil {
+				children = append(children, child{byte(c), ch})
+			}
+		}
+	}
+	b = binary.AppendUvarint(b, uint64(len(children)))
+	for _, ch := range children {
+		b = append(b, ch.key)
+		b, leaves = appendNode(b, leaves, ch.node)
+	}
+	return b, leaves
+}
+
+// UnmarshalBinary replaces the contents of the tree with a tree decoded from
+// data written by MarshalBinary.
+func (t *RadixTree[T]) UnmarshalBinary(data []byte) error {
+	return t.unmarshal(data, encodingVersion, func(leaves []*NodeLeaf[T], values []byte) error {
+		dec := gob.NewDecoder(bytes.NewReader(values))
+		for _, l := range leaves {
+			var v encodedValue[T]
+			if err := dec.Decode(&v); err != nil {
+				return fmt.Errorf("adaptive: decoding value for key %q: %w", getKey(l.getKey()), err)
+			}
+			l.setValue(v.V)
+		}
+		return nil
+	})
+}
+
+// UnmarshalBinaryFunc replaces the contents of the tree with a tree decoded
+// from data written by MarshalBinaryFunc, with each value decoded by decode.
+func (t *RadixTree[T]) UnmarshalBinaryFunc(data []byte, decode func([]byte) (T, error)) error {
+	return t.unmarshal(data, encodingVersionFunc, func(leaves []*NodeLeaf[T], values []byte) error {
+		d := &nodeDecoder[T]{buf: values}
+		for _, l := range leaves {
+			b := d.bytes(d.uvarint())
+			if d.err != nil {
+				return d.err
+			}
+			v, err := decode(b)
+			if err != nil {
+				return fmt.Errorf("adaptive: decoding value for key %q: %w", getKey(l.getKey()), err)
+			}
+			l.setValue(v)
+		}
+		return nil
+	})
+}
+
+// unmarshal decodes data written with the given format version, leaving the
+// value section to setValues, which is given the leaves in the order their
+// values were written. The tree is only changed if every value is set.
+func (t *RadixTree[T]) unmarshal(data []byte, version byte, setValues func([]*NodeLeaf[T], []byte) error) error {
+	d := &nodeDecoder[T]{buf: data}
+	if !bytes.HasPrefix(data, []byte(encodingMagic)) {
+		return errors.New("adaptive: not an encoded radix tree")
+	}
+	d.pos = len(encodingMagic)
+	if v := d.byte(); d.err == nil && v != version {
+		switch v {
+		case encodingVersion:
+			return errors.New("adaptive: encoding version 1 holds gob values, use UnmarshalBinary")
+		case encodingVersionFunc:
+			return errors.New("adaptive: encoding version 2 holds caller encoded values, use UnmarshalBinaryFunc")
+		}
+		return fmt.Errorf("adaptive: unsupported encoding version %d", v)
+	}
+	if p := d.uvarint(); d.err == nil && p != maxPrefixLen {
+		return fmt.Errorf("adaptive: tree was encoded with a partial length of %d, not %d", p, maxPrefixLen)
+	}
+	size := d.uvarint()
+	maxNodeId := d.uvarint()
+	generation := d.uvarint()
+	nodesLen := d.uvarint()
+	if d.err != nil {
+		return d.err
+	}
+	if nodesLen > uint64(len(data)-d.pos) {
+		return errTruncated
+	}
+	end := d.pos + int(nodesLen)
+	d.buf = data[:end]
+	root := d.node(0)
+	if d.err != nil {
+		return d.err
+	}
+	if d.pos != end {
+		return errors.New("adaptive: malformed node section")
+	}
+	if root.getArtNodeType() == leafType {
+		return errors.New("adaptive: root must be an inner node")
+	}
+	if d.keys != size {
+		return fmt.Errorf("adaptive: found %d keys but the tree records %d", d.keys, size)
+	}
+
+	if err := setValues(d.leaves, data[end:]); err != nil {
+		return err
+	}
+
+	t.root = root
+	t.size = size
+	t.maxNodeId = maxNodeId
+	t.generation = generation
+	return nil
+}
+
+var errTruncated = errors.New("adaptive: encoded tree is truncated")
+
+// nodeDecoder reads node records, remembering the first error so that callers
+// only need to check it once they are done.
+type nodeDecoder[T any] struct {
+	buf    []byte
+	pos    int
+	err    error
+	leaves []*NodeLeaf[T]
+	keys   uint64
+}
+
+func (d *nodeDecoder[T]) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if d.pos >= len(d.buf) {
+		d.err = errTruncated
+		return 0
+	}
+	c := d.buf[d.pos]
+	d.pos++
+	return c
+}
+
+func (d *nodeDecoder[T]) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf[d.pos:])
+	if n <= 0 {
+		d.err = errTruncated
+		return 0
+	}
+	d.pos += n
+	return v
+}
+
+func (d *nodeDecoder[T]) bytes(n uint64) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > uint64(len(d.buf)-d.pos) {
+		d.err = errTruncated
+		return nil
+	}
+	b := make([]byte, n)
+	copy(b, d.buf[d.pos:])
+	d.pos += int(n)
+	return b
+}
+
+// node decodes the node record at the current position. depth is the number
+// of key bytes consumed above the node, which bounds how deep records can nest.
+func (d *nodeDecoder[T]) node(depth int) Node[T] {
+	typ := nodeType(d.byte())
+	id := d.uvarint()
+	if d.err != nil {
+		return nil
+	}
+
+	var n Node[T]
+	maxChildren := 0
+	switch typ {
+	case leafType:
+		l := &NodeLeaf[T]{id: id}
+		l.key = d.bytes(d.uvarint())
+		d.leaves = append(d.leaves, l)
+		if len(l.key) > 0 {
+			d.keys++
+		}
+		return l
+	case node4:
+		n, maxChildren = &Node4[T]{}, 4
+	case node16:
+		n, maxChildren = &Node16[T]{}, 16
+	case node48:
+		n, maxChildren = &Node48[T]{}, 48
+	case node256:
+		n, maxChildren = &Node256[T]{}, 256
+	default:
+		d.err = fmt.Errorf("adaptive: unknown node type %d", typ)
+		return nil
+	}
+	n.setId(id)
+
+	partialLen := d.uvarint()
+	if partialLen > uint64(len(d.buf)) {
+		d.err = errors.New("adaptive: malformed node section")
+		return nil
+	}
+	partial := make([]byte, maxPrefixLen)
+	copy(partial, d.bytes(uint64(min(maxPrefixLen, int(partialLen)))))
+	n.setPartial(partial)
+	n.setPartialLen(uint32(partialLen))
+
+	switch d.byte() {
+	case 0:
+	case 1:
+		if l, ok := d.node(depth).(*NodeLeaf[T]); ok {
+			n.setNodeLeaf(l)
+		} else if d.err == nil {
+			d.err = errors.New("adaptive: node leaf is not a leaf")
+		}
+	default:
+		d.err = errors.New("adaptive: malformed node section")
+	}
+
+	numChildren := d.uvarint()
+	if d.err != nil {
+		return nil
+	}
+	if numChildren > uint64(maxChildren) {
+		d.err = fmt.Errorf("adaptive: node of type %d has %d children", typ, numChildren)
+		return nil
+	}
+	// Every level consumes at least one key byte, and no key is longer than
+	// the encoded tree, so this stops malformed input recursing without end.
+	depth += int(partialLen) + 1
+	if numChildren > 0 && depth > len(d.buf) {
+		d.err = errors.New("adaptive: malformed node section")
+		return nil
+	}
+
+	prev := -1
+	for i := 0; i < int(numChildren); i++ {
+		c := d.byte()
+		child := d.node(depth)
+		if d.err != nil {
+			return nil
+		}
+		if int(c) <= prev {
+			d.err = errors.New("adaptive: children are not in key order")
+			return nil
+		}
+		prev = int(c)
+		switch typ {
+		case node4, node16:
+			n.setKeyAtIdx(i, c)
+			n.setChild(i, child)
+		case node48:
+			n.setKeyAtIdx(int(c), byte(i+1))
+			n.setChild(i, child)
+		case node256:
+			n.setChild(int(c), child)
+		}
+	}
+	n.setNumChildren(uint8(numChildren))
+	return n
+}
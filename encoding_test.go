@@ -0,0 +1,235 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package adaptive
+
+import (
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// requireSameStructure checks that two trees hold the same nodes, with the
+// same ids and paths, in the same order.
+func requireSameStructure[T any](t *testing.T, expected, actual *RadixTree[T]) {
+	t.Helper()
+	require.Equal(t, expected.Len(), actual.Len())
+	require.Equal(t, expected.maxNodeId, actual.maxNodeId)
+	require.Equal(t, expected.Generation(), actual.Generation())
+
+	ei, ai := expected.RawIterator(), actual.RawIterator()
+	for ei.Next(); ei.Front() != nil; ei.Next() {
+		ai.Next()
+		require.NotNil(t, ai.Front(), "missing node at %q", ei.Path())
+		require.Equal(t, ei.Path(), ai.Path())
+		require.Equal(t, ei.Front().getArtNodeType(), ai.Front().getArtNodeType(), "path %q", ei.Path())
+		require.Equal(t, ei.Front().getId(), ai.Front().getId(), "path %q", ei.Path())
+		require.Equal(t, ei.Front().getPartialLen(), ai.Front().getPartialLen(), "path %q", ei.Path())
+		require.Equal(t, ei.Front().getValue(), ai.Front().getValue(), "path %q", ei.Path())
+	}
+	ai.Next()
+	require.Nil(t, ai.Front())
+}
+
+func TestMarshalBinary_Words(t *testing.T) {
+	words := loadTestFile("test-text/words.txt")
+	r := NewRadixTree[int]()
+	for i, w := range words {
+		r, _, _ = r.Insert(w, i)
+	}
+	// Deletes leave node48 and node256 children out of order in their slots
+	for _, w := range words[:len(words)/3] {
+		r, _, _ = r.Delete(w)
+	}
+
+	data, err := r.MarshalBinary()
+	require.NoError(t, err)
+
+	loaded := NewRadixTree[int]()
+	require.NoError(t, loaded.UnmarshalBinary(data))
+	requireSameStructure(t, r, loaded)
+
+	for i, w := range words {
+		v, ok := loaded.Get(w)
+		require.Equal(t, i >= len(words)/3, ok, "key %q", w)
+		if ok {
+			require.Equal(t, i, v)
+		}
+	}
+
+	// The loaded tree keeps working as a normal tree
+	loaded, _, _ = loaded.Insert([]byte("zzz-new"), -1)
+	loaded, _, _ = loaded.Delete(words[len(words)-1])
+	v, ok := loaded.Get([]byte("zzz-new"))
+	require.True(t, ok)
+	require.Equal(t, -1, v)
+	require.Equal(t, r.Len(), loaded.Len())
+	require.True(t, r.Contains(words[len(words)-1]))
+}
+
+func TestMarshalBinary_Values(t *testing.T) {
+	// The empty tree still round trips
+	data, err := NewRadixTree[string]().MarshalBinary()
+	require.NoError(t, err)
+	empty := NewRadixTree[string]()
+	require.NoError(t, empty.UnmarshalBinary(data))
+	require.Equal(t, 0, empty.Len())
+	empty, _, _ = empty.Insert([]byte("foo"), "bar")
+	require.True(t, empty.Contains([]byte("foo")))
+
+	// Interface values, including nil, round trip once registered
+	gob.Register(map[string]int{})
+	r := NewRadixTree[any]()
+	r, _, _ = r.Insert([]byte(""), nil)
+	r, _, _ = r.Insert([]byte("a"), "string")
+	r, _, _ = r.Insert([]byte("ab"), map[string]int{"x": 1})
+	r, _, _ = r.Insert([]byte("abcdefghijklmnopqrstuvwxyz"), 3)
+	data, err = r.MarshalBinary()
+	require.NoError(t, err)
+	loaded := NewRadixTree[any]()
+	require.NoError(t, loaded.UnmarshalBinary(data))
+	requireSameStructure(t, r, loaded)
+
+	_, err = NewRadixTree[chan int]().MarshalBinary()
+	require.Error(t, err)
+}
+
+func TestUnmarshalBinary_Invalid(t *testing.T) {
+	r := NewRadixTree[int]()
+	for i, k := range []string{"foo", "foobar", "zip"} {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+	data, err := r.MarshalBinary()
+	require.NoError(t, err)
+
+	// Every truncation fails cleanly rather than panicking
+	for i := 0; i < len(data); i++ {
+		require.Error(t, NewRadixTree[int]().UnmarshalBinary(data[:i]), "length %d", i)
+	}
+
+	// As does corruption of any single byte in the header and node section
+	for i := 0; i < len(data); i++ {
+		bad := append([]byte(nil), data...)
+		bad[i] ^= 0xff
+		require.NotPanics(t, func() {
+			_ = NewRadixTree[int]().UnmarshalBinary(bad)
+		}, "byte %d", i)
+	}
+
+	bad := append([]byte(nil), data...)
+	bad[len(encodingMagic)] = encodingVersion + 1
+	require.ErrorContains(t, NewRadixTree[int]().UnmarshalBinary(bad), "version")
+
+	bad = append([]byte(nil), data...)
+	bad[len(encodingMagic)+1] = maxPrefixLen + 1
+	require.ErrorContains(t, NewRadixTree[int]().UnmarshalBinary(bad), "partial length")
+
+	require.Error(t, NewRadixTree[int]().UnmarshalBinary([]byte("nope")))
+
+	// A failed load leaves the tree as it was
+	kept := r
+	require.Error(t, kept.UnmarshalBinary(data[:len(data)-1]))
+	require.Equal(t, 3, kept.Len())
+}
+
+func BenchmarkUnmarshalBinary_Words(b *testing.B) {
+	words := loadTestFile("test-text/words.txt")
+	r := NewRadixTree[int]()
+	for i, w := range words {
+		r, _, _ = r.Insert(w, i)
+	}
+	data, err := r.MarshalBinary()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if err := NewRadixTree[int]().UnmarshalBinary(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRebuild_Words(b *testing.B) {
+	words := loadTestFile("test-text/words.txt")
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		txn := NewRadixTree[int]().Txn(false)
+		for i, w := range words {
+			txn.Insert(w, i)
+		}
+		txn.Commit()
+	}
+}
+
+func TestMarshalBinaryFunc(t *testing.T) {
+	// Writes the entries of a map in key order
+	encode := func(m map[string]int) []byte {
+		var b []byte
+		for _, k := range slices.Sorted(maps.Keys(m)) {
+			b = binary.AppendUvarint(b, uint64(len(k)))
+			b = append(b, k...)
+			b = binary.AppendVarint(b, int64(m[k]))
+		}
+		return b
+	}
+	decode := func(b []byte) (map[string]int, error) {
+		m := make(map[string]int)
+		for len(b) > 0 {
+			n, w := binary.Uvarint(b)
+			if w <= 0 || uint64(len(b)-w) < n {
+				return nil, errors.New("bad entry")
+			}
+			k := string(b[w : w+int(n)])
+			b = b[w+int(n):]
+			v, w := binary.Varint(b)
+			if w <= 0 {
+				return nil, errors.New("bad entry")
+			}
+			m[k] = int(v)
+			b = b[w:]
+		}
+		return m, nil
+	}
+
+	r := NewRadixTree[map[string]int]()
+	for i, k := range loadTestFile("test-text/words.txt")[:500] {
+		m := make(map[string]int)
+		for j := 0; j < 20; j++ {
+			m[fmt.Sprintf("field%d", j)] = i * j
+		}
+		r, _, _ = r.Insert(k, m)
+	}
+	r, _, _ = r.Insert(nil, map[string]int{})
+
+	// The same tree always encodes to the same bytes
+	data := r.MarshalBinaryFunc(encode)
+	for i := 0; i < 5; i++ {
+		require.Equal(t, data, r.MarshalBinaryFunc(encode))
+	}
+
+	loaded := NewRadixTree[map[string]int]()
+	require.NoError(t, loaded.UnmarshalBinaryFunc(data, decode))
+	requireSameStructure(t, r, loaded)
+	require.Equal(t, data, loaded.MarshalBinaryFunc(encode))
+
+	// Each format is only read back by its own decoder
+	require.ErrorContains(t, NewRadixTree[map[string]int]().UnmarshalBinary(data), "UnmarshalBinaryFunc")
+	gobData, err := r.MarshalBinary()
+	require.NoError(t, err)
+	require.ErrorContains(t, NewRadixTree[map[string]int]().UnmarshalBinaryFunc(gobData, decode), "UnmarshalBinary")
+
+	// Errors from decode and truncated values leave the tree as it was
+	failing := func([]byte) (map[string]int, error) { return nil, errors.New("boom") }
+	require.ErrorContains(t, loaded.UnmarshalBinaryFunc(data, failing), "boom")
+	require.Error(t, loaded.UnmarshalBinaryFunc(data[:len(data)-1], decode))
+	require.Equal(t, r.Len(), loaded.Len())
+}
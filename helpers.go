@@ -5,6 +5,7 @@ package adaptive
 
 import (
 	"bytes"
+	"encoding/binary"
 	"sort"
 )
 
@@ -28,6 +29,47 @@ func leafMatches(nodeKey []byte, key []byte) int {
 	return bytes.Compare(nodeKey, key)
 }
 
+// keyFingerprint hashes a stored key for Options.KeyFingerprints. Hashing the
+// whole key would cost as much as the comparison it is meant to save, so it
+// only mixes the length with the 8 bytes at the start, middle and end of the
+// key, where long keys that share most of their bytes tend to differ. Keys
+// differing elsewhere collide and are compared in full. It never returns 0,
+// which marks a leaf without a fingerprint, and it is a variable so tests can
+// force collisions.
+var keyFingerprint = func(key []byte) uint64 {
+	h := uint64(len(key))
+	if len(key) < 8 {
+		for _, c := range key {
+			h = (h ^ uint64(c)) * fingerprintPrime
+		}
+		return h | 1
+	}
+	for _, i := range [3]int{0, (len(key) - 8) / 2, len(key) - 8} {
+		h = (h ^ binary.LittleEndian.Uint64(key[i:])) * fingerprintPrime
+		h ^= h >> 32
+	}
+	return h | 1
+}
+
+// fingerprintPrime is the 64-bit FNV prime, used to mix keyFingerprint
+const fingerprintPrime = 1099511628211
+
+// leafHasKey reports whether l stores key. When l has a fingerprint and it
+// differs from that of key, the keys are not compared. fp holds the
+// fingerprint of key once it has been worked out, or 0 before then, so that
+// it is computed at most once per lookup.
+func leafHasKey[T any](l *NodeLeaf[T], key []byte, fp *uint64) bool {
+	if l.fingerprint != 0 {
+		if *fp == 0 {
+			*fp = keyFingerprint(key)
+		}
+		if *fp != l.fingerprint {
+			return false
+		}
+	}
+	return leafMatches(l.key, key) == 0
+}
+
 // longestCommonPrefix finds the length of the longest common prefix between two leaf nodes.
 func longestCommonPrefix[T any](l1, l2 Node[T], depth int) int {
 	maxCmp := len(l2.getKey()) - depth
@@ -155,6 +197,36 @@ func (t *Txn[T]) addChild256(n Node[T], c byte, child Node[T]) Node[T] {
 	return n
 }
 
+// numChildren returns the number of children of n. A full node256 has 256
+// children, which wraps around to 0 in the uint8 count kept on the node.
+func numChildren[T any](n Node[T]) int {
+	if n.getArtNodeType() == node256 && n.getNumChildren() == 0 && n.getChild(0) != nil {
+		return 256
+	}
+	return int(n.getNumChildren())
+}
+
+// nodePrefix returns the bytes of n's partial that are in use, capped so that
+// appending to them cannot write into the node.
+func nodePrefix[T any](n Node[T]) []byte {
+	p := n.getPartial()
+	k := min(min(maxPrefixLen, int(n.getPartialLen())), len(p))
+	return p[:k:k]
+}
+
+// fanout counts the children of n and its own leaf, if it holds a key. The
+// empty root carries a leaf without one.
+func fanout[T any](n Node[T]) int {
+	if n.getArtNodeType() == leafType {
+		return 0
+	}
+	f := numChildren(n)
+	if l := n.getNodeLeaf(); l != nil && len(l.getKey()) > 0 {
+		f++
+	}
+	return f
+}
+
 // copyHeader copies header information from src to dest node.
 func (t *Txn[T]) copyHeader(dest, src Node[T]) {
 	dest.setNumChildren(src.getNumChildren())
@@ -324,9 +396,13 @@ func findChild[T any](n Node[T], c byte) (Node[T], int) {
 			return n.getChild(idx - 1), idx - 1
 		}
 	case node48:
-		i := n.getKeyAtIdx(int(c))
-		if i != 0 {
-			return n.getChild(int(i - 1)), int(i - 1)
+		// A stale index can point past the children or at an empty slot, so
+		// only report a child that is really there.
+		i := int(n.getKeyAtIdx(int(c)))
+		if i != 0 && i <= len(n.getChildren()) {
+			if ch := n.getChild(i - 1); ch != nil {
+				return ch, i - 1
+			}
 		}
 	case node256:
 		ch := n.getChild(int(c))
@@ -342,18 +418,30 @@ func findChild[T any](n Node[T], c byte) (Node[T], int) {
 	return nil, 0
 }
 
+// getTreeKey returns a copy of key with the terminator appended. It must not
+// append in place, as that would write into any spare capacity of the
+// caller's slice.
 func getTreeKey(key []byte) []byte {
-	return append(key, '$')
+	return append(key[:len(key):len(key)], '$')
 }
 
+// getKey returns the logical key of a stored key by dropping its terminator.
+// The result is capped at its length, so a caller appending to it gets a copy
+// rather than overwriting the terminator in the tree.
 func getKey(key []byte) []byte {
 	keyLen := len(key)
 	if keyLen == 0 {
 		return key
 	}
-	return key[:keyLen-1]
+	return key[: keyLen-1 : keyLen-1]
 }
 
+// removeChild removes the child for c from n. Nodes grow as soon as they run
+// out of room, but only shrink once they are well below the capacity of the
+// next smaller type: a node16 shrinks to a node4 at 3 children, a node48 to a
+// node16 at 12 and a node256 to a node48 at 37. A node whose child count moves
+// back and forth across either boundary therefore keeps its type rather than
+// being rebuilt on every insert and delete.
 func (t *Txn[T]) removeChild(n Node[T], c byte) Node[T] {
 	switch n.getArtNodeType() {
 	case node4:
@@ -385,39 +473,118 @@ func (t *Txn[T]) removeChild4(n Node[T], c byte) Node[T] {
 		n.setChild(slow, children[itr])
 		slow += 1
 	}
-	for ; itr < len(n.getChildren()); itr++ {
-		if n.getChild(itr) != nil {
-			t.trackChannel(n.getChild(itr))
-		}
+	// Clear every slot past the shifted children, including the old last one
+	for itr = slow; itr < len(n.getChildren()); itr++ {
 		n.setChild(itr, nil)
 	}
 
 	n.setNumChildren(n.getNumChildren() - 1)
 
 	if n.getNumChildren() == 1 && n.getNodeLeaf() == nil {
-		nodeToReturn := t.writeNode(n.getChild(0), false)
-		// Is not leaf
-		if n.getArtNodeType() != leafType {
-			// Concatenate the prefixes
-			prefix := int(n.getPartialLen())
-			if prefix < maxPrefixLen {
-				n.getPartial()[prefix] = n.getKeyAtIdx(0)
-				prefix++
+		return t.collapse(n)
+	}
+	return n
+}
+
+// collapse merges a node4 left with a single child and no leaf of its own into
+// that child, moving its prefix and the child's key byte onto the child's
+// prefix so no empty scaffolding stays behind. The node must be writable.
+func (t *Txn[T]) collapse(n Node[T]) Node[T] {
+	nodeToReturn := t.writeNode(n.getChild(0), false)
+	// A leaf, or a node holding only a leaf, is found by its key alone and
+	// has no prefix to take
+	if nodeToReturn.getArtNodeType() != leafType && !nodeToReturn.isLeaf() {
+		// Concatenate the prefixes
+		prefix := int(n.getPartialLen())
+		if prefix < maxPrefixLen {
+			n.getPartial()[prefix] = n.getKeyAtIdx(0)
+			prefix++
+		}
+		if prefix < maxPrefixLen {
+			subPrefix := min(int(nodeToReturn.getPartialLen()), maxPrefixLen-prefix)
+			copy(n.getPartial()[prefix:], nodeToReturn.getPartial()[:subPrefix])
+			prefix += subPrefix
+		}
+
+		// Store the prefix in the child
+		copy(nodeToReturn.getPartial(), n.getPartial()[:min(prefix, maxPrefixLen)])
+		nodeToReturn.setPartialLen(nodeToReturn.getPartialLen() + n.getPartialLen() + 1)
+	}
+	t.trackChannel(n)
+	t.release(n)
+	return nodeToReturn
+}
+
+// compact rebuilds n and every node below it that has room for more children
+// than it holds as the smallest node type that fits them. Subtrees that need
+// no change are returned as they are, so they stay shared.
+func (t *Txn[T]) compact(n Node[T]) Node[T] {
+	if n.getArtNodeType() == leafType {
+		return n
+	}
+
+	var keys []byte
+	var children []Node[T]
+	changed := false
+	add := func(c byte, ch Node[T]) {
+		nc := t.compact(ch)
+		changed = changed || nc != ch
+		keys = append(keys, c)
+		children = append(children, nc)
+	}
+	switch n.getArtNodeType() {
+	case node4, node16:
+		for i := 0; i < int(n.getNumChildren()); i++ {
+			if ch := n.getChild(i); ch != nil {
+				add(n.getKeyAtIdx(i), ch)
 			}
-			if prefix < maxPrefixLen {
-				subPrefix := min(int(nodeToReturn.getPartialLen()), maxPrefixLen-prefix)
-				copy(n.getPartial()[prefix:], nodeToReturn.getPartial()[:subPrefix])
-				prefix += subPrefix
+		}
+	case node48:
+		for c := 0; c < 256; c++ {
+			if idx := n.getKeyAtIdx(c); idx != 0 {
+				if ch := n.getChild(int(idx - 1)); ch != nil {
+					add(byte(c), ch)
+				}
 			}
+		}
+	case node256:
+		for c := 0; c < 256; c++ {
+			if ch := n.getChild(c); ch != nil {
+				add(byte(c), ch)
+			}
+		}
+	}
+
+	ntype := node256
+	switch {
+	case len(children) <= 4:
+		ntype = node4
+	case len(children) <= 16:
+		ntype = node16
+	case len(children) <= 48:
+		ntype = node48
+	}
+	if ntype == n.getArtNodeType() && !changed {
+		return n
+	}
 
-			// Store the prefix in the child
-			copy(nodeToReturn.getPartial(), n.getPartial()[:min(prefix, maxPrefixLen)])
-			nodeToReturn.setPartialLen(nodeToReturn.getPartialLen() + n.getPartialLen() + 1)
+	newNode := t.allocNode(ntype)
+	t.copyHeader(newNode, n)
+	newNode.setNodeLeaf(n.getNodeLeaf())
+	for i, ch := range children {
+		switch ntype {
+		case node4, node16:
+			newNode.setKeyAtIdx(i, keys[i])
+			newNode.setChild(i, ch)
+		case node48:
+			newNode.setKeyAtIdx(int(keys[i]), byte(i+1))
+			newNode.setChild(i, ch)
+		case node256:
+			newNode.setChild(int(keys[i]), ch)
 		}
-		t.trackChannel(n)
-		return nodeToReturn
 	}
-	return n
+	newNode.setNumChildren(uint8(len(children)))
+	return newNode
 }
 
 func (t *Txn[T]) removeChild16(n Node[T], c byte) Node[T] {
@@ -436,10 +603,8 @@ func (t *Txn[T]) removeChild16(n Node[T], c byte) Node[T] {
 		n.setChild(slow, children[itr])
 		slow += 1
 	}
-	for ; itr < len(n.getChildren()); itr++ {
-		if n.getChild(itr) != nil {
-			t.trackChannel(n.getChild(itr))
-		}
+	// Clear every slot past the shifted children, including the old last one
+	for itr = slow; itr < len(n.getChildren()); itr++ {
 		n.setChild(itr, nil)
 	}
 	n.setNumChildren(n.getNumChildren() - 1)
@@ -517,7 +682,12 @@ func (t *Txn[T]) removeChild256(n Node[T], c uint8) Node[T] {
 	return n
 }
 
+// hasPrefix reports whether the stored key is a key with prefix. The empty root
+// of an empty tree carries a leaf with no key at all, which never matches.
 func hasPrefix(key []byte, prefix []byte) bool {
+	if len(key) == 0 {
+		return false
+	}
 	if len(prefix) == 0 {
 		return true
 	}
@@ -3,16 +3,27 @@
 
 package adaptive
 
+import "bytes"
+
 // Iterator is used to iterate over a set of nodes from the node
 // down to a specified path. This will iterate over the same values that
 // the Node.WalkPath method will.
 type Iterator[T any] struct {
-	path         []byte
-	node         Node[T]
-	stack        []Node[T]
-	depth        int
-	pos          Node[T]
-	seenMismatch bool
+	path  []byte
+	node  Node[T]
+	stack []Node[T]
+	depth int
+	pos   Node[T]
+
+	// rawKey is the stored key of the entry last returned by Next
+	rawKey []byte
+
+	// peeked is set when Peek has read ahead, holding the entry for Next
+	peeked  bool
+	peekKey []byte
+	peekRaw []byte
+	peekVal T
+	peekOk  bool
 }
 
 // Front returns the current node that has been iterated to.
@@ -24,8 +35,76 @@ func (i *Iterator[T]) Path() string {
 	return string(i.path)
 }
 
+// Next returns the next key and value, and false once the iteration is done.
 func (i *Iterator[T]) Next() ([]byte, T, bool) {
+	if i.peeked {
+		i.peeked = false
+		i.rawKey = i.peekRaw
+		return i.peekKey, i.peekVal, i.peekOk
+	}
+	return i.next()
+}
+
+// Skip advances past the next n entries, as if Next were called n times, and
+// returns how many there were, which is fewer than n once the iteration is
+// done. It is meant for offset-based pagination. Nodes do not count the keys
+// below them, so whole subtrees cannot be passed over at once and skipping
+// takes time proportional to n.
+func (i *Iterator[T]) Skip(n int) int {
+	skipped := 0
+	for skipped < n {
+		if _, _, ok := i.Next(); !ok {
+			break
+		}
+		skipped++
+	}
+	return skipped
+}
+
+// RawKey returns the key of the entry last returned by Next as it is stored in
+// the tree, which is the key followed by the '$' terminator. It is meant for
+// matching entries up with nodes when debugging; the returned slice must not
+// be modified.
+func (i *Iterator[T]) RawKey() []byte {
+	return i.rawKey[:len(i.rawKey):len(i.rawKey)]
+}
+
+// CurrentPath returns the path from the root down to the entry last returned
+// by Next, or nil before the first entry and once the iteration is done.
+// Leaves hold whole keys, so the path is that entry's key. Unlike Path, which
+// stays on the prefix the iterator was seeked to, it moves along with the
+// iteration, so a scan can be resumed from it with SeekLowerBound, which
+// returns that entry first.
+func (i *Iterator[T]) CurrentPath() []byte {
+	if len(i.rawKey) == 0 {
+		return nil
+	}
+	return getKey(i.rawKey)
+}
+
+// Peek returns the entry the next call to Next will return, without
+// advancing past it. This lets a caller compare the heads of several
+// iterators before choosing which one to move on.
+func (i *Iterator[T]) Peek() ([]byte, T, bool) {
+	if !i.peeked {
+		rawKey := i.rawKey
+		i.peekKey, i.peekVal, i.peekOk = i.next()
+		i.peekRaw, i.rawKey = i.rawKey, rawKey
+		i.peeked = true
+	}
+	return i.peekKey, i.peekVal, i.peekOk
+}
+
+// peekStoredKey returns the key of the entry Peek returns as it is ordered in
+// the tree, without its terminator
+func (i *Iterator[T]) peekStoredKey() []byte {
+	i.Peek()
+	return getKey(i.peekRaw)
+}
+
+func (i *Iterator[T]) next() ([]byte, T, bool) {
 	var zero T
+	i.rawKey = nil
 
 	// Iterate through the stack until it's empty
 	for len(i.stack) > 0 {
@@ -44,7 +123,7 @@ func (i *Iterator[T]) Next() ([]byte, T, bool) {
 				i.stack = append(i.stack, n4.children[itr])
 			}
 			if n4L != nil && hasPrefix(n4L.key, i.path) {
-				return getKey(n4L.key), n4L.value, true
+				return i.emit(n4L)
 			}
 		case *Node16[T]:
 			n16 := node.(*Node16[T])
@@ -53,7 +132,7 @@ func (i *Iterator[T]) Next() ([]byte, T, bool) {
 				i.stack = append(i.stack, n16.children[itr])
 			}
 			if n16L != nil && hasPrefix(n16L.key, i.path) {
-				return getKey(n16L.key), n16L.value, true
+				return i.emit(n16L)
 			}
 		case *Node48[T]:
 			n48 := node.(*Node48[T])
@@ -70,7 +149,7 @@ func (i *Iterator[T]) Next() ([]byte, T, bool) {
 				i.stack = append(i.stack, nodeCh)
 			}
 			if n48L != nil && hasPrefix(n48L.key, i.path) {
-				return getKey(n48L.key), n48L.value, true
+				return i.emit(n48L)
 			}
 		case *Node256[T]:
 			n256 := node.(*Node256[T])
@@ -83,7 +162,7 @@ func (i *Iterator[T]) Next() ([]byte, T, bool) {
 				i.stack = append(i.stack, nodeCh)
 			}
 			if n256L != nil && hasPrefix(n256L.key, i.path) {
-				return getKey(n256L.key), n256L.value, true
+				return i.emit(n256L)
 			}
 		case *NodeLeaf[T]:
 			leafCh := node.(*NodeLeaf[T])
@@ -91,22 +170,38 @@ func (i *Iterator[T]) Next() ([]byte, T, bool) {
 				continue
 			}
 			if hasPrefix(leafCh.key, i.path) {
-				return getKey(leafCh.key), leafCh.value, true
+				return i.emit(leafCh)
 			}
 		}
 	}
 	return nil, zero, false
 }
 
+// emit records l as the entry being returned and returns its key and value
+func (i *Iterator[T]) emit(l *NodeLeaf[T]) ([]byte, T, bool) {
+	i.rawKey = l.key
+	return l.userKey(), l.value, true
+}
+
 func (i *Iterator[T]) SeekPrefixWatch(prefix []byte) (watch <-chan struct{}) {
 	node := i.SeekPrefix(prefix)
 	return node.getMutateCh()
 }
 
+// SeekPrefixExists seeks the iterator to prefix as SeekPrefix does, and
+// returns whether any key starts with prefix. SeekPrefix cannot tell this
+// apart, as it returns the closest node even when nothing matches.
+func (i *Iterator[T]) SeekPrefixExists(prefix []byte) bool {
+	l := minimum[T](i.SeekPrefix(prefix))
+	return l != nil && len(l.getKey()) > 0 && bytes.HasPrefix(getKey(l.getKey()), prefix)
+}
+
 func (i *Iterator[T]) SeekPrefix(prefix []byte) Node[T] {
 	node := i.node
 
 	i.path = prefix
+	i.peeked = false
+	i.rawKey = nil
 
 	i.stack = nil
 	depth := 0
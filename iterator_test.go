@@ -982,6 +982,24 @@ func TestIterateLowerBound(t *testing.T) {
 			"dddagd",
 			[]string{"dddecge", "de", "def", "defdcbc", "df", "dfa", "dfabeba", "dfcaaba", "dfceg", "dfedg", "dg", "dgabadc", "dgced", "dgcggc", "e", "eaadfd", "ead", "eagbc", "eba", "ebafgd", "ebc", "ebeccbg", "ebf", "ebfb", "ecaceb", "ecafgbd", "eccfe", "ecgceg", "edbb", "edd", "eddg", "edggfcc", "ee", "eeb", "eebfffa", "efcd", "efcde", "efd", "efe", "effdgae", "egbb", "egbc", "eggf", "f", "fab", "faeae", "fbabf", "fbcgfff", "fbga", "fbgb", "fc", "fcbfcd", "fcdd", "fcfbg", "fdgcc", "fe", "fecgc", "fedcaag", "fff", "fg", "fgafg", "fgcceb", "fgddc", "fgdfcef", "fgdgedf", "g", "gabf", "gb", "gcfgefe", "gd", "gdacf", "gdc", "gdde", "gdeeegb", "gdgegea", "ge", "gea", "gef", "gfgdb", "ggad", "ggagcc", "ggb", "ggccgf", "ggebfdg", "ggf"},
 		},
+		{
+			// Search byte sorts after every child at the first level
+			[]string{"cbc", "ccb", "ccc"},
+			"cdc",
+			[]string{},
+		},
+		{
+			// Search byte sorts after every child below a matching prefix
+			[]string{"dad", "dba", "dbc", "dcd"},
+			"dbd",
+			[]string{"dcd"},
+		},
+		{
+			// Search prefix sorts before a node's partial
+			[]string{"aaxyz1", "aaxyz2", "b"},
+			"aaa",
+			[]string{"aaxyz1", "aaxyz2", "b"},
+		},
 	}
 
 	for idx, test := range cases {
@@ -1020,3 +1038,441 @@ func TestIterateLowerBound(t *testing.T) {
 		})
 	}
 }
+
+func TestIteratorPeek(t *testing.T) {
+	r := NewRadixTree[int]()
+	keys := []string{"bar", "foo", "foobar", "zip"}
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	iter := r.Root().Iterator()
+	iter.SeekPrefix(nil)
+	for i, want := range keys {
+		k1, v1, ok1 := iter.Peek()
+		k2, v2, ok2 := iter.Peek()
+		if !ok1 || !ok2 || string(k1) != want || string(k2) != want || v1 != i || v2 != i {
+			t.Fatalf("peek %d: got %q=%d %v and %q=%d %v, want %q=%d", i, k1, v1, ok1, k2, v2, ok2, want, i)
+		}
+		k, v, ok := iter.Next()
+		if !ok || string(k) != want || v != i {
+			t.Fatalf("next %d: got %q=%d %v, want %q=%d", i, k, v, ok, want, i)
+		}
+	}
+	if k, _, ok := iter.Peek(); ok {
+		t.Fatalf("peek past the end returned %q", k)
+	}
+	if k, _, ok := iter.Next(); ok {
+		t.Fatalf("next past the end returned %q", k)
+	}
+
+	// Seeking drops anything read ahead
+	iter = r.Root().Iterator()
+	iter.SeekPrefix(nil)
+	iter.Peek()
+	iter.SeekPrefix([]byte("foo"))
+	if k, _, _ := iter.Next(); string(k) != "foo" {
+		t.Fatalf("got %q after seek, want %q", k, "foo")
+	}
+}
+
+func TestIteratorRawKey(t *testing.T) {
+	r := NewRadixTree[int]()
+	keys := []string{"", "a$b", "foo", "foo/bar", "zip"}
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	iter := r.Root().Iterator()
+	iter.SeekPrefix(nil)
+	if iter.RawKey() != nil {
+		t.Fatalf("raw key %q before Next", iter.RawKey())
+	}
+	for k, _, ok := iter.Next(); ok; k, _, ok = iter.Next() {
+		// Peeking ahead leaves the raw key of the current entry alone
+		iter.Peek()
+		if want := string(k) + "$"; string(iter.RawKey()) != want {
+			t.Fatalf("raw key %q for %q, want %q", iter.RawKey(), k, want)
+		}
+	}
+	if iter.RawKey() != nil {
+		t.Fatalf("raw key %q after the end", iter.RawKey())
+	}
+}
+
+func TestIteratorSeekPrefixExists(t *testing.T) {
+	r := NewRadixTree[int]()
+	iter := r.Root().Iterator()
+	if iter.SeekPrefixExists(nil) {
+		t.Fatalf("empty tree has a key")
+	}
+
+	for i, k := range []string{"foo", "foo/bar", "foobar", "zip", "0123456789abcdefghij"} {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+	for _, prefix := range []string{"", "f", "foo", "foo/", "foo/bar", "zi", "0123456789abcdefghi"} {
+		iter := r.Root().Iterator()
+		if !iter.SeekPrefixExists([]byte(prefix)) {
+			t.Fatalf("prefix %q should exist", prefix)
+		}
+		if _, _, ok := iter.Next(); !ok {
+			t.Fatalf("no key under prefix %q", prefix)
+		}
+	}
+	for _, prefix := range []string{"a", "fooa", "foo/bar/", "zipper", "0123456789abcdefghik"} {
+		iter := r.Root().Iterator()
+		if iter.SeekPrefixExists([]byte(prefix)) {
+			t.Fatalf("prefix %q should not exist", prefix)
+		}
+		if k, _, ok := iter.Next(); ok {
+			t.Fatalf("key %q under prefix %q", k, prefix)
+		}
+	}
+}
+
+func TestLowerBoundIterator_SeekPrefixLowerBound(t *testing.T) {
+	r := NewRadixTree[int]()
+	var all []string
+	for i := 0; i < 100; i++ {
+		all = append(all, fmt.Sprintf("foo/%02d", i))
+	}
+	for i, k := range append([]string{"fo", "foo", "foo.", "foo0", "fop/00", "zip"}, all...) {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	cases := []struct {
+		prefix, from string
+		want         []string
+	}{
+		{"foo/", "foo/50", all[50:]},
+		{"foo/", "foo/505", all[51:]},
+		{"foo/", "foo/99", all[99:]},
+		{"foo/", "foo/", all},
+		{"foo/", "", all},
+		{"foo/", "f", all},
+		{"foo/", "foo/999", nil},
+		{"foo/", "fop", nil},
+		{"foo/5", "foo/", all[50:60]},
+		{"foo", "foo/98", append(slices.Clone(all[98:]), "foo0")},
+		{"bar", "", nil},
+		{"", "zip", []string{"zip"}},
+	}
+	for _, c := range cases {
+		iter := r.Root().LowerBoundIterator()
+		iter.SeekPrefixLowerBound([]byte(c.prefix), []byte(c.from))
+		var got []string
+		for k, _, ok := iter.Next(); ok; k, _, ok = iter.Next() {
+			got = append(got, string(k))
+		}
+		if !slices.Equal(got, c.want) {
+			t.Fatalf("prefix %q from %q: got %q, want %q", c.prefix, c.from, got, c.want)
+		}
+	}
+
+	// A plain seek afterwards is no longer confined to the prefix
+	iter := r.Root().LowerBoundIterator()
+	iter.SeekPrefixLowerBound([]byte("foo/"), []byte("foo/98"))
+	iter.SeekLowerBound([]byte("foo/99"))
+	var got []string
+	for k, _, ok := iter.Next(); ok; k, _, ok = iter.Next() {
+		got = append(got, string(k))
+	}
+	if want := []string{"foo/99", "foo0", "fop/00", "zip"}; !slices.Equal(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestIterator_RootWithoutSeek(t *testing.T) {
+	for want, n := range map[nodeType]int{node4: 3, node16: 10, node48: 30, node256: 100} {
+		r := NewRadixTree[int]()
+		var keys []string
+		for i := 0; i < n; i++ {
+			k := fmt.Sprintf("%c%d", byte(i), i)
+			r, _, _ = r.Insert([]byte(k), i)
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		if got := r.Root().getArtNodeType(); got != want {
+			t.Fatalf("root is %v, want %v", got, want)
+		}
+
+		var got []string
+		it := r.Root().Iterator()
+		for k, _, ok := it.Next(); ok; k, _, ok = it.Next() {
+			got = append(got, string(k))
+		}
+		if !slices.Equal(got, keys) {
+			t.Fatalf("%v: got %q, want %q", want, got, keys)
+		}
+	}
+
+	// An empty tree yields nothing
+	if _, _, ok := NewRadixTree[int]().Root().Iterator().Next(); ok {
+		t.Fatalf("expected no keys")
+	}
+}
+
+func TestWalkPrefixStripped(t *testing.T) {
+	r := NewRadixTree[int]()
+	for i, k := range []string{"fo", "foo", "foo/", "foo/bar", "foo/baz", "foo0", "zip"} {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	walk := func(prefix string) ([]string, []int) {
+		var suffixes []string
+		var values []int
+		r.WalkPrefixStripped([]byte(prefix), func(k []byte, v int) bool {
+			suffixes = append(suffixes, string(k))
+			values = append(values, v)
+			return false
+		})
+		return suffixes, values
+	}
+
+	suffixes, values := walk("foo/")
+	if want := []string{"", "bar", "baz"}; !slices.Equal(suffixes, want) {
+		t.Fatalf("got %q, want %q", suffixes, want)
+	}
+	if want := []int{2, 3, 4}; !slices.Equal(values, want) {
+		t.Fatalf("got %v, want %v", values, want)
+	}
+
+	if suffixes, _ = walk("foo/b"); !slices.Equal(suffixes, []string{"ar", "az"}) {
+		t.Fatalf("got %q", suffixes)
+	}
+	if suffixes, _ = walk(""); len(suffixes) != 7 || suffixes[0] != "fo" {
+		t.Fatalf("got %q", suffixes)
+	}
+	if suffixes, _ = walk("foo/c"); len(suffixes) != 0 {
+		t.Fatalf("got %q", suffixes)
+	}
+
+	// Returning true stops the walk
+	var n int
+	r.WalkPrefixStripped([]byte("foo"), func([]byte, int) bool {
+		n++
+		return true
+	})
+	if n != 1 {
+		t.Fatalf("walked %d keys after stopping", n)
+	}
+}
+
+func TestRange(t *testing.T) {
+	fixedLenKeys := []string{"00000", "00001", "00004", "00010", "00020", "20020"}
+	r := NewRadixTree[int]()
+	for i, k := range fixedLenKeys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	cases := []struct {
+		lo, hi []byte
+		want   []string
+	}{
+		{nil, nil, fixedLenKeys},
+		{[]byte("00001"), []byte("00020"), []string{"00001", "00004", "00010"}},
+		{[]byte("00002"), []byte("00011"), []string{"00004", "00010"}},
+		{[]byte("00010"), nil, []string{"00010", "00020", "20020"}},
+		{nil, []byte("00004"), []string{"00000", "00001"}},
+		{[]byte("0001"), []byte("0002"), []string{"00010"}},
+		{[]byte("00004"), []byte("00004"), nil},
+		{[]byte("00020"), []byte("00010"), nil},
+		{[]byte("3"), nil, nil},
+		{nil, []byte("0"), nil},
+	}
+	for _, c := range cases {
+		keys, values := r.Range(c.lo, c.hi)
+		var got []string
+		for i, k := range keys {
+			got = append(got, string(k))
+			if want := slices.Index(fixedLenKeys, string(k)); values[i] != want {
+				t.Fatalf("[%q, %q): value %d for %q, want %d", c.lo, c.hi, values[i], k, want)
+			}
+		}
+		if !slices.Equal(got, c.want) {
+			t.Fatalf("[%q, %q): got %q, want %q", c.lo, c.hi, got, c.want)
+		}
+	}
+
+	if keys, _ := NewRadixTree[int]().Range(nil, nil); len(keys) != 0 {
+		t.Fatalf("expected no keys, got %q", keys)
+	}
+}
+
+func TestIteratorCurrentPath(t *testing.T) {
+	r := NewRadixTree[int]()
+	for i, k := range []string{"", "foo", "foo/bar", "foo/baz", "foobar", "zip"} {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	iter := r.Root().Iterator()
+	iter.SeekPrefix([]byte("foo"))
+	if iter.CurrentPath() != nil {
+		t.Fatalf("path %q before Next", iter.CurrentPath())
+	}
+	var got []string
+	for k, _, ok := iter.Next(); ok; k, _, ok = iter.Next() {
+		// The path follows the entries while Path stays on the prefix
+		iter.Peek()
+		if !slices.Equal(iter.CurrentPath(), k) {
+			t.Fatalf("path %q for %q", iter.CurrentPath(), k)
+		}
+		if iter.Path() != "foo" {
+			t.Fatalf("path changed to %q", iter.Path())
+		}
+		got = append(got, string(iter.CurrentPath()))
+	}
+	if want := []string{"foo", "foo/bar", "foo/baz", "foobar"}; !slices.Equal(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if iter.CurrentPath() != nil {
+		t.Fatalf("path %q after the end", iter.CurrentPath())
+	}
+
+	// The empty key has an empty path, and a scan resumed from a path starts
+	// with the entry at it
+	iter = r.Root().Iterator()
+	k, _, _ := iter.Next()
+	if len(k) != 0 || iter.CurrentPath() == nil || len(iter.CurrentPath()) != 0 {
+		t.Fatalf("path %q for the empty key", iter.CurrentPath())
+	}
+	iter.Next()
+	iter.Next()
+	lb := r.Root().LowerBoundIterator()
+	lb.SeekLowerBound(iter.CurrentPath())
+	if k, _, _ := lb.Next(); string(k) != "foo/bar" {
+		t.Fatalf("resumed at %q", k)
+	}
+}
+
+func TestIteratorSkip(t *testing.T) {
+	r := NewRadixTree[int]()
+	var keys []string
+	for i := 0; i < 20; i++ {
+		keys = append(keys, fmt.Sprintf("key%02d", i))
+	}
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	iter := r.Root().Iterator()
+	if n := iter.Skip(5); n != 5 {
+		t.Fatalf("skipped %d, want 5", n)
+	}
+	if k, v, ok := iter.Next(); !ok || string(k) != keys[5] || v != 5 {
+		t.Fatalf("got %q=%d %v, want %q=5", k, v, ok, keys[5])
+	}
+
+	// An entry read ahead by Peek counts as the first one skipped
+	iter.Peek()
+	iter.Skip(2)
+	if k, _, _ := iter.Next(); string(k) != keys[8] {
+		t.Fatalf("got %q, want %q", k, keys[8])
+	}
+
+	if n := iter.Skip(100); n != 11 {
+		t.Fatalf("skipped %d past the end, want 11", n)
+	}
+	if k, _, ok := iter.Next(); ok {
+		t.Fatalf("next after skipping to the end returned %q", k)
+	}
+
+	iter = r.Root().Iterator()
+	iter.SeekPrefix([]byte("key1"))
+	iter.Skip(0)
+	if k, _, _ := iter.Next(); string(k) != "key10" {
+		t.Fatalf("got %q, want key10", k)
+	}
+}
+
+func TestWalkKeyLen(t *testing.T) {
+	keys := []string{"", "0", "0000", "00000", "000000", "00001", "0001", "00010",
+		"00011x", "1", "12345", "123456789", "2", "abcde", "abcdef", "b"}
+	r := NewRadixTree[int]()
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	for _, n := range []int{0, 1, 4, 5, 6, 9, 10} {
+		var want []string
+		for _, k := range keys {
+			if len(k) == n {
+				want = append(want, k)
+			}
+		}
+		var got []string
+		r.WalkKeyLen(n, func(k []byte, v int) bool {
+			if keys[v] != string(k) {
+				t.Fatalf("key %q has value %d", k, v)
+			}
+			got = append(got, string(k))
+			return false
+		})
+		if !slices.Equal(got, want) {
+			t.Fatalf("length %d: got %q, want %q", n, got, want)
+		}
+	}
+
+	var got []string
+	r.WalkKeyLen(5, func(k []byte, v int) bool {
+		got = append(got, string(k))
+		return len(got) == 2
+	})
+	if !slices.Equal(got, []string{"00000", "00001"}) {
+		t.Fatalf("stopped walk got %q", got)
+	}
+	r.WalkKeyLen(-1, func(k []byte, v int) bool {
+		t.Fatalf("walked %q for a negative length", k)
+		return false
+	})
+}
+
+// TestIterateLowerBoundStress builds random trees with a fixed seed and checks
+// SeekLowerBound from random keys against a sorted slice. Keys are drawn from a
+// few letters, share runs longer than maxPrefixLen and include bytes on either
+// side of the '$' terminator, so seeks often split on a node's prefix.
+func TestIterateLowerBoundStress(t *testing.T) {
+	rng := rand.New(rand.NewSource(1_000_003))
+	stems := []string{"", "a", "ab", "aab", "abababababab", "abababababababab"}
+	gen := func() string {
+		b := []byte(stems[rng.Intn(len(stems))])
+		for i := rng.Intn(4); i > 0; i-- {
+			b = append(b, "!$ab"[rng.Intn(4)])
+		}
+		return string(b)
+	}
+
+	for trial := 0; trial < 2000; trial++ {
+		r := NewRadixTree[int]()
+		set := make(map[string]bool)
+		for i := rng.Intn(40); i >= 0; i-- {
+			k := gen()
+			if rng.Intn(4) == 0 {
+				r, _, _ = r.Delete([]byte(k))
+				delete(set, k)
+				continue
+			}
+			r, _, _ = r.Insert([]byte(k), 0)
+			set[k] = true
+		}
+		sorted := make([]string, 0, len(set))
+		for k := range set {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+
+		for s := 0; s < 10; s++ {
+			seek := gen()
+			want := sorted[sort.SearchStrings(sorted, seek):]
+			var got []string
+			it := r.Root().LowerBoundIterator()
+			it.SeekLowerBound([]byte(seek))
+			for k, _, ok := it.Next(); ok; k, _, ok = it.Next() {
+				got = append(got, string(k))
+			}
+			if !slices.Equal(got, want) {
+				t.Fatalf("trial %d: seek %q in %q\n got %q\nwant %q", trial, seek, sorted, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package adaptive
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// The tree orders keys by comparing their bytes, which does not match the
+// numeric order of integers in their native encoding. The helpers below encode
+// integers into fixed length keys whose byte order is their numeric order, so
+// iteration and seeks such as SeekLowerBound and SeekReverseLowerBound work
+// numerically. As every key they produce has the same length, none is a prefix
+// of another, and the same holds when they are appended to a common prefix.
+
+// EncodeUint64BigEndian encodes v as an 8 byte key that sorts in numeric order.
+func EncodeUint64BigEndian(v uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, v)
+}
+
+// DecodeUint64BigEndian decodes a key made by EncodeUint64BigEndian. It panics
+// if b is shorter than 8 bytes.
+func DecodeUint64BigEndian(b []byte) uint64 {
+	return binary.BigEndian.Uint64(b)
+}
+
+// EncodeInt64Orderable encodes v as an 8 byte key that sorts in numeric order,
+// with negative numbers before positive ones. The sign bit is flipped so that
+// the two's complement representation orders correctly as unsigned bytes.
+func EncodeInt64Orderable(v int64) []byte {
+	return EncodeUint64BigEndian(uint64(v) ^ (1 << 63))
+}
+
+// DecodeInt64Orderable decodes a key made by EncodeInt64Orderable. It panics
+// if b is shorter than 8 bytes.
+func DecodeInt64Orderable(b []byte) int64 {
+	return int64(DecodeUint64BigEndian(b) ^ (1 << 63))
+}
+
+// Composite keys made with JoinKey end every part with keyPartEnd and escape
+// any zero byte within a part as keyEscape. Zero sorts below every other byte,
+// so keys compare part by part: a shorter part sorts before any part it is a
+// prefix of, the same way the parts would compare on their own.
+var (
+	keyPartEnd = []byte{0x00, 0x01}
+	keyEscape  = []byte{0x00, 0xff}
+)
+
+// JoinKey combines parts into one key that can be split back into the same
+// parts with SplitKey, whatever bytes the parts contain. Keys with the same
+// number of parts iterate in the order of their first part, then their
+// second, and so on, and none is a prefix of another, so a prefix made by
+// joining the leading parts matches exactly the keys starting with them.
+func JoinKey(parts ...[]byte) []byte {
+	n := 0
+	for _, p := range parts {
+		n += len(p) + len(keyPartEnd)
+	}
+	key := make([]byte, 0, n)
+	for _, p := range parts {
+		for _, c := range p {
+			if c == 0x00 {
+				key = append(key, keyEscape...)
+			} else {
+				key = append(key, c)
+			}
+		}
+		key = append(key, keyPartEnd...)
+	}
+	return key
+}
+
+// SplitKey splits a key made by JoinKey back into its parts. It returns nil if
+// the key was not made by JoinKey.
+func SplitKey(key []byte) [][]byte {
+	var parts [][]byte
+	part := []byte{}
+	for len(key) > 0 {
+		i := bytes.IndexByte(key, 0x00)
+		if i < 0 || i+1 >= len(key) {
+			return nil
+		}
+		part = append(part, key[:i]...)
+		switch key[i+1] {
+		case keyEscape[1]:
+			part = append(part, 0x00)
+		case keyPartEnd[1]:
+			parts = append(parts, part)
+			part = []byte{}
+		default:
+			return nil
+		}
+		key = key[i+2:]
+	}
+	return parts
+}
@@ -0,0 +1,153 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package adaptive
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeInt64Orderable(t *testing.T) {
+	nums := []int64{math.MinInt64, math.MinInt64 + 1, -1 << 40, -256, -255, -2, -1, 0, 1, 2, 255, 256, 1 << 40, math.MaxInt64 - 1, math.MaxInt64}
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		nums = append(nums, rnd.Int63()-rnd.Int63())
+	}
+
+	r := NewRadixTree[int64]()
+	for _, i := range rnd.Perm(len(nums)) {
+		r, _, _ = r.Insert(EncodeInt64Orderable(nums[i]), nums[i])
+	}
+	sort.Slice(nums, func(i, j int) bool { return nums[i] < nums[j] })
+
+	var out []int64
+	r.Walk(func(k []byte, v int64) bool {
+		require.Equal(t, v, DecodeInt64Orderable(k))
+		out = append(out, v)
+		return false
+	})
+	require.Equal(t, nums, out)
+
+	// Ceiling of -3 is -2
+	it := r.Root().LowerBoundIterator()
+	it.SeekLowerBound(EncodeInt64Orderable(-3))
+	_, v, ok := it.Next()
+	require.True(t, ok)
+	require.Equal(t, int64(-2), v)
+
+	// Floor of 3 is 2
+	rit := r.Root().ReverseIterator()
+	rit.SeekReverseLowerBound(EncodeInt64Orderable(3))
+	_, v, ok = rit.Previous()
+	require.True(t, ok)
+	require.Equal(t, int64(2), v)
+}
+
+func TestEncodeUint64BigEndian(t *testing.T) {
+	nums := []uint64{0, 1, 2, 36, 255, 256, 1 << 32, math.MaxUint64 - 1, math.MaxUint64}
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		nums = append(nums, rnd.Uint64())
+	}
+
+	r := NewRadixTree[uint64]()
+	for _, i := range rnd.Perm(len(nums)) {
+		r, _, _ = r.Insert(EncodeUint64BigEndian(nums[i]), nums[i])
+	}
+	sort.Slice(nums, func(i, j int) bool { return nums[i] < nums[j] })
+
+	var out []uint64
+	r.Walk(func(k []byte, v uint64) bool {
+		require.Equal(t, v, DecodeUint64BigEndian(k))
+		out = append(out, v)
+		return false
+	})
+	require.Equal(t, nums, out)
+}
+
+func TestJoinKey(t *testing.T) {
+	cases := [][][]byte{
+		{[]byte("ns"), []byte("id")},
+		{[]byte("ns"), []byte("a/b")},
+		{[]byte("ns/a"), []byte("b")},
+		{[]byte("a\x00b"), []byte("\x00")},
+		{[]byte("\x00\x01"), []byte("\x00\xff"), []byte("\xff")},
+		{[]byte{}, []byte("x")},
+		{[]byte("x"), []byte{}},
+		{[]byte("x")},
+	}
+	seen := map[string]bool{}
+	for _, parts := range cases {
+		key := JoinKey(parts...)
+		require.False(t, seen[string(key)], "parts %q", parts)
+		seen[string(key)] = true
+		require.Equal(t, parts, SplitKey(key))
+	}
+	require.Empty(t, SplitKey(JoinKey()))
+
+	// The separator inside a part no longer splits it
+	require.NotEqual(t, JoinKey([]byte("ns"), []byte("a/b")), JoinKey([]byte("ns/a"), []byte("b")))
+
+	for _, bad := range []string{"a", "a\x00", "a\x00\x02", "a\x00\x01b"} {
+		require.Nil(t, SplitKey([]byte(bad)), "key %q", bad)
+	}
+}
+
+func TestJoinKeyOrder(t *testing.T) {
+	ids := []string{"", "\x00", "\x00\x00", "\x00\x01", "\x01", "/", "a", "a\x00", "a/b", "ab", "b", "\xff"}
+	var want [][2]string
+	for _, ns := range []string{"", "a", "a\x00", "b"} {
+		for _, id := range ids {
+			want = append(want, [2]string{ns, id})
+		}
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	r := NewRadixTree[int]()
+	for _, i := range rnd.Perm(len(want)) {
+		r, _, _ = r.Insert(JoinKey([]byte(want[i][0]), []byte(want[i][1])), i)
+	}
+	var got [][2]string
+	r.Walk(func(k []byte, _ int) bool {
+		parts := SplitKey(k)
+		got = append(got, [2]string{string(parts[0]), string(parts[1])})
+		return false
+	})
+	require.Equal(t, want, got)
+
+	// Seeking by the first part alone finds exactly that namespace
+	var ns []string
+	it := r.Root().Iterator()
+	prefix := JoinKey([]byte("a"))
+	it.SeekPrefix(prefix)
+	for k, _, ok := it.Next(); ok; k, _, ok = it.Next() {
+		ns = append(ns, string(SplitKey(k)[1]))
+	}
+	require.Equal(t, ids, ns)
+}
+
+// Encoded integers can be searched for the nearest stored number: the
+// ceiling with SeekLowerBound and the floor with SeekReverseLowerBound.
+func ExampleEncodeInt64Orderable() {
+	r := NewRadixTree[int64]()
+	for _, v := range []int64{-20, -5, 0, 7, 300} {
+		r, _, _ = r.Insert(EncodeInt64Orderable(v), v)
+	}
+
+	it := r.Root().LowerBoundIterator()
+	it.SeekLowerBound(EncodeInt64Orderable(-10))
+	_, ceil, _ := it.Next()
+
+	rit := r.Root().ReverseIterator()
+	rit.SeekReverseLowerBound(EncodeInt64Orderable(100))
+	_, floor, _ := rit.Previous()
+
+	fmt.Println(ceil, floor)
+	// Output: -5 7
+}
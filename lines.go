@@ -0,0 +1,41 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package adaptive
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// LoadLines builds a tree with one key for each line read from r, storing the
+// value returned by value for it. Lines are numbered from 1, and they may be
+// of any length. The newline ending each line is not part of the key, nor is
+// a carriage return before it. Blank lines are skipped rather than loaded as
+// the empty key, though they still count towards the line numbers. A last
+// line without a newline is still loaded, and a line that appears more than
+// once keeps the value of its last occurrence. If reading from r fails, the error is returned along with no
+// tree.
+func LoadLines[T any](r io.Reader, value func(line []byte, lineNo int) T) (*RadixTree[T], error) {
+	txn := NewRadixTree[T]().Txn(false)
+	br := bufio.NewReader(r)
+	for lineNo := 1; ; lineNo++ {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			line = line[:len(line)-1]
+			if len(line) > 0 && line[len(line)-1] == '\r' {
+				line = line[:len(line)-1]
+			}
+		}
+		if len(line) > 0 {
+			txn.Insert(line, value(line, lineNo))
+		}
+		if err == io.EOF {
+			return txn.Commit(), nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("adaptive: reading line %d: %w", lineNo, err)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package adaptive
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadLines(t *testing.T) {
+	f, err := os.Open("test-text/words.txt")
+	require.NoError(t, err)
+	defer f.Close()
+
+	r, err := LoadLines(f, func(line []byte, lineNo int) int { return lineNo })
+	require.NoError(t, err)
+	words := loadTestFile("test-text/words.txt")
+	require.Equal(t, len(words), r.Len())
+	for i, w := range words {
+		v, ok := r.Get(w)
+		require.True(t, ok, "word %q", w)
+		require.Equal(t, i+1, v)
+	}
+}
+
+func TestLoadLines_EdgeCases(t *testing.T) {
+	long := strings.Repeat("x", 100000)
+	cases := map[string][]string{
+		"":                       nil,
+		"foo":                    {"foo"},
+		"foo\n":                  {"foo"},
+		"foo\nbar":               {"bar", "foo"},
+		"foo\r\nbar\r\n":         {"bar", "foo"},
+		"foo\n\nbar\n":           {"bar", "foo"},
+		"\n\r\n":                 nil,
+		"foo\nfoo\n":             {"foo"},
+		long + "\n" + long + "y": {long, long + "y"},
+		"a\r\rb\n":               {"a\r\rb"},
+	}
+	for in, want := range cases {
+		r, err := LoadLines(strings.NewReader(in), func(line []byte, lineNo int) string {
+			return string(line)
+		})
+		require.NoError(t, err)
+		require.Equal(t, want, walkKeys(r), "input %q", in)
+		r.Walk(func(k []byte, v string) bool {
+			require.Equal(t, string(k), v)
+			return false
+		})
+	}
+
+	// The last of several equal lines wins
+	r, err := LoadLines(strings.NewReader("foo\nbar\nfoo"), func(line []byte, lineNo int) int { return lineNo })
+	require.NoError(t, err)
+	v, _ := r.Get([]byte("foo"))
+	require.Equal(t, 3, v)
+
+	// Blank lines are skipped but still numbered
+	r, err = LoadLines(strings.NewReader("foo\n\r\n\nbar\n"), func(line []byte, lineNo int) int { return lineNo })
+	require.NoError(t, err)
+	require.False(t, r.Contains(nil))
+	v, _ = r.Get([]byte("bar"))
+	require.Equal(t, 4, v)
+
+	boom := errors.New("boom")
+	r, err = LoadLines(io.MultiReader(strings.NewReader("foo\n"), iotest.ErrReader(boom)), func([]byte, int) int { return 0 })
+	require.ErrorIs(t, err, boom)
+	require.Nil(t, r)
+}
@@ -11,12 +11,22 @@ import (
 // down to a specified path. This will iterate over the same values that
 // the Node.WalkPath method will.
 type LowerBoundIterator[T any] struct {
-	path         []byte
-	node         Node[T]
-	stack        []Node[T]
-	depth        int
-	pos          Node[T]
-	seenMismatch bool
+	path  []byte
+	node  Node[T]
+	stack []Node[T]
+	depth int
+	pos   Node[T]
+
+	// prefix confines iteration to the keys starting with it, once set by
+	// SeekPrefixLowerBound. Keys come in order, so the first key without it
+	// ends the iteration.
+	prefix  []byte
+	bounded bool
+
+	// rawKey is the stored key of the entry last returned by next. Bounds
+	// are compared against it rather than the key returned, which is the
+	// key as inserted when the tree has a KeyTransform.
+	rawKey []byte
 }
 
 // Front returns the current node that has been iterated to.
@@ -29,7 +39,20 @@ func (i *LowerBoundIterator[T]) Path() string {
 }
 
 func (i *LowerBoundIterator[T]) Next() ([]byte, T, bool) {
+	key, value, ok := i.next()
+	if ok && i.bounded && !bytes.HasPrefix(i.storedKey(), i.prefix) {
+		// Everything still in the stack sorts after this key, so it is all
+		// outside the prefix as well
+		var zero T
+		i.stack = nil
+		return nil, zero, false
+	}
+	return key, value, ok
+}
+
+func (i *LowerBoundIterator[T]) next() ([]byte, T, bool) {
 	var zero T
+	i.rawKey = nil
 
 	// Iterate through the stack until it's empty
 	for len(i.stack) > 0 {
@@ -47,8 +70,9 @@ func (i *LowerBoundIterator[T]) Next() ([]byte, T, bool) {
 			for itr := int(n4.numChildren) - 1; itr >= 0; itr-- {
 				i.stack = append(i.stack, n4.children[itr])
 			}
-			if n4L != nil {
-				return getKey(n4L.key), n4L.value, true
+			// The empty root carries a leaf with no key, which is not a stored key
+			if n4L != nil && len(n4L.key) > 0 {
+				return i.emit(n4L)
 			}
 		case *Node16[T]:
 			n16 := node.(*Node16[T])
@@ -56,8 +80,8 @@ func (i *LowerBoundIterator[T]) Next() ([]byte, T, bool) {
 			for itr := int(n16.numChildren) - 1; itr >= 0; itr-- {
 				i.stack = append(i.stack, n16.children[itr])
 			}
-			if n16L != nil {
-				return getKey(n16.leaf.key), n16.leaf.value, true
+			if n16L != nil && len(n16L.key) > 0 {
+				return i.emit(n16L)
 			}
 		case *Node48[T]:
 			n48 := node.(*Node48[T])
@@ -73,8 +97,8 @@ func (i *LowerBoundIterator[T]) Next() ([]byte, T, bool) {
 				}
 				i.stack = append(i.stack, nodeCh)
 			}
-			if n48L != nil {
-				return getKey(n48L.key), n48L.value, true
+			if n48L != nil && len(n48L.key) > 0 {
+				return i.emit(n48L)
 			}
 		case *Node256[T]:
 			n256 := node.(*Node256[T])
@@ -86,17 +110,31 @@ func (i *LowerBoundIterator[T]) Next() ([]byte, T, bool) {
 				}
 				i.stack = append(i.stack, nodeCh)
 			}
-			if n256L != nil {
-				return getKey(n256L.key), n256L.value, true
+			if n256L != nil && len(n256L.key) > 0 {
+				return i.emit(n256L)
 			}
 		case *NodeLeaf[T]:
 			leafCh := node.(*NodeLeaf[T])
-			return getKey(leafCh.key), leafCh.value, true
+			if len(leafCh.key) > 0 {
+				return i.emit(leafCh)
+			}
 		}
 	}
 	return nil, zero, false
 }
 
+// emit records l as the entry being returned and returns its key and value
+func (i *LowerBoundIterator[T]) emit(l *NodeLeaf[T]) ([]byte, T, bool) {
+	i.rawKey = l.key
+	return l.userKey(), l.value, true
+}
+
+// storedKey returns the key of the entry last returned as it is ordered in
+// the tree, without its terminator
+func (i *LowerBoundIterator[T]) storedKey() []byte {
+	return getKey(i.rawKey)
+}
+
 func (i *LowerBoundIterator[T]) recurseMin(n Node[T]) Node[T] {
 	// Traverse to the minimum child
 	if n.isLeaf() {
@@ -119,240 +157,125 @@ func (i *LowerBoundIterator[T]) recurseMin(n Node[T]) Node[T] {
 	return nil
 }
 
+// SeekLowerBound is used to seek the iterator to the smallest key that is
+// greater or equal to the given key. Iteration then continues through every
+// larger key in order.
 func (i *LowerBoundIterator[T]) SeekLowerBound(prefixKey []byte) {
 	node := i.node
 
 	i.stack = []Node[T]{}
+	i.bounded = false
 
 	if len(prefixKey) == 0 {
 		i.stack = []Node[T]{node}
 		return
 	}
 
-	prefix := getTreeKey(prefixKey)
+	i.path = getTreeKey(prefixKey)
 
-	found := func(n Node[T]) {
-		nL := n.getNodeLeaf()
-		if nL == nil {
-			i.stack = append(
-				i.stack,
-				n,
-			)
-			return
-		}
-		if bytes.Compare(nL.key, i.path) >= 0 {
-			i.stack = append(
-				i.stack,
-				n,
-			)
-			return
-		}
-	}
+	// Keys are compared without their terminators. A stored key sorts by its
+	// '$' against a longer key's next byte, which is not how the keys compare
+	// when that byte is below '$'.
+	key := prefixKey
 
-	findMin := func(n Node[T]) {
-		if n != nil {
-			found(n)
-			return
-		}
-		n = i.recurseMin(n)
+	// A key at or before the smallest one in the tree bounds nothing, so the
+	// whole tree is iterated as it is for an empty key, without walking the
+	// path and pushing the subtrees along it
+	if l := minimum[T](node); l != nil && len(l.getKey()) > 0 && bytes.Compare(getKey(l.getKey()), key) >= 0 {
+		i.stack = []Node[T]{node}
+		return
 	}
-
-	i.path = prefix
-
 	depth := 0
-	i.node = node
-	i.seenMismatch = false
-
-	var parent Node[T]
 
-	for {
-
-		// Check if the node matches the prefix
-
-		if node == nil {
-			if parent != nil && parent.getNodeLeaf() != nil {
-				i.stack = append(i.stack, parent.getNodeLeaf())
-			}
-			return
-		}
-
-		var prefixCmp int
-		if !node.isLeaf() {
-			if int(node.getPartialLen()) < len(prefix) {
-				prefixCmp = bytes.Compare(node.getPartial()[:node.getPartialLen()], prefix[depth:min(len(prefix), depth+int(node.getPartialLen()))])
-			} else {
-				prefixCmp = bytes.Compare(node.getPartial()[:node.getPartialLen()], prefix[depth:])
+	// Walk down the path of the search key. Every subtree to the right of the
+	// path holds only larger keys, so it is pushed whole before moving on,
+	// leaving the stack ordered with the smallest candidates on top.
+	for node != nil {
+		// A node holding just a leaf either sorts at or after the key or not
+		if node.getArtNodeType() == leafType || node.isLeaf() {
+			l := node.getNodeLeaf()
+			if node.getArtNodeType() == leafType {
+				l = node.(*NodeLeaf[T])
 			}
-		}
-
-		if prefixCmp > 0 && !i.seenMismatch {
-			// Prefix is larger, that means the lower bound is greater than the search
-			// and from now on we need to follow the minimum path to the smallest
-			// leaf under this subtree.
-			nL := node.getNodeLeaf()
-			if nL != nil {
-				if bytes.Compare(nL.key, i.path) >= 0 {
-					findMin(node)
-				}
-			} else {
-				findMin(node)
-			}
-			if parent != nil && parent.getNodeLeaf() != nil {
-				if bytes.Compare(parent.getNodeLeaf().getKey(), i.path) >= 0 {
-					i.stack = append(i.stack, parent.getNodeLeaf())
-				}
-				return
+			if len(l.getKey()) > 0 && bytes.Compare(getKey(l.getKey()), key) >= 0 {
+				i.stack = append(i.stack, node)
 			}
 			return
 		}
 
-		if prefixCmp < 0 && !i.seenMismatch {
-			// Prefix is smaller than search prefix, that means there is no lower
-			// bound
-			i.node = nil
-			if parent != nil && parent.getNodeLeaf() != nil {
-				if bytes.Compare(parent.getNodeLeaf().getKey(), i.path) >= 0 {
-					i.stack = append(i.stack, parent.getNodeLeaf())
-				}
+		// Compare the node's prefix against the same bytes of the key. Only
+		// the first maxPrefixLen bytes are stored on the node, so a longer
+		// prefix is read from a leaf below it instead. A key that runs out
+		// within the prefix compares lower, as every key below extends it.
+		partialLen := int(node.getPartialLen())
+		nodePrefix := node.getPartial()[:min(maxPrefixLen, partialLen)]
+		if partialLen > maxPrefixLen {
+			if l := minimum[T](node); l != nil && len(l.key) >= depth+partialLen {
+				nodePrefix = l.key[depth : depth+partialLen]
 			}
-			return
 		}
-
-		if node.isLeaf() && node.getNodeLeaf() != nil && bytes.Compare(node.getNodeLeaf().getKey(), prefix) >= 0 {
-			found(node)
-			if parent != nil && parent.getNodeLeaf() != nil {
-				if bytes.Compare(parent.getNodeLeaf().getKey(), i.path) >= 0 {
-					i.stack = append(i.stack, parent.getNodeLeaf())
-				}
-			}
+		switch bytes.Compare(nodePrefix, key[depth:min(depth+partialLen, len(key))]) {
+		case 1:
+			// Everything below sorts after the key
+			i.stack = append(i.stack, node)
 			return
-		}
-
-		// Determine the child index to proceed based on the next byte of the prefix
-		// If the node has a prefix, compare it with the prefix
-		if node.getArtNodeType() != leafType {
-			mismatchIdx := prefixMismatch[T](node, prefix, len(prefix), depth)
-			if mismatchIdx < int(node.getPartialLen()) && !i.seenMismatch {
-				// If there's a mismatch, set the node to nil to break the loop
-				node = nil
-				return
-			}
-			if mismatchIdx > 0 {
-				i.seenMismatch = true
-			}
-			depth += int(node.getPartialLen())
-		}
-
-		if depth >= len(prefix) {
-			nL := node.getNodeLeaf()
-			if nL != nil {
-				if bytes.Compare(nL.getKey(), i.path) >= 0 {
-					i.stack = append(i.stack, node)
-				}
-			} else {
-				i.stack = append(i.stack, node)
-			}
-			if parent != nil && parent.getNodeLeaf() != nil {
-				if bytes.Compare(parent.getNodeLeaf().getKey(), i.path) >= 0 {
-					i.stack = append(i.stack, parent.getNodeLeaf())
-				}
-			}
+		case -1:
+			// Everything below sorts before the key
 			return
 		}
+		depth += partialLen
 
-		idx := node.getLowerBoundCh(prefix[depth])
-
-		if idx == -1 && !i.seenMismatch {
+		// Every key below is the key or extends it
+		if depth >= len(key) {
+			i.stack = append(i.stack, node)
 			return
 		}
 
-		if i.seenMismatch && idx != -1 {
-			idx = 0
-		}
+		// The node's own leaf is a proper prefix of the key, so it sorts
+		// before it and only the children after the key's next byte follow
+		i.pushChildrenAfter(node, int(key[depth]))
+		node, _ = findChild(node, key[depth])
+		depth++
+	}
+}
 
-		if idx == -1 {
-			if node.getNodeLeaf() != nil {
-				if bytes.Compare(node.getNodeLeaf().getKey(), i.path) >= 0 {
-					i.stack = append(i.stack, node)
-				}
-			} else {
-				for itr := int(node.getNumChildren()) - 1; itr >= idx+1; itr-- {
-					nCh := node.getChild(itr)
-					nChL := nCh.getNodeLeaf()
-					if nChL == nil {
-						i.stack = append(i.stack, node.getChild(itr))
-					} else {
-						if bytes.Compare(nChL.key, i.path) >= 0 {
-							i.stack = append(i.stack, node.getChild(itr))
-						}
-					}
-				}
-			}
-			if parent.getNodeLeaf() != nil && bytes.Compare(parent.getNodeLeaf().getKey(), i.path) >= 0 {
-				i.stack = append(i.stack, parent.getNodeLeaf())
-			}
-			node = nil
-			return
-		}
+// SeekPrefixLowerBound is used to seek the iterator to the smallest key that
+// starts with prefix and is greater or equal to from. Iteration then continues
+// through the larger keys that start with prefix, which suits paging through
+// the keys of one namespace. A from that sorts before prefix starts at the
+// first key with the prefix.
+func (i *LowerBoundIterator[T]) SeekPrefixLowerBound(prefix, from []byte) {
+	if bytes.Compare(from, prefix) < 0 {
+		from = prefix
+	}
+	i.SeekLowerBound(from)
+	i.prefix = prefix
+	i.bounded = true
+}
 
-		if i.seenMismatch && parent != nil && parent.getNodeLeaf() != nil {
-			nL := node.getNodeLeaf()
-			addedNode := false
-			if nL != nil {
-				if bytes.Compare(nL.getKey(), i.path) >= 0 {
-					i.stack = append(i.stack, node)
-					addedNode = true
-				}
-			}
-			if !addedNode {
-				for itr := int(node.getNumChildren()) - 1; itr >= 0; itr-- {
-					if node.getChild(itr) != nil {
-						nCh := node.getChild(itr)
-						nChL := nCh.getNodeLeaf()
-						if nChL == nil {
-							i.stack = append(i.stack, node.getChild(itr))
-						} else {
-							if bytes.Compare(nChL.key, i.path) >= 0 {
-								i.stack = append(i.stack, node.getChild(itr))
-							}
-						}
-					}
-				}
-			}
-			if bytes.Compare(parent.getNodeLeaf().getKey(), i.path) >= 0 {
-				i.stack = append(i.stack, parent.getNodeLeaf())
+// pushChildrenAfter pushes the children of n whose key byte is greater than c
+// onto the stack, largest first so that they pop in order.
+func (i *LowerBoundIterator[T]) pushChildrenAfter(n Node[T], c int) {
+	switch n.getArtNodeType() {
+	case node4, node16:
+		for itr := int(n.getNumChildren()) - 1; itr >= 0 && int(n.getKeyAtIdx(itr)) > c; itr-- {
+			if ch := n.getChild(itr); ch != nil {
+				i.stack = append(i.stack, ch)
 			}
-			return
 		}
-
-		for itr := int(node.getNumChildren()) - 1; itr >= idx+1; itr-- {
-			if node.getChild(itr) != nil {
-				nCh := node.getChild(itr)
-				nChL := nCh.getNodeLeaf()
-				if nChL == nil {
-					i.stack = append(i.stack, node.getChild(itr))
-				} else {
-					if bytes.Compare(nChL.key, i.path) >= 0 {
-						i.stack = append(i.stack, node.getChild(itr))
-					}
+	case node48:
+		for itr := 255; itr > c; itr-- {
+			if idx := n.getKeyAtIdx(itr); idx != 0 {
+				if ch := n.getChild(int(idx - 1)); ch != nil {
+					i.stack = append(i.stack, ch)
 				}
 			}
 		}
-
-		if idx >= 0 && node.getKeyAtIdx(idx) != prefix[depth] {
-			i.seenMismatch = true
-		}
-
-		if idx == -1 {
-			return
+	case node256:
+		for itr := 255; itr > c; itr-- {
+			if ch := n.getChild(itr); ch != nil {
+				i.stack = append(i.stack, ch)
+			}
 		}
-
-		parent = node
-		// Move to the next level in the tree
-		node = node.getChild(idx)
-
-		depth++
-
 	}
-
 }
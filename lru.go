@@ -0,0 +1,121 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package adaptive
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// RadixTreeLRU is a radix tree holding at most a fixed number of keys. Once
+// an insert takes it past that, the key inserted longest ago is evicted, so
+// it works as a bounded cache that can still be searched by prefix. Updating
+// a key counts as inserting it again; lookups do not change the order. Like
+// RadixTree it is immutable, and every change returns a new tree.
+type RadixTreeLRU[T any] struct {
+	tree *RadixTree[lruEntry[T]]
+
+	// order maps the sequence number of each key's last insert, in big
+	// endian so that the oldest sorts first, to the key
+	order *RadixTree[[]byte]
+	next  uint64
+
+	capacity int
+}
+
+// lruEntry is a value along with the sequence number it was inserted at
+type lruEntry[T any] struct {
+	seq   uint64
+	value T
+}
+
+// NewRadixTreeLRU returns an empty tree holding at most capacity keys. It
+// panics if capacity is not positive.
+func NewRadixTreeLRU[T any](capacity int) *RadixTreeLRU[T] {
+	if capacity <= 0 {
+		panic("adaptive: capacity must be positive")
+	}
+	return &RadixTreeLRU[T]{
+		tree:     NewRadixTree[lruEntry[T]](),
+		order:    NewRadixTree[[]byte](),
+		capacity: capacity,
+	}
+}
+
+func seqKey(seq uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, seq)
+}
+
+// Insert adds or updates key, returning the new tree, the previous value and
+// whether there was one. If the tree was full and key is new, the key
+// inserted longest ago is evicted.
+func (l *RadixTreeLRU[T]) Insert(key []byte, value T) (*RadixTreeLRU[T], T, bool) {
+	txn := l.tree.Txn(false)
+	order := l.order.Txn(false)
+	old, existed := txn.Get(key)
+	if existed {
+		order.Delete(seqKey(old.seq))
+	}
+	txn.Insert(key, lruEntry[T]{l.next, value})
+	order.Insert(seqKey(l.next), bytes.Clone(key))
+	if txn.GetTree().Len() > l.capacity {
+		it := order.Root().Iterator()
+		seq, oldest, _ := it.Next()
+		order.Delete(seq)
+		txn.Delete(oldest)
+	}
+	nl := &RadixTreeLRU[T]{
+		tree:     txn.Commit(),
+		order:    order.Commit(),
+		next:     l.next + 1,
+		capacity: l.capacity,
+	}
+	return nl, old.value, existed
+}
+
+// Delete removes key, returning the new tree, the value it held and whether
+// it was there.
+func (l *RadixTreeLRU[T]) Delete(key []byte) (*RadixTreeLRU[T], T, bool) {
+	tree, old, ok := l.tree.Delete(key)
+	if !ok {
+		return l, old.value, false
+	}
+	order, _, _ := l.order.Delete(seqKey(old.seq))
+	return &RadixTreeLRU[T]{tree, order, l.next, l.capacity}, old.value, true
+}
+
+// Get returns the value for key and whether it is in the tree.
+func (l *RadixTreeLRU[T]) Get(key []byte) (T, bool) {
+	e, ok := l.tree.Get(key)
+	return e.value, ok
+}
+
+// Len returns the number of keys in the tree, which is at most Cap.
+func (l *RadixTreeLRU[T]) Len() int {
+	return l.tree.Len()
+}
+
+// Cap returns the number of keys the tree holds before it starts evicting.
+func (l *RadixTreeLRU[T]) Cap() int {
+	return l.capacity
+}
+
+// WalkPrefix walks the keys starting with prefix in order. fn returns true to
+// stop the walk, as with Walk.
+func (l *RadixTreeLRU[T]) WalkPrefix(prefix []byte, fn WalkFn[T]) {
+	it := l.tree.root.Iterator()
+	it.SeekPrefix(prefix)
+	for k, e, ok := it.Next(); ok; k, e, ok = it.Next() {
+		if fn(k, e.value) {
+			return
+		}
+	}
+}
+
+// LongestPrefix returns the longest key in the tree that is a prefix of k,
+// along with its value.
+func (l *RadixTreeLRU[T]) LongestPrefix(k []byte) ([]byte, T, bool) {
+	key, e, ok := l.tree.LongestPrefix(k)
+	return key, e.value, ok
+}
@@ -0,0 +1,93 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package adaptive
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRadixTreeLRU(t *testing.T) {
+	const capacity = 10
+	key := func(i int) []byte { return []byte(fmt.Sprintf("key/%02d", i)) }
+
+	l := NewRadixTreeLRU[int](capacity)
+	var full *RadixTreeLRU[int]
+	for i := 0; i < capacity+5; i++ {
+		l, _, _ = l.Insert(key(i), i)
+		require.Equal(t, min(i+1, capacity), l.Len())
+		if i == capacity-1 {
+			full = l
+		}
+	}
+
+	// Exactly the five oldest keys are gone
+	for i := 0; i < capacity+5; i++ {
+		v, ok := l.Get(key(i))
+		require.Equal(t, i >= 5, ok, "key %d", i)
+		if ok {
+			require.Equal(t, i, v)
+		}
+	}
+	// Earlier trees are untouched
+	require.Equal(t, capacity, full.Len())
+	_, ok := full.Get(key(0))
+	require.True(t, ok)
+
+	// Updating a key makes it the newest, so the next oldest goes instead
+	l, old, ok := l.Insert(key(5), 50)
+	require.True(t, ok)
+	require.Equal(t, 5, old)
+	require.Equal(t, capacity, l.Len())
+	l, _, _ = l.Insert(key(20), 20)
+	_, ok = l.Get(key(6))
+	require.False(t, ok)
+	v, ok := l.Get(key(5))
+	require.True(t, ok)
+	require.Equal(t, 50, v)
+
+	// A deleted key frees its place and leaves the order of the rest alone
+	l, old, ok = l.Delete(key(7))
+	require.True(t, ok)
+	require.Equal(t, 7, old)
+	require.Equal(t, capacity-1, l.Len())
+	same, _, ok := l.Delete(key(7))
+	require.False(t, ok)
+	require.Same(t, l, same)
+	l, _, _ = l.Insert(key(21), 21)
+	require.Equal(t, capacity, l.Len())
+	l, _, _ = l.Insert(key(22), 22)
+	_, ok = l.Get(key(8))
+	require.False(t, ok)
+
+	// Keys are searchable by prefix
+	var got []string
+	l.WalkPrefix([]byte("key/1"), func(k []byte, v int) bool {
+		got = append(got, string(k))
+		return false
+	})
+	require.Equal(t, []string{"key/10", "key/11", "key/12", "key/13", "key/14"}, got)
+	k, v, ok := l.LongestPrefix([]byte("key/20/x"))
+	require.True(t, ok)
+	require.Equal(t, "key/20", string(k))
+	require.Equal(t, 20, v)
+
+	require.Panics(t, func() { NewRadixTreeLRU[int](0) })
+}
+
+func TestRadixTreeLRU_CapacityOne(t *testing.T) {
+	l := NewRadixTreeLRU[string](1)
+	l, _, _ = l.Insert(nil, "empty")
+	l, _, _ = l.Insert([]byte("a"), "a")
+	require.Equal(t, 1, l.Len())
+	_, ok := l.Get(nil)
+	require.False(t, ok)
+	l, _, _ = l.Insert([]byte("a"), "b")
+	v, _ := l.Get([]byte("a"))
+	require.Equal(t, "b", v)
+	require.Equal(t, 1, l.Len())
+	require.Equal(t, 1, l.Cap())
+}
@@ -0,0 +1,115 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package adaptive
+
+import (
+	"bytes"
+	"container/heap"
+)
+
+// MergePolicy decides which value a MergeIterator yields for a key that is
+// stored in more than one of its trees.
+type MergePolicy int
+
+const (
+	// MergeFirstWins yields the value from the earliest tree given
+	MergeFirstWins MergePolicy = iota
+	// MergeLastWins yields the value from the latest tree given, as when the
+	// trees are layers with later ones overriding earlier ones
+	MergeLastWins
+)
+
+// MergeIterator iterates over the keys of several trees together, in order
+// and with every key yielded once, like iterating over the union of the
+// trees. It keeps the next key of every tree in a heap, so each step costs
+// a logarithm of the number of trees.
+type MergeIterator[T any] struct {
+	sources mergeHeap[T]
+	policy  MergePolicy
+}
+
+// mergeSource is the iterator for one tree and the tree's position in the
+// list given to NewMergeIterator.
+type mergeSource[T any] struct {
+	it  *Iterator[T]
+	idx int
+}
+
+// mergeHeap orders sources by their next key, and by position for equal keys
+type mergeHeap[T any] []*mergeSource[T]
+
+func (h mergeHeap[T]) Len() int { return len(h) }
+
+func (h mergeHeap[T]) Less(a, b int) bool {
+	if c := bytes.Compare(h[a].it.peekStoredKey(), h[b].it.peekStoredKey()); c != 0 {
+		return c < 0
+	}
+	return h[a].idx < h[b].idx
+}
+
+func (h mergeHeap[T]) Swap(a, b int) { h[a], h[b] = h[b], h[a] }
+
+func (h *mergeHeap[T]) Push(x any) { *h = append(*h, x.(*mergeSource[T])) }
+
+func (h *mergeHeap[T]) Pop() any {
+	old := *h
+	s := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return s
+}
+
+// NewMergeIterator returns a MergeIterator over the given trees, using policy
+// to pick the value for keys found in more than one of them.
+func NewMergeIterator[T any](policy MergePolicy, trees ...*RadixTree[T]) *MergeIterator[T] {
+	m := &MergeIterator[T]{policy: policy}
+	for idx, t := range trees {
+		if t == nil || t.Len() == 0 {
+			continue
+		}
+		it := t.Root().Iterator()
+		it.SeekPrefix(nil)
+		if _, _, ok := it.Peek(); ok {
+			m.sources = append(m.sources, &mergeSource[T]{it, idx})
+		}
+	}
+	heap.Init(&m.sources)
+	return m
+}
+
+// Next returns the next key in order and its value, or false once every tree
+// is exhausted.
+func (m *MergeIterator[T]) Next() ([]byte, T, bool) {
+	var zero T
+	if len(m.sources) == 0 {
+		return nil, zero, false
+	}
+
+	// Equal keys come off the heap in the order their trees were given, so
+	// the first one is kept for MergeFirstWins and the last for MergeLastWins.
+	key, val, _ := m.sources[0].it.Peek()
+	stored := m.sources[0].it.peekStoredKey()
+	m.advance()
+	for len(m.sources) > 0 {
+		_, v, _ := m.sources[0].it.Peek()
+		if !bytes.Equal(m.sources[0].it.peekStoredKey(), stored) {
+			break
+		}
+		if m.policy == MergeLastWins {
+			val = v
+		}
+		m.advance()
+	}
+	return key, val, true
+}
+
+// advance moves the source at the top of the heap past its current key
+func (m *MergeIterator[T]) advance() {
+	s := m.sources[0]
+	s.it.Next()
+	if _, _, ok := s.it.Peek(); ok {
+		heap.Fix(&m.sources, 0)
+	} else {
+		heap.Pop(&m.sources)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package adaptive
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeIterator(t *testing.T) {
+	layers := []map[string]int{
+		{"a": 0, "foo": 0, "foo/bar": 0, "zip": 0},
+		{"b": 1, "foo": 1, "foo/baz": 1, "zip": 1},
+		{"foo": 2, "foo/bar": 2, "zap": 2},
+	}
+	trees := make([]*RadixTree[int], len(layers))
+	for i, layer := range layers {
+		trees[i] = NewRadixTree[int]()
+		for k, v := range layer {
+			trees[i], _, _ = trees[i].Insert([]byte(k), v)
+		}
+	}
+
+	collect := func(m *MergeIterator[int]) []string {
+		var out []string
+		for k, v, ok := m.Next(); ok; k, v, ok = m.Next() {
+			out = append(out, fmt.Sprintf("%s=%d", k, v))
+		}
+		return out
+	}
+
+	first := collect(NewMergeIterator(MergeFirstWins, trees...))
+	require.Equal(t, []string{"a=0", "b=1", "foo=0", "foo/bar=0", "foo/baz=1", "zap=2", "zip=0"}, first)
+
+	last := collect(NewMergeIterator(MergeLastWins, trees...))
+	require.Equal(t, []string{"a=0", "b=1", "foo=2", "foo/bar=2", "foo/baz=1", "zap=2", "zip=1"}, last)
+
+	// Empty and missing trees contribute nothing
+	one := collect(NewMergeIterator(MergeFirstWins, NewRadixTree[int](), trees[2], nil))
+	require.Equal(t, []string{"foo=2", "foo/bar=2", "zap=2"}, one)
+	require.Empty(t, collect(NewMergeIterator[int](MergeFirstWins)))
+
+	// Larger overlapping trees merge into their sorted union
+	rnd := rand.New(rand.NewSource(1))
+	union := map[string]bool{}
+	for i := range trees {
+		trees[i] = NewRadixTree[int]()
+		for j := 0; j < 2000; j++ {
+			k := fmt.Sprintf("%x", rnd.Intn(5000))
+			trees[i], _, _ = trees[i].Insert([]byte(k), i)
+			union[k] = true
+		}
+	}
+	var want []string
+	for k := range union {
+		want = append(want, k)
+	}
+	sort.Strings(want)
+	var got []string
+	m := NewMergeIterator(MergeLastWins, trees...)
+	for k, _, ok := m.Next(); ok; k, _, ok = m.Next() {
+		got = append(got, string(k))
+	}
+	require.Equal(t, want, got)
+}
@@ -16,6 +16,10 @@ type Node[T any] interface {
 	isLeaf() bool
 	matchPrefix([]byte) bool
 	getChild(int) Node[T]
+	// Reference counts live on nodes that are shared between trees and
+	// transactions running on different goroutines, so they are only ever
+	// read and written atomically. processRefCount moves the pending lazy
+	// count onto the node and hands it down to the node's leaf and children.
 	incrementLazyRefCount(delta int64)
 	getRefCount() int64
 	processRefCount()
@@ -33,7 +37,6 @@ type Node[T any] interface {
 	getChildren() []Node[T]
 	getKeys() []byte
 	getMutateCh() chan struct{}
-	getLowerBoundCh(byte) int
 	getNodeLeaf() *NodeLeaf[T]
 	setNodeLeaf(*NodeLeaf[T])
 
@@ -41,4 +44,32 @@ type Node[T any] interface {
 	LowerBoundIterator() *LowerBoundIterator[T]
 	PathIterator([]byte) *PathIterator[T]
 	ReverseIterator() *ReverseIterator[T]
+
+	// Walk calls fn for every key stored in the subtree rooted at the node,
+	// in order, stopping early if fn returns true. Leaves store whole keys,
+	// so the keys passed to fn are complete. A node returned by SeekPrefix
+	// holds exactly the keys with that prefix, unless no key has it, in which
+	// case it is the deepest node along the prefix.
+	Walk(fn WalkFn[T])
+
+	// Size returns the number of keys stored in the subtree rooted at the
+	// node. It visits every one of them.
+	Size() int
+
+	// ChildAt returns the child of the node along the edge for byte c, and
+	// whether there is one. Together with Root it allows traversals that the
+	// iterators do not cover. Keys are stored with a terminator byte, but a
+	// key that ends at a node is held by that node as its own leaf rather
+	// than found below the edge for '$'.
+	ChildAt(c byte) (Node[T], bool)
+
+	// Fanout returns the number of ways the keys below the node branch: one
+	// for each child, plus one for a key that ends at the node itself.
+	Fanout() int
+
+	// Prefix returns the compressed prefix the node stores for the bytes
+	// its keys share below the edge into it. Only the first maxPrefixLen
+	// bytes are stored, so it is shorter than the shared run when that is
+	// longer. It must not be modified.
+	Prefix() []byte
 }
@@ -5,7 +5,6 @@ package adaptive
 
 import (
 	"bytes"
-	"sort"
 	"sync/atomic"
 )
 
@@ -69,10 +68,32 @@ func (n *Node16[T]) isLeaf() bool {
 // the given node to walk the tree
 func (n *Node16[T]) Iterator() *Iterator[T] {
 	return &Iterator[T]{
-		node: n,
+		node:  n,
+		stack: []Node[T]{n},
 	}
 }
 
+func (n *Node16[T]) Walk(fn WalkFn[T]) {
+	recursiveWalk[T](n, fn)
+}
+
+func (n *Node16[T]) Size() int {
+	return subtreeSize[T](n)
+}
+
+func (n *Node16[T]) Fanout() int {
+	return fanout[T](n)
+}
+
+func (n *Node16[T]) Prefix() []byte {
+	return nodePrefix[T](n)
+}
+
+func (n *Node16[T]) ChildAt(c byte) (Node[T], bool) {
+	ch, _ := findChild[T](n, c)
+	return ch, ch != nil
+}
+
 func (n *Node16[T]) PathIterator(path []byte) *PathIterator[T] {
 	nodeT := Node[T](n)
 	return &PathIterator[T]{
@@ -103,7 +124,7 @@ func (n *Node16[T]) clone(keepWatch, deep bool) Node[T] {
 	newPartial := make([]byte, maxPrefixLen)
 	if deep {
 		if n.getNodeLeaf() != nil {
-			newNode.setNodeLeaf(n.getNodeLeaf().clone(true, true).(*NodeLeaf[T]))
+			newNode.setNodeLeaf(n.getNodeLeaf().clone(keepWatch, true).(*NodeLeaf[T]))
 		}
 	} else {
 		newNode.setNodeLeaf(n.getNodeLeaf())
@@ -193,18 +214,6 @@ func (n *Node16[T]) setValue(T) {
 func (n *Node16[T]) setKey(key []byte) {
 }
 
-func (n *Node16[T]) getLowerBoundCh(c byte) int {
-	nCh := int(n.getNumChildren())
-	idx := sort.Search(nCh, func(i int) bool {
-		return n.keys[i] >= c
-	})
-	// we want lower bound behavior so return even if it's not an exact match
-	if idx < nCh {
-		return idx
-	}
-	return -1
-}
-
 func (n *Node16[T]) ReverseIterator() *ReverseIterator[T] {
 	return &ReverseIterator[T]{
 		i: &Iterator[T]{
@@ -236,22 +245,22 @@ func (n *Node16[T]) incrementLazyRefCount(inc int64) {
 }
 
 func (n *Node16[T]) processRefCount() {
-	if n.lazyRefCount == 0 {
+	lazy := atomic.SwapInt64(&n.lazyRefCount, 0)
+	if lazy == 0 {
 		return
 	}
-	n.refCount += n.lazyRefCount
+	atomic.AddInt64(&n.refCount, lazy)
 	if n.getNodeLeaf() != nil {
-		n.getNodeLeaf().incrementLazyRefCount(n.lazyRefCount)
+		n.getNodeLeaf().incrementLazyRefCount(lazy)
 	}
 	for _, child := range n.children {
 		if child != nil {
-			child.incrementLazyRefCount(n.lazyRefCount)
+			child.incrementLazyRefCount(lazy)
 		}
 	}
-	atomic.StoreInt64(&n.lazyRefCount, 0)
 }
 
 func (n *Node16[T]) getRefCount() int64 {
 	n.processRefCount()
-	return n.refCount
+	return atomic.LoadInt64(&n.refCount)
 }
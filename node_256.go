@@ -64,7 +64,8 @@ func (n *Node256[T]) setPartial(partial []byte) {
 }
 
 func (n *Node256[T]) isLeaf() bool {
-	if n.numChildren == 0 && n.getNodeLeaf() != nil {
+	// A full node wraps numChildren around to 0, but then every slot is set
+	if n.numChildren == 0 && n.children[0] == nil && n.getNodeLeaf() != nil {
 		return true
 	}
 	return false
@@ -74,10 +75,32 @@ func (n *Node256[T]) isLeaf() bool {
 // the given node to walk the tree
 func (n *Node256[T]) Iterator() *Iterator[T] {
 	return &Iterator[T]{
-		node: n,
+		node:  n,
+		stack: []Node[T]{n},
 	}
 }
 
+func (n *Node256[T]) Walk(fn WalkFn[T]) {
+	recursiveWalk[T](n, fn)
+}
+
+func (n *Node256[T]) Size() int {
+	return subtreeSize[T](n)
+}
+
+func (n *Node256[T]) Fanout() int {
+	return fanout[T](n)
+}
+
+func (n *Node256[T]) Prefix() []byte {
+	return nodePrefix[T](n)
+}
+
+func (n *Node256[T]) ChildAt(c byte) (Node[T], bool) {
+	ch, _ := findChild[T](n, c)
+	return ch, ch != nil
+}
+
 func (n *Node256[T]) PathIterator(path []byte) *PathIterator[T] {
 	nodeT := Node[T](n)
 	return &PathIterator[T]{node: &nodeT,
@@ -110,7 +133,7 @@ func (n *Node256[T]) clone(keepWatch, deep bool) Node[T] {
 	}
 	if deep {
 		if n.getNodeLeaf() != nil {
-			newNode.setNodeLeaf(n.getNodeLeaf().clone(true, true).(*NodeLeaf[T]))
+			newNode.setNodeLeaf(n.getNodeLeaf().clone(keepWatch, true).(*NodeLeaf[T]))
 		}
 	} else {
 		newNode.setNodeLeaf(n.getNodeLeaf())
@@ -192,15 +215,6 @@ func (n *Node256[T]) setValue(T) {
 func (n *Node256[T]) setKey(key []byte) {
 }
 
-func (n *Node256[T]) getLowerBoundCh(c byte) int {
-	for i := int(c); i < 256; i++ {
-		if n.getChild(i) != nil {
-			return i
-		}
-	}
-	return -1
-}
-
 func (n *Node256[T]) ReverseIterator() *ReverseIterator[T] {
 	return &ReverseIterator[T]{
 		i: &Iterator[T]{
@@ -233,22 +247,22 @@ func (n *Node256[T]) incrementLazyRefCount(inc int64) {
 }
 
 func (n *Node256[T]) processRefCount() {
-	if n.lazyRefCount == 0 {
+	lazy := atomic.SwapInt64(&n.lazyRefCount, 0)
+	if lazy == 0 {
 		return
 	}
-	n.refCount += n.lazyRefCount
+	atomic.AddInt64(&n.refCount, lazy)
 	if n.getNodeLeaf() != nil {
-		n.getNodeLeaf().incrementLazyRefCount(n.lazyRefCount)
+		n.getNodeLeaf().incrementLazyRefCount(lazy)
 	}
 	for _, child := range n.children {
 		if child != nil {
-			child.incrementLazyRefCount(n.lazyRefCount)
+			child.incrementLazyRefCount(lazy)
 		}
 	}
-	atomic.StoreInt64(&n.lazyRefCount, 0)
 }
 
 func (n *Node256[T]) getRefCount() int64 {
 	n.processRefCount()
-	return n.refCount
+	return atomic.LoadInt64(&n.refCount)
 }
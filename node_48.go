@@ -68,10 +68,32 @@ func (n *Node48[T]) isLeaf() bool {
 // the given node to walk the tree
 func (n *Node48[T]) Iterator() *Iterator[T] {
 	return &Iterator[T]{
-		node: n,
+		node:  n,
+		stack: []Node[T]{n},
 	}
 }
 
+func (n *Node48[T]) Walk(fn WalkFn[T]) {
+	recursiveWalk[T](n, fn)
+}
+
+func (n *Node48[T]) Size() int {
+	return subtreeSize[T](n)
+}
+
+func (n *Node48[T]) Fanout() int {
+	return fanout[T](n)
+}
+
+func (n *Node48[T]) Prefix() []byte {
+	return nodePrefix[T](n)
+}
+
+func (n *Node48[T]) ChildAt(c byte) (Node[T], bool) {
+	ch, _ := findChild[T](n, c)
+	return ch, ch != nil
+}
+
 func (n *Node48[T]) PathIterator(path []byte) *PathIterator[T] {
 	nodeT := Node[T](n)
 	return &PathIterator[T]{
@@ -111,7 +133,7 @@ func (n *Node48[T]) clone(keepWatch, deep bool) Node[T] {
 	newNode.setPartial(newPartial)
 	if deep {
 		if n.getNodeLeaf() != nil {
-			newNode.setNodeLeaf(n.getNodeLeaf().clone(true, true).(*NodeLeaf[T]))
+			newNode.setNodeLeaf(n.getNodeLeaf().clone(keepWatch, true).(*NodeLeaf[T]))
 		}
 	} else {
 		newNode.setNodeLeaf(n.getNodeLeaf())
@@ -201,15 +223,6 @@ func (n *Node48[T]) setValue(T) {
 func (n *Node48[T]) setKey(key []byte) {
 }
 
-func (n *Node48[T]) getLowerBoundCh(c byte) int {
-	for i := int(c); i < 256; i++ {
-		if n.getChild(int(n.keys[i])-1) != nil {
-			return int(n.keys[i] - 1)
-		}
-	}
-	return -1
-}
-
 func (n *Node48[T]) ReverseIterator() *ReverseIterator[T] {
 	nodeT := Node[T](n)
 	return &ReverseIterator[T]{
@@ -241,22 +254,22 @@ func (n *Node48[T]) incrementLazyRefCount(inc int64) {
 }
 
 func (n *Node48[T]) processRefCount() {
-	if n.lazyRefCount == 0 {
+	lazy := atomic.SwapInt64(&n.lazyRefCount, 0)
+	if lazy == 0 {
 		return
 	}
-	n.refCount += n.lazyRefCount
+	atomic.AddInt64(&n.refCount, lazy)
 	if n.getNodeLeaf() != nil {
-		n.getNodeLeaf().incrementLazyRefCount(n.lazyRefCount)
+		n.getNodeLeaf().incrementLazyRefCount(lazy)
 	}
 	for _, child := range n.children {
 		if child != nil {
-			child.incrementLazyRefCount(n.lazyRefCount)
+			child.incrementLazyRefCount(lazy)
 		}
 	}
-	atomic.StoreInt64(&n.lazyRefCount, 0)
 }
 
 func (n *Node48[T]) getRefCount() int64 {
 	n.processRefCount()
-	return n.refCount
+	return atomic.LoadInt64(&n.refCount)
 }
@@ -9,10 +9,17 @@ import (
 )
 
 type NodeLeaf[T any] struct {
-	id           uint64
-	value        T
-	key          []byte
-	mutateCh     atomic.Pointer[chan struct{}]
+	id       uint64
+	value    T
+	key      []byte
+	mutateCh atomic.Pointer[chan struct{}]
+
+	// origKey is the key as it was inserted, without its terminator, when
+	// the tree's KeyTransform changed it
+	origKey []byte
+
+	// fingerprint is the keyFingerprint of key, or 0 if it was not stored
+	fingerprint  uint64
 	lazyRefCount int64
 	refCount     int64
 }
@@ -74,6 +81,14 @@ func (n *NodeLeaf[T]) setKey(key []byte) {
 	n.key = key
 }
 
+// userKey returns the key as the caller inserted it, without its terminator.
+func (n *NodeLeaf[T]) userKey() []byte {
+	if n.origKey != nil {
+		return n.origKey[:len(n.origKey):len(n.origKey)]
+	}
+	return getKey(n.key)
+}
+
 func (n *NodeLeaf[T]) getPartial() []byte {
 	//no-op
 	return []byte{}
@@ -97,10 +112,31 @@ func (l *NodeLeaf[T]) prefixContainsMatch(key []byte) bool {
 func (n *NodeLeaf[T]) Iterator() *Iterator[T] {
 	nodeT := Node[T](n)
 	return &Iterator[T]{
-		node: nodeT,
+		node:  nodeT,
+		stack: []Node[T]{nodeT},
 	}
 }
 
+func (n *NodeLeaf[T]) Walk(fn WalkFn[T]) {
+	recursiveWalk[T](n, fn)
+}
+
+func (n *NodeLeaf[T]) Size() int {
+	return subtreeSize[T](n)
+}
+
+func (n *NodeLeaf[T]) Fanout() int {
+	return fanout[T](n)
+}
+
+func (n *NodeLeaf[T]) Prefix() []byte {
+	return nodePrefix[T](n)
+}
+
+func (n *NodeLeaf[T]) ChildAt(c byte) (Node[T], bool) {
+	return nil, false
+}
+
 func (n *NodeLeaf[T]) PathIterator(path []byte) *PathIterator[T] {
 	nodeT := Node[T](n)
 	return &PathIterator[T]{node: &nodeT,
@@ -123,9 +159,11 @@ func (n *NodeLeaf[T]) getChild(index int) Node[T] {
 func (n *NodeLeaf[T]) clone(keepWatch, deep bool) Node[T] {
 	n.processRefCount()
 	newNode := &NodeLeaf[T]{
-		key:      make([]byte, len(n.getKey())),
-		value:    n.getValue(),
-		refCount: n.getRefCount(),
+		key:         make([]byte, len(n.getKey())),
+		value:       n.getValue(),
+		refCount:    n.getRefCount(),
+		fingerprint: n.fingerprint,
+		origKey:     n.origKey,
 	}
 	if keepWatch {
 		newNode.setMutateCh(n.getMutateCh())
@@ -175,10 +213,6 @@ func (n *NodeLeaf[T]) getMutateCh() chan struct{} {
 	return *n.mutateCh.Load()
 }
 
-func (n *NodeLeaf[T]) getLowerBoundCh(c byte) int {
-	return -1
-}
-
 func (n *NodeLeaf[T]) ReverseIterator() *ReverseIterator[T] {
 	return &ReverseIterator[T]{
 		i: &Iterator[T]{
@@ -210,11 +244,10 @@ func (n *NodeLeaf[T]) incrementLazyRefCount(inc int64) {
 }
 
 func (n *NodeLeaf[T]) processRefCount() {
-	n.refCount += n.lazyRefCount
-	atomic.StoreInt64(&n.lazyRefCount, 0)
+	atomic.AddInt64(&n.refCount, atomic.SwapInt64(&n.lazyRefCount, 0))
 }
 
 func (n *NodeLeaf[T]) getRefCount() int64 {
 	n.processRefCount()
-	return n.refCount
+	return atomic.LoadInt64(&n.refCount)
 }
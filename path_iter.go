@@ -31,7 +31,7 @@ func (i *PathIterator[T]) Next() ([]byte, T, bool) {
 		case leafType:
 			leafCh := currentNode.(*NodeLeaf[T])
 			if leafCh.prefixContainsMatch(i.path) {
-				return getKey(leafCh.key), leafCh.value, true
+				return leafCh.userKey(), leafCh.value, true
 			}
 			continue
 		case node4:
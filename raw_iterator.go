@@ -0,0 +1,99 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package adaptive
+
+// RawIterator visits every node in a tree in pre-order, including the
+// internal nodes that Iterator skips over. Along with each node it tracks the
+// node's effective path, which is the key prefix shared by everything stored
+// below it. This is meant for tree analysis and testing rather than for
+// reading keys and values.
+type RawIterator[T any] struct {
+	stack []rawFrame[T]
+	pos   Node[T]
+	path  []byte
+}
+
+// rawFrame is a node waiting to be visited along with the number of key
+// bytes consumed on the way to it, not counting its own prefix.
+type rawFrame[T any] struct {
+	node  Node[T]
+	depth int
+}
+
+// RawIterator returns a RawIterator positioned before the root of the tree.
+// Next must be called to move it onto the root.
+func (t *RadixTree[T]) RawIterator() *RawIterator[T] {
+	return &RawIterator[T]{
+		stack: []rawFrame[T]{{node: t.root}},
+	}
+}
+
+// Front returns the current node that has been iterated to, or nil once the
+// iteration is finished.
+func (i *RawIterator[T]) Front() Node[T] {
+	return i.pos
+}
+
+// Path returns the effective path of the current node. For a leaf this is
+// its full key.
+func (i *RawIterator[T]) Path() string {
+	return string(i.path)
+}
+
+// Next moves the iterator to the next node.
+func (i *RawIterator[T]) Next() {
+	if len(i.stack) == 0 {
+		i.pos, i.path = nil, nil
+		return
+	}
+	f := i.stack[len(i.stack)-1]
+	i.stack = i.stack[:len(i.stack)-1]
+	n := f.node
+	i.pos = n
+
+	if n.getArtNodeType() == leafType {
+		i.path = getKey(n.getKey())
+		return
+	}
+
+	// Partial prefixes are truncated to maxPrefixLen, so take the path from a
+	// leaf below instead, which carries the full key.
+	depth := f.depth + int(n.getPartialLen())
+	i.path = nil
+	if l := minimum[T](n); l != nil {
+		key := l.getKey()
+		if depth >= len(key) {
+			i.path = getKey(key)
+		} else {
+			i.path = key[:depth]
+		}
+	}
+
+	// Push the children in reverse key order so they pop in key order
+	switch n.getArtNodeType() {
+	case node48:
+		for c := 255; c >= 0; c-- {
+			idx := n.getKeyAtIdx(c)
+			if idx == 0 {
+				continue
+			}
+			if ch := n.getChild(int(idx - 1)); ch != nil {
+				i.stack = append(i.stack, rawFrame[T]{ch, depth + 1})
+			}
+		}
+	default:
+		children := n.getChildren()
+		for c := len(children) - 1; c >= 0; c-- {
+			if children[c] != nil {
+				i.stack = append(i.stack, rawFrame[T]{children[c], depth + 1})
+			}
+		}
+	}
+
+	// The leaf stored at this node sorts before all of the children. The
+	// empty root carries a leaf with no key, which is not a stored key.
+	if l := n.getNodeLeaf(); l != nil && len(l.getKey()) > 0 {
+		i.stack = append(i.stack, rawFrame[T]{l, depth})
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package adaptive
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRawIterator(t *testing.T) {
+	r := NewRadixTree[int]()
+	keys := []string{
+		"foo",
+		"foo/bar",
+		"foo/bar/baz",
+		"foo/baz/bar",
+		"foo/zip/zap",
+		"foobar",
+		"zipzap",
+		// Binary keys, including the sentinel byte and a shared prefix
+		// longer than the stored partial.
+		"a$b",
+		"a$c",
+		"\x00\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0a\x0b\x0c\xff",
+		"\x00\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0a\x0b\x0c\xfe",
+	}
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+	sort.Strings(keys)
+
+	var leaves []string
+	visited := 0
+	it := r.RawIterator()
+	for it.Next(); it.Front() != nil; it.Next() {
+		visited++
+		n := it.Front()
+		if n.getArtNodeType() == leafType {
+			require.Equal(t, string(getKey(n.getKey())), it.Path())
+			leaves = append(leaves, it.Path())
+			continue
+		}
+
+		// Every key stored below an internal node starts with its path
+		inner := n.Iterator()
+		for k, _, ok := inner.Next(); ok; k, _, ok = inner.Next() {
+			require.True(t, strings.HasPrefix(string(k), it.Path()), "key %q path %q", k, it.Path())
+		}
+	}
+	require.Equal(t, keys, leaves)
+	require.Greater(t, visited, r.Len())
+
+	it = NewRadixTree[int]().RawIterator()
+	it.Next()
+	require.NotNil(t, it.Front())
+	require.Equal(t, "", it.Path())
+	it.Next()
+	require.Nil(t, it.Front())
+}
+
+func TestRawIterator_Node48Paths(t *testing.T) {
+	// Node48 finds its children through an index, so its edge bytes are
+	// spread out here to tell them apart from the slots they are stored in
+	r := NewRadixTree[int]()
+	r, _, _ = r.Insert([]byte("p"), 0)
+	var edges []byte
+	for i := 0; i < 20; i++ {
+		c := byte(250 - 12*i)
+		edges = append(edges, c)
+		r, _, _ = r.Insert([]byte{'p', c, 'x'}, i)
+	}
+	r, _, _ = r.Insert([]byte("p\x16yz"), 0)
+	r, _, _ = r.Insert([]byte("p\x16yw"), 0)
+	sort.Slice(edges, func(i, j int) bool { return edges[i] < edges[j] })
+
+	want := []string{"node48 p", "leaf p"}
+	for _, c := range edges {
+		k := string([]byte{'p', c, 'x'})
+		if c == '\x16' {
+			want = append(want, "node4 p\x16",
+				"node4 p\x16x", "leaf p\x16x",
+				"node4 p\x16y",
+				"node4 p\x16yw", "leaf p\x16yw",
+				"node4 p\x16yz", "leaf p\x16yz")
+			continue
+		}
+		want = append(want, "node4 "+k, "leaf "+k)
+	}
+
+	var got []string
+	it := r.RawIterator()
+	for it.Next(); it.Front() != nil; it.Next() {
+		got = append(got, NodeTypeName(it.Front())+" "+it.Path())
+	}
+	require.Equal(t, want, got)
+}
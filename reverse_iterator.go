@@ -18,17 +18,48 @@ type ReverseIterator[T any] struct {
 	// We use this to track whether we have already ensured all the children are
 	// in the stack.
 	expandedParents map[Node[T]]struct{}
+
+	// lowerBound is the exclusive lower end of the window set by
+	// SeekReverseRange. Once a key at or below it is reached every key left
+	// in the stack is too, so iteration stops there.
+	lowerBound []byte
+	bounded    bool
 }
 
 // SeekPrefixWatch is used to seek the iterator to a given prefix
 // and returns the watch channel of the finest granularity
 func (ri *ReverseIterator[T]) SeekPrefixWatch(prefix []byte) (watch <-chan struct{}) {
-	return ri.i.SeekPrefixWatch(prefix)
+	ri.seekPrefix(prefix)
+	return ri.i.node.getMutateCh()
 }
 
 // SeekPrefix is used to seek the iterator to a given prefix
 func (ri *ReverseIterator[T]) SeekPrefix(prefix []byte) {
-	ri.i.SeekPrefixWatch(prefix)
+	ri.seekPrefix(prefix)
+}
+
+// SeekPrefixExists seeks the iterator to a given prefix and returns whether
+// any key starts with it
+func (ri *ReverseIterator[T]) SeekPrefixExists(prefix []byte) bool {
+	return ri.seekPrefix(prefix)
+}
+
+// seekPrefix leaves the iterator on the node holding exactly the keys with
+// prefix, and reports whether there are any. That subtree is then walked in
+// full, so the path is cleared rather than treated as an upper bound. When no
+// key matches the node found is only the closest one, so nothing is left to
+// iterate.
+func (ri *ReverseIterator[T]) seekPrefix(prefix []byte) bool {
+	found := ri.i.SeekPrefixExists(prefix)
+	ri.i.path = nil
+	ri.expandedParents = nil
+	ri.bounded = false
+	if !found {
+		// An empty but non-nil stack keeps previous from starting over at
+		// the node, which SeekPrefixWatch still needs for its channel
+		ri.i.stack = []Node[T]{}
+	}
+	return found
 }
 
 // SeekReverseLowerBound is used to seek the iterator to the largest key that is
@@ -42,151 +73,125 @@ func (ri *ReverseIterator[T]) SeekReverseLowerBound(key []byte) {
 	// node should both be nil to prevent the iterator from assuming it is just
 	// iterating the whole tree from the root node. Either way this needs to end
 	// up as nil so just set it here.
-	ri.i.seenMismatch = false
 	ri.i.stack = make([]Node[T], 0)
 	n := ri.i.node
 	ri.i.node = nil
-	prefix := getTreeKey(key)
-	ri.i.path = prefix
+	ri.i.path = getTreeKey(key)
 	depth := 0
 
-	if ri.expandedParents == nil {
-		ri.expandedParents = make(map[Node[T]]struct{})
-	}
-
-	found := func(n Node[T]) {
-		ri.i.stack = append(
-			ri.i.stack,
-			n,
-		)
-	}
-
-	for {
-		if n == nil {
-			break
-		}
-		// Compare current prefix with the search key's same-length prefix.
-		var prefixCmp int
-		if int(n.getPartialLen()) < len(prefix) {
-			prefixCmp = bytes.Compare(n.getPartial()[:n.getPartialLen()], prefix[depth:depth+int(n.getPartialLen())])
-		} else {
-			prefixCmp = bytes.Compare(n.getPartial()[:n.getPartialLen()], prefix[depth:])
-		}
-
-		if prefixCmp < 0 {
-			// Prefix is smaller than search prefix, that means there is no exact
-			// match for the search key. But we are looking in reverse, so the reverse
-			// lower bound will be the largest leaf under this subtree, since it is
-			// the value that would come right before the current search key if it
-			// were in the tree. So we need to follow the maximum path in this subtree
-			// to find it. Note that this is exactly what the iterator will already do
-			// if it finds a node in the stack that has _not_ been marked as expanded
-			// so in this one case we don't call `found` and instead let the iterator
-			// do the expansion and recursion through all the children.
-			ri.i.stack = append(ri.i.stack, n)
-			return
-		}
-
-		if prefixCmp > 0 && !ri.i.seenMismatch {
-			// Prefix is larger than search prefix, or there is no prefix but we've
-			// also exhausted the search key. Either way, that means there is no
-			// reverse lower bound since nothing comes before our current search
-			// prefix.
-			if n.getNodeLeaf() != nil {
-				ri.i.stack = append(ri.i.stack, n.getNodeLeaf())
+	// Nodes marked by an earlier seek would not be expanded again
+	ri.expandedParents = make(map[Node[T]]struct{})
+
+	// Walk down the path of the search key, comparing keys without their
+	// terminators as SeekLowerBound does. Every subtree to the left of the
+	// path holds only smaller keys, so it is pushed whole, smallest first, so
+	// that the largest candidates are on top of the stack.
+	for n != nil {
+		// A node holding just a leaf either sorts at or before the key or not
+		if n.getArtNodeType() == leafType || n.isLeaf() {
+			l := n.getNodeLeaf()
+			if n.getArtNodeType() == leafType {
+				l = n.(*NodeLeaf[T])
 			}
-			return
-		}
-
-		// If this is a leaf, something needs to happen! Note that if it's a leaf
-		// and prefixCmp was zero (which it must be to get here) then the leaf value
-		// is either an exact match for the search, or it's lower. It can't be
-		// greater.
-		if n.isLeaf() {
-
-			nL := n.getNodeLeaf()
-			// Firstly, if it's an exact match, we're done!
-			if bytes.Equal(getKey(nL.getKey()), key) {
-				found(n)
-				return
-			}
-
-			// It's not so this node's leaf value must be lower and could still be a
-			// valid contender for reverse lower bound.
-
-			// If it has no children then we are also done.
-			if bytes.Compare(getKey(nL.getKey()), key) <= 0 {
-				// This leaf is the lower bound.
-				found(n)
-				return
+			if len(l.getKey()) > 0 && bytes.Compare(getKey(l.getKey()), key) <= 0 {
+				ri.i.stack = append(ri.i.stack, l)
 			}
+			return
 		}
 
-		// Consume the search prefix. Note that this is safe because if n.prefix is
-		// longer than the search slice prefixCmp would have been > 0 above and the
-		// method would have already returned.
-		// Determine the child index to proceed based on the next byte of the prefix
-		if n.getPartialLen() > 0 {
-			// If the node has a prefix, compare it with the prefix
-			mismatchIdx := prefixMismatch[T](n, prefix, len(prefix), depth)
-			if mismatchIdx < int(n.getPartialLen()) && !ri.i.seenMismatch {
-				// If there's a mismatch, set the node to nil to break the loop
-				if n.getNodeLeaf() != nil {
-					ri.i.stack = append(ri.i.stack, n.getNodeLeaf())
-				}
-				n = nil
-				return
+		// Compare current prefix with the search key's same-length prefix. Only
+		// the first maxPrefixLen bytes are stored on the node, so a longer
+		// prefix is read from a leaf below it instead.
+		partialLen := int(n.getPartialLen())
+		nodePrefix := n.getPartial()[:min(maxPrefixLen, partialLen)]
+		if partialLen > maxPrefixLen {
+			if l := minimum[T](n); l != nil && len(l.key) >= depth+partialLen {
+				nodePrefix = l.key[depth : depth+partialLen]
 			}
-			if mismatchIdx > 0 {
-				ri.i.seenMismatch = true
-			}
-			depth += int(n.getPartialLen())
 		}
-
-		if depth >= len(prefix) {
+		switch bytes.Compare(nodePrefix, key[depth:min(depth+partialLen, len(key))]) {
+		case -1:
+			// Everything below sorts before the key. The iterator expands
+			// nodes it has not seen, following the maximum path first.
 			ri.i.stack = append(ri.i.stack, n)
 			return
+		case 1:
+			// Everything below sorts after the key
+			return
 		}
+		depth += partialLen
 
-		if n.getNodeLeaf() != nil {
+		// The node's own leaf sorts before all of its children. Leave the node
+		// on the stack marked as expanded so that only the leaf comes out of it.
+		if l := n.getNodeLeaf(); l != nil && len(l.getKey()) > 0 && bytes.Compare(getKey(l.getKey()), key) <= 0 {
 			ri.i.stack = append(ri.i.stack, n)
+			ri.expandedParents[n] = struct{}{}
 		}
 
-		idx := n.getLowerBoundCh(prefix[depth])
-
-		if idx == -1 || depth == len(prefix)-1 {
-			idx = int(n.getNumChildren()) - 1
-		}
-
-		if idx >= 0 && n.getKeyAtIdx(idx) != prefix[depth] {
-			ri.i.seenMismatch = true
+		// Every key below extends the key and sorts after it
+		if depth >= len(key) {
+			return
 		}
+		ri.pushChildrenBefore(n, key[depth])
+		n, _ = findChild(n, key[depth])
+		depth++
+	}
+}
 
-		if ri.i.seenMismatch {
-			idx = int(n.getNumChildren()) - 1
+// pushChildrenBefore pushes the children of n whose key byte is less than c
+// onto the stack, smallest first so that they pop in reverse order.
+func (ri *ReverseIterator[T]) pushChildrenBefore(n Node[T], c byte) {
+	switch n.getArtNodeType() {
+	case node4, node16:
+		for itr := 0; itr < int(n.getNumChildren()) && n.getKeyAtIdx(itr) < c; itr++ {
+			if ch := n.getChild(itr); ch != nil {
+				ri.i.stack = append(ri.i.stack, ch)
+			}
 		}
-
-		for itr := 0; itr < idx; itr++ {
-			if n.getChild(itr) != nil {
-				ri.i.stack = append(ri.i.stack, n.getChild(itr))
+	case node48:
+		for itr := 0; itr < int(c); itr++ {
+			if idx := n.getKeyAtIdx(itr); idx != 0 {
+				if ch := n.getChild(int(idx - 1)); ch != nil {
+					ri.i.stack = append(ri.i.stack, ch)
+				}
 			}
 		}
-
-		if idx == -1 {
-			break
+	case node256:
+		for itr := 0; itr < int(c); itr++ {
+			if ch := n.getChild(itr); ch != nil {
+				ri.i.stack = append(ri.i.stack, ch)
+			}
 		}
-
-		// Move to the next level in the tree
-		ri.expandedParents[n] = struct{}{}
-		n = n.getChild(idx)
-		depth++
 	}
+}
 
+// SeekReverseRange is used to seek the iterator to the largest key that is
+// lower or equal to hi, and to bound it so that Previous stops before the
+// first key that is lower or equal to lo. The iterator then yields the keys in
+// (lo, hi] in descending order.
+func (ri *ReverseIterator[T]) SeekReverseRange(lo, hi []byte) {
+	ri.lowerBound = lo
+	ri.bounded = true
+	ri.SeekReverseLowerBound(hi)
 }
 
 // Previous returns the previous node in reverse order
 func (ri *ReverseIterator[T]) Previous() ([]byte, T, bool) {
+	key, value, ok := ri.previous()
+	if ok && ri.bounded && bytes.Compare(getKey(ri.i.rawKey), ri.lowerBound) <= 0 {
+		// Everything still in the stack sorts below this key, so drop it
+		// rather than walking subtrees that are outside the window.
+		var zero T
+		ri.i.stack = nil
+		ri.i.node = nil
+		return nil, zero, false
+	}
+	return key, value, ok
+}
+
+func (ri *ReverseIterator[T]) previous() ([]byte, T, bool) {
 	var zero T
+	ri.i.rawKey = nil
 
 	if ri.expandedParents == nil {
 		ri.expandedParents = make(map[Node[T]]struct{})
@@ -208,14 +213,20 @@ func (ri *ReverseIterator[T]) Previous() ([]byte, T, bool) {
 		switch node.(type) {
 		case *NodeLeaf[T]:
 			leafCh := node.(*NodeLeaf[T])
-			if bytes.Compare(getKey(leafCh.key), getKey(ri.i.path)) <= 0 {
-				return getKey(leafCh.key), leafCh.value, true
+			// The empty root carries a leaf with no key, which is not a stored key
+			if len(leafCh.key) == 0 {
+				continue
+			}
+			if len(ri.i.path) == 0 || bytes.Compare(getKey(leafCh.key), getKey(ri.i.path)) <= 0 {
+				return ri.i.emit(leafCh)
 			}
 			continue
 		case *Node4[T]:
 			n4 := node.(*Node4[T])
+			// Without a path the leaf is pushed below the children so it comes
+			// out after every key it is a prefix of.
 			if n4.leaf != nil {
-				if bytes.Compare(n4.leaf.key, ri.i.path) <= 0 || len(ri.i.path) == 0 {
+				if len(ri.i.path) == 0 || bytes.Compare(getKey(n4.leaf.key), getKey(ri.i.path)) <= 0 {
 					ri.i.stack = append(ri.i.stack, n4.leaf)
 				}
 			}
@@ -226,13 +237,13 @@ func (ri *ReverseIterator[T]) Previous() ([]byte, T, bool) {
 			for itr := 0; itr < int(n4.numChildren); itr++ {
 				ri.i.stack = append(ri.i.stack, n4.children[itr])
 			}
-			if n4.leaf != nil && hasPrefix(getKey(n4.leaf.key), ri.i.path) {
-				return getKey(n4.leaf.key), n4.leaf.value, true
+			if n4.leaf != nil && len(ri.i.path) > 0 && hasPrefix(getKey(n4.leaf.key), ri.i.path) {
+				return ri.i.emit(n4.leaf)
 			}
 		case *Node16[T]:
 			n16 := node.(*Node16[T])
 			if n16.leaf != nil {
-				if bytes.Compare(n16.leaf.key, ri.i.path) <= 0 || len(ri.i.path) == 0 {
+				if len(ri.i.path) == 0 || bytes.Compare(getKey(n16.leaf.key), getKey(ri.i.path)) <= 0 {
 					ri.i.stack = append(ri.i.stack, n16.leaf)
 				}
 			}
@@ -243,13 +254,13 @@ func (ri *ReverseIterator[T]) Previous() ([]byte, T, bool) {
 			for itr := 0; itr < int(n16.numChildren); itr++ {
 				ri.i.stack = append(ri.i.stack, n16.children[itr])
 			}
-			if n16.leaf != nil && hasPrefix(getKey(n16.leaf.key), ri.i.path) {
-				return getKey(n16.leaf.key), n16.leaf.value, true
+			if n16.leaf != nil && len(ri.i.path) > 0 && hasPrefix(getKey(n16.leaf.key), ri.i.path) {
+				return ri.i.emit(n16.leaf)
 			}
 		case *Node48[T]:
 			n48 := node.(*Node48[T])
 			if n48.leaf != nil {
-				if bytes.Compare(n48.leaf.key, ri.i.path) <= 0 || len(ri.i.path) == 0 {
+				if len(ri.i.path) == 0 || bytes.Compare(getKey(n48.leaf.key), getKey(ri.i.path)) <= 0 {
 					ri.i.stack = append(ri.i.stack, n48.leaf)
 				}
 			}
@@ -268,13 +279,13 @@ func (ri *ReverseIterator[T]) Previous() ([]byte, T, bool) {
 				}
 				ri.i.stack = append(ri.i.stack, nodeCh)
 			}
-			if n48.leaf != nil && hasPrefix(getKey(n48.leaf.key), ri.i.path) {
-				return getKey(n48.leaf.key), n48.leaf.value, true
+			if n48.leaf != nil && len(ri.i.path) > 0 && hasPrefix(getKey(n48.leaf.key), ri.i.path) {
+				return ri.i.emit(n48.leaf)
 			}
 		case *Node256[T]:
 			n256 := node.(*Node256[T])
 			if n256.leaf != nil {
-				if bytes.Compare(n256.leaf.key, ri.i.path) <= 0 || len(ri.i.path) == 0 {
+				if len(ri.i.path) == 0 || bytes.Compare(getKey(n256.leaf.key), getKey(ri.i.path)) <= 0 {
 					ri.i.stack = append(ri.i.stack, n256.leaf)
 				}
 			}
@@ -289,8 +300,8 @@ func (ri *ReverseIterator[T]) Previous() ([]byte, T, bool) {
 				}
 				ri.i.stack = append(ri.i.stack, nodeCh)
 			}
-			if n256.leaf != nil && hasPrefix(getKey(n256.leaf.key), ri.i.path) {
-				return getKey(n256.leaf.key), n256.leaf.value, true
+			if n256.leaf != nil && len(ri.i.path) > 0 && hasPrefix(getKey(n256.leaf.key), ri.i.path) {
+				return ri.i.emit(n256.leaf)
 			}
 		}
 	}
@@ -2,6 +2,8 @@ package adaptive
 
 import (
 	"fmt"
+	"math/rand"
+	"reflect"
 	"sort"
 	"testing"
 	"testing/quick"
@@ -69,6 +71,55 @@ func TestReverseIterator_SeekReverseLowerBoundFuzz(t *testing.T) {
 	}
 }
 
+// longPrefixString generates keys that share prefixes longer than
+// maxPrefixLen, so seeks have to compare against partials that are not fully
+// stored on the node.
+type longPrefixString string
+
+func (s longPrefixString) Generate(rand *rand.Rand, size int) reflect.Value {
+	prefixes := []string{"", "foo", "foofoofoof", "foofoofoofoo", "foofoofoofoofoo", "foofoofoofoofoofoofoofoo"}
+	b := []byte(prefixes[rand.Intn(len(prefixes))])
+	for i := rand.Intn(4); i > 0; i-- {
+		b = append(b, "\x00!$ab0"[rand.Intn(6)])
+	}
+	return reflect.ValueOf(longPrefixString(b))
+}
+
+func TestReverseIterator_SeekReverseLowerBoundLongPrefixFuzz(t *testing.T) {
+	r := NewRadixTree[any]()
+	set := make(map[string]struct{})
+
+	radixAddAndScan := func(newKey, searchKey longPrefixString) []string {
+		r, _, _ = r.Insert([]byte(newKey), nil)
+
+		it := r.Root().ReverseIterator()
+		it.SeekReverseLowerBound([]byte(searchKey))
+		result := []string{}
+		for key, _, ok := it.Previous(); ok; key, _, ok = it.Previous() {
+			result = append(result, string(key))
+		}
+		return result
+	}
+
+	sliceAddSortAndFilter := func(newKey, searchKey longPrefixString) []string {
+		set[string(newKey)] = struct{}{}
+		result := []string{}
+		for k := range set {
+			if k <= string(searchKey) {
+				result = append(result, k)
+			}
+		}
+		sort.Sort(sort.Reverse(sort.StringSlice(result)))
+		return result
+	}
+
+	if err := quick.CheckEqual(radixAddAndScan, sliceAddSortAndFilter, &quick.Config{
+		MaxCount: 1000,
+	}); err != nil {
+		t.Error(err)
+	}
+}
+
 func TestReverseIterator_SeekLowerBound(t *testing.T) {
 
 	// these should be defined in order
@@ -298,6 +349,36 @@ func TestReverseIterator_SeekLowerBound(t *testing.T) {
 			"gga",
 			[]string{"gada", "gab", "fgg", "fgcggg", "fgcdef", "fccbfc", "fbefb", "facccdc", "egd", "egba", "efacgg", "edbaa", "ecccfd", "eaaddb", "e", "defccd", "decb", "de", "ddebeeg", "d", "cf", "ceegb", "cdd", "ccbeec", "cbddbf", "cafae", "c", "bg", "bfgccg", "bffeea", "bcgefa", "bcdg", "bcccea", "b", "ag", "acbb", "abcggbg", "ab", "aaafbb", "a", ""},
 		},
+
+		// Found by fuzzing keys that share a prefix longer than maxPrefixLen.
+		// Only the first maxPrefixLen bytes of a prefix are stored on the node,
+		// and comparing the rest used to slice past them and panic.
+		{
+			[]string{"foofoofoofoo000", "foofoofoofoofoo0b", "foofoofoofoofoofoofoofoo", "foofoofoofoofoofoofoofoo0", "foofoofoofoofoofoofoofoo00b", "foofoofoofoofoofoofoofooa0b"},
+			"foofoofoofoofoobbba",
+			[]string{"foofoofoofoofoo0b", "foofoofoofoo000"},
+		},
+		{
+			[]string{"", "0b", "foo0", "foo0bb", "fooa", "foofoofoof", "foofoofoofoofoofoofoofoo", "foofoofoofoofoofoofoofooa"},
+			"foofoofoofoofoob",
+			[]string{"foofoofoof", "fooa", "foo0bb", "foo0", "0b", ""},
+		},
+		{
+			[]string{"foofoofoofoo", "foofoofoofooa0b", "foofoofoofoofoobaa", "foofoofoofoofoobb0b"},
+			"a",
+			[]string{},
+		},
+		// The search key ends exactly on the boundary of a long prefix.
+		{
+			[]string{"foofoofoofoofoo0", "foofoofoofoofoo1", "foofoofoof"},
+			"foofoofoofoofoo",
+			[]string{"foofoofoof"},
+		},
+		{
+			[]string{"foofoofoofoofoo0", "foofoofoofoofoo1", "foofoofoof"},
+			"foofoofoofoofoo0",
+			[]string{"foofoofoofoofoo0", "foofoofoof"},
+		},
 		{
 			[]string{"aagcfgc", "acbcdca", "aceeaca", "ad", "aefab", "afdcec", "b", "badcf", "bbag", "bccdegd", "cafg", "cbb", "ccaagef", "daae", "dabdbb", "dbbgb", "dbcaca", "fbeaab", "ffeec", "fg", "ga", "gbc", "gdcg", "gec", "gecga", "gfa", "gfad"},
 			"gg",
@@ -369,17 +450,16 @@ func TestReverseIterator_SeekPrefix(t *testing.T) {
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
 			it := r.Root().ReverseIterator()
-			it.SeekPrefix([]byte(c.prefix))
-
-			if c.expectResult && it.i.node == nil {
-				t.Errorf("expexted prefix %s to exist", c.prefix)
+			if got := it.SeekPrefixExists([]byte(c.prefix)); got != c.expectResult {
+				t.Errorf("prefix %s exists = %v, want %v", c.prefix, got, c.expectResult)
 				return
 			}
 
-			//if !c.expectResult && it.i.node != nil {
-			//	t.Errorf("unexpected node for prefix '%s'", c.prefix)
-			//	return
-			//}
+			// Iterating after the seek agrees
+			_, _, ok := it.Previous()
+			if ok != c.expectResult {
+				t.Errorf("prefix %s has keys = %v, want %v", c.prefix, ok, c.expectResult)
+			}
 		})
 	}
 }
@@ -427,3 +507,286 @@ func TestReverseIterator_Previous(t *testing.T) {
 		}
 	}
 }
+
+func TestReverseIterator_SeekReverseRange(t *testing.T) {
+	// these should be defined in order
+	fixedLenKeys := []string{
+		"20020",
+		"00020",
+		"00010",
+		"00004",
+		"00001",
+		"00000",
+	}
+
+	r := NewRadixTree[any]()
+	for _, k := range fixedLenKeys {
+		r, _, _ = r.Insert([]byte(k), nil)
+	}
+
+	cases := []struct {
+		lo, hi string
+		want   []string
+	}{
+		{"00004", "20020", []string{"20020", "00020", "00010"}},
+		{"00003", "20000", []string{"00020", "00010", "00004"}},
+		{"00010", "00010", nil},
+		{"00004", "00010", []string{"00010"}},
+		{"", "99999", fixedLenKeys},
+		{"00000", "00001", []string{"00001"}},
+		{"1", "2", nil},
+		{"30000", "40000", nil},
+	}
+	for _, c := range cases {
+		it := r.Root().ReverseIterator()
+		it.SeekReverseRange([]byte(c.lo), []byte(c.hi))
+		var out []string
+		for k, _, ok := it.Previous(); ok; k, _, ok = it.Previous() {
+			out = append(out, string(k))
+		}
+		if !slices.Equal(out, c.want) {
+			t.Fatalf("(%q, %q]: got %v, want %v", c.lo, c.hi, out, c.want)
+		}
+
+		// Once stopped the iterator stays exhausted
+		if k, _, ok := it.Previous(); ok {
+			t.Fatalf("(%q, %q]: got %q after the end", c.lo, c.hi, k)
+		}
+	}
+
+	// Page backward through (00000, 99999] two keys at a time, starting each
+	// page from the last key of the one before and skipping it.
+	var out []string
+	hi := "99999"
+	for {
+		it := r.Root().ReverseIterator()
+		it.SeekReverseRange([]byte("00000"), []byte(hi))
+		var page []string
+		for len(page) < 2 {
+			k, _, ok := it.Previous()
+			if !ok {
+				break
+			}
+			if string(k) != hi {
+				page = append(page, string(k))
+			}
+		}
+		if len(page) == 0 {
+			break
+		}
+		out = append(out, page...)
+		hi = page[len(page)-1]
+	}
+	if want := fixedLenKeys[:len(fixedLenKeys)-1]; !slices.Equal(out, want) {
+		t.Fatalf("paged: got %v, want %v", out, want)
+	}
+}
+
+func TestReverseIterator_SeekReverseLowerBoundWideNodes(t *testing.T) {
+	// Sparse children of a node48 and a node256, where a child's slot is not
+	// its key byte
+	for _, step := range []int{5, 2} {
+		r := NewRadixTree[int]()
+		var keys []string
+		for c := 0x30; c < 0x100; c += step {
+			for _, k := range []string{string([]byte{'k', byte(c)}), string([]byte{'k', byte(c), 'x'})} {
+				r, _, _ = r.Insert([]byte(k), len(keys))
+				keys = append(keys, k)
+			}
+		}
+		want := "*adaptive.Node48[int]"
+		if step == 2 {
+			want = "*adaptive.Node256[int]"
+		}
+		if got := fmt.Sprintf("%T", r.root); got != want {
+			t.Fatalf("root is %s, want %s", got, want)
+		}
+
+		for _, search := range []string{"k\x80", "k\x81", "k\x80y", "k\x80w", "k\x30", "k\x2f", "k\xff", "l", "k"} {
+			var exp []string
+			for i := len(keys) - 1; i >= 0; i-- {
+				if keys[i] <= search {
+					exp = append(exp, keys[i])
+				}
+			}
+			var got []string
+			it := r.Root().ReverseIterator()
+			it.SeekReverseLowerBound([]byte(search))
+			for k, _, ok := it.Previous(); ok; k, _, ok = it.Previous() {
+				got = append(got, string(k))
+			}
+			if !slices.Equal(got, exp) {
+				t.Fatalf("step %d search %q\n  got=%q\n  want=%q", step, search, got, exp)
+			}
+		}
+	}
+}
+
+func TestAllReverse(t *testing.T) {
+	r := NewRadixTree[int]()
+	keys := []string{"", "foo", "foo/bar", "foo/baz", "foobar", "zip"}
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	var got []string
+	for k, v := range r.AllReverse() {
+		if keys[v] != string(k) {
+			t.Fatalf("value %d for key %q", v, k)
+		}
+		got = append(got, string(k))
+	}
+	want := slices.Clone(keys)
+	slices.Reverse(want)
+	if !slices.Equal(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	got = nil
+	for k := range r.AllReverse() {
+		got = append(got, string(k))
+		if len(got) == 3 {
+			break
+		}
+	}
+	if !slices.Equal(got, want[:3]) {
+		t.Fatalf("got %q, want %q", got, want[:3])
+	}
+
+	for k := range NewRadixTree[int]().AllReverse() {
+		t.Fatalf("key %q in empty tree", k)
+	}
+}
+
+func TestWalkPrefixReverse(t *testing.T) {
+	r := NewRadixTree[int]()
+	var want []string
+	for m := 1; m <= 12; m++ {
+		k := fmt.Sprintf("foo/2024-%02d", m)
+		r, _, _ = r.Insert([]byte(k), m)
+		want = append(want, k)
+	}
+	slices.Reverse(want)
+	for _, k := range []string{"", "fo", "foo", "foo/", "foo0", "fop", "zip"} {
+		r, _, _ = r.Insert([]byte(k), 0)
+	}
+
+	var got []string
+	r.WalkPrefixReverse([]byte("foo/2024-"), func(k []byte, v int) bool {
+		got = append(got, string(k))
+		return false
+	})
+	if !slices.Equal(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	// A key equal to the prefix comes after every longer one
+	got = nil
+	r.WalkPrefixReverse([]byte("foo/"), func(k []byte, v int) bool {
+		got = append(got, string(k))
+		return false
+	})
+	if want := append(want, "foo/"); !slices.Equal(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	// Stopping early
+	got = nil
+	r.WalkPrefixReverse([]byte("foo/"), func(k []byte, v int) bool {
+		got = append(got, string(k))
+		return len(got) == 3
+	})
+	if want := want[:3]; !slices.Equal(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	// No key has the prefix
+	r.WalkPrefixReverse([]byte("x"), func(k []byte, v int) bool {
+		t.Fatalf("unexpected key %q", k)
+		return false
+	})
+}
+
+func TestReverseIterator_PrefixKeyBeforeLowBytes(t *testing.T) {
+	// A key inserted after longer keys that continue it with a byte below the
+	// '$' terminator must still sort before them in both directions
+	cases := [][]string{
+		{"a!a", "ab", "a"},
+		{"!", "!!", ""},
+		{"foo\x00", "foo!", "foo/", "foo"},
+		{"a!", "a$", "a#b", "a"},
+	}
+	for _, keys := range cases {
+		r := NewRadixTree[int]()
+		for i, k := range keys {
+			r, _, _ = r.Insert([]byte(k), i)
+		}
+		want := slices.Clone(keys)
+		sort.Strings(want)
+
+		var fwd []string
+		r.Walk(func(k []byte, _ int) bool {
+			fwd = append(fwd, string(k))
+			return false
+		})
+		if !slices.Equal(fwd, want) {
+			t.Fatalf("keys %q: forward got %q, want %q", keys, fwd, want)
+		}
+
+		var rev []string
+		it := r.Root().ReverseIterator()
+		for k, _, ok := it.Previous(); ok; k, _, ok = it.Previous() {
+			rev = append(rev, string(k))
+		}
+		slices.Reverse(want)
+		if !slices.Equal(rev, want) {
+			t.Fatalf("keys %q: reverse got %q, want %q", keys, rev, want)
+		}
+	}
+}
+
+func TestReverseIterator_SeekReverseLowerBoundLowBytes(t *testing.T) {
+	// Keys compare without their terminators, so a key followed by a byte
+	// below '$' still sorts after the key on its own
+	cases := []struct {
+		keys []string
+		seek string
+		want []string
+	}{
+		{[]string{"b"}, "b\x00", []string{"b"}},
+		{[]string{"", "!"}, "!!", []string{"!", ""}},
+		{[]string{"a\x00x", "a\x00y"}, "a", nil},
+		{[]string{"a\x00x", "a\x00y", "a"}, "a\x00x", []string{"a\x00x", "a"}},
+		{[]string{"foo", "foo!", "foo\x00"}, "foo\x00\x00", []string{"foo\x00", "foo"}},
+	}
+	for _, c := range cases {
+		r := NewRadixTree[int]()
+		for i, k := range c.keys {
+			r, _, _ = r.Insert([]byte(k), i)
+		}
+		it := r.Root().ReverseIterator()
+		it.SeekReverseLowerBound([]byte(c.seek))
+		var got []string
+		for k, _, ok := it.Previous(); ok; k, _, ok = it.Previous() {
+			got = append(got, string(k))
+		}
+		if !slices.Equal(got, c.want) {
+			t.Fatalf("keys %q seek %q: got %q, want %q", c.keys, c.seek, got, c.want)
+		}
+	}
+
+	// SeekReverseRange shares the seek
+	r := NewRadixTree[int]()
+	for i, k := range []string{"", "!", "!!", "!\x00"} {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+	it := r.Root().ReverseIterator()
+	it.SeekReverseRange([]byte(""), []byte("!!"))
+	var got []string
+	for k, _, ok := it.Previous(); ok; k, _, ok = it.Previous() {
+		got = append(got, string(k))
+	}
+	if want := []string{"!!", "!\x00", "!"}; !slices.Equal(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
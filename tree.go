@@ -6,11 +6,21 @@ package adaptive
 import (
 	"bytes"
 	"fmt"
+	"iter"
+	"math"
+	"math/rand"
+	"reflect"
+	"slices"
+	"sort"
 	"strconv"
+	"sync"
 )
 
 const maxPrefixLen = 10
 
+// estimateProbes is the number of random paths EstimatePrefixCount averages
+const estimateProbes = 64
+
 const (
 	leafType nodeType = iota
 	node4
@@ -21,10 +31,110 @@ const (
 
 type nodeType int
 
+func (t nodeType) String() string {
+	switch t {
+	case leafType:
+		return "leaf"
+	case node4:
+		return "node4"
+	case node16:
+		return "node16"
+	case node48:
+		return "node48"
+	case node256:
+		return "node256"
+	}
+	return "nodeType(" + strconv.Itoa(int(t)) + ")"
+}
+
+// NodeTypeName returns the name of the type of n, such as "node4" or "leaf",
+// for logs and other debugging output.
+func NodeTypeName[T any](n Node[T]) string {
+	return n.getArtNodeType().String()
+}
+
+// RadixTree is an immutable adaptive radix tree mapping byte keys to values
+// of type T. Changes are made through a Txn, or the methods built on one,
+// and give a new tree sharing its unchanged nodes with the old one.
+//
+// Keys returned by the tree and its iterators share memory with the keys
+// stored in it, so their bytes must not be modified. Their capacity ends
+// where they do, so appending to one makes a copy and is safe.
 type RadixTree[T any] struct {
-	root      Node[T]
-	size      uint64
-	maxNodeId uint64
+	root       Node[T]
+	size       uint64
+	maxNodeId  uint64
+	generation uint64
+	opts       Options
+}
+
+// Options changes how a tree behaves. Trees and transactions derived from a
+// tree keep its options.
+type Options struct {
+	// StrictNoOverwrite makes Insert leave the value of a key that is already
+	// in the tree in place, for trees used as write-once stores. Insert then
+	// returns the stored value and true, as it does when it replaces a value,
+	// and the tree is not changed.
+	StrictNoOverwrite bool
+
+	// DisableWatch turns off watch channels for trees that are only used as
+	// immutable maps, saving the channel each node would otherwise carry.
+	// GetWatch then returns a nil channel, and channels from SeekPrefixWatch
+	// are never closed.
+	DisableWatch bool
+
+	// KeyFingerprints stores a 64-bit fingerprint of each key on its leaf,
+	// for trees of long keys that often share most of their bytes. A lookup
+	// that ends at a leaf holding another key can then usually reject it
+	// without comparing the two keys in full. Fingerprints take 8 bytes per
+	// key and are worked out in constant time, whatever the key's length.
+	KeyFingerprints bool
+
+	// ZeroCopyKeys makes inserts store the caller's key slice instead of a
+	// copy of it, saving an allocation per key. Keys are stored with a one
+	// byte terminator after them, so this only happens for keys with spare
+	// capacity, and Insert writes the terminator into key[len(key)]; other
+	// keys are copied as usual. Once inserted, neither a key's bytes nor the
+	// byte after them may be changed, which rules out appending to the key.
+	ZeroCopyKeys bool
+
+	// KeyTransform normalizes keys before they are stored or looked up, for
+	// trees whose keys should match regardless of case or Unicode form. It is
+	// applied by Insert, Get, GetWatch, Delete and LongestPrefix, and the tree
+	// is ordered by the normalized keys. Keys read back from the tree are the
+	// ones the caller inserted, and when a key is inserted again under a
+	// different spelling the latest one is kept. Iterator seeks and the prefix
+	// methods take keys that are already normalized. The original spellings
+	// are not kept by MarshalBinary. The returned slice must not share memory
+	// with key unless it is key itself.
+	KeyTransform func(key []byte) []byte
+
+	// InternValues, if set, must be a func(T) T for the tree's value type T.
+	// It is given each value stored by Insert and InsertFunc and returns the
+	// value to store instead, so that equal values can be made to share
+	// memory, such as with unique.Make for a RadixTree[string] holding many
+	// copies of a few strings.
+	InternValues any
+
+	// Allocator, if set, must be an Allocator[T] for the tree's value type T.
+	// Transactions then get the nodes they create from it instead of from the
+	// Go heap, for trees embedded in programs that manage memory in arenas or
+	// similar. Nodes copied from an older version of the tree are still
+	// allocated as usual, and a transaction may reuse nodes it has dropped
+	// before asking the Allocator for more.
+	Allocator any
+}
+
+// Allocator hands out the nodes a transaction creates, see Options.Allocator.
+// Each method returns a pointer to a zero node that is not used anywhere
+// else. Nodes are never given back; they must stay valid for as long as any
+// tree holding them is in use.
+type Allocator[T any] interface {
+	NewLeaf() *NodeLeaf[T]
+	NewNode4() *Node4[T]
+	NewNode16() *Node16[T]
+	NewNode48() *Node48[T]
+	NewNode256() *Node256[T]
 }
 
 // WalkFn is used when walking the tree. Takes a
@@ -33,7 +143,22 @@ type RadixTree[T any] struct {
 type WalkFn[T any] func(k []byte, v T) bool
 
 func NewRadixTree[T any]() *RadixTree[T] {
-	rt := &RadixTree[T]{size: 0, maxNodeId: 0}
+	return NewRadixTreeWithOptions[T](Options{})
+}
+
+// NewRadixTreeWithOptions returns an empty tree with the given options.
+func NewRadixTreeWithOptions[T any](opts Options) *RadixTree[T] {
+	if opts.InternValues != nil {
+		if _, ok := opts.InternValues.(func(T) T); !ok {
+			panic(fmt.Sprintf("adaptive: InternValues is a %T, not a func(%s) %[2]s", opts.InternValues, reflect.TypeFor[T]()))
+		}
+	}
+	if opts.Allocator != nil {
+		if _, ok := opts.Allocator.(Allocator[T]); !ok {
+			panic(fmt.Sprintf("adaptive: Allocator is a %T, not an Allocator[%s]", opts.Allocator, reflect.TypeFor[T]()))
+		}
+	}
+	rt := &RadixTree[T]{size: 0, maxNodeId: 0, opts: opts}
 	rt.root = &Node4[T]{
 		leaf: &NodeLeaf[T]{},
 	}
@@ -43,28 +168,147 @@ func NewRadixTree[T any]() *RadixTree[T] {
 	return rt
 }
 
+// emptyTrees holds the tree returned by EmptyTree for each value type
+var emptyTrees sync.Map
+
+// EmptyTree returns an empty tree shared by every caller using the same value
+// type, which saves allocating a new root for each empty tree when many of
+// them are created. Like any committed tree it is never changed by
+// transactions started from it, or by Insert and Delete, which return new
+// trees instead. It must not be the target of UnmarshalBinary, and watch
+// channels taken from it fire whenever any transaction started from it is
+// committed with mutation tracking on.
+func EmptyTree[T any]() *RadixTree[T] {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	if t, ok := emptyTrees.Load(typ); ok {
+		return t.(*RadixTree[T])
+	}
+	t, _ := emptyTrees.LoadOrStore(typ, NewRadixTree[T]())
+	return t.(*RadixTree[T])
+}
+
 func (t *RadixTree[T]) Clone(deep bool) *RadixTree[T] {
 	if deep {
 		nt := &RadixTree[T]{
-			root:      t.root.clone(true, true),
-			size:      t.size,
-			maxNodeId: t.maxNodeId,
+			root:       t.root.clone(!t.opts.DisableWatch, true),
+			size:       t.size,
+			maxNodeId:  t.maxNodeId,
+			generation: t.generation,
+			opts:       t.opts,
 		}
 		return nt
 	}
 	nt := &RadixTree[T]{
-		root:      t.root.clone(true, false),
-		size:      t.size,
-		maxNodeId: t.maxNodeId,
+		root:       t.root.clone(!t.opts.DisableWatch, false),
+		size:       t.size,
+		maxNodeId:  t.maxNodeId,
+		generation: t.generation,
+		opts:       t.opts,
 	}
 	return nt
 }
 
+// Compact returns a tree with the same contents where every node that has room
+// for more children than it holds is rebuilt as the smallest node type that
+// fits them. Nodes only shrink when their child count crosses a threshold
+// during a delete, so a tree that grew and then lost many keys can be left
+// with oversized nodes.
+func (t *RadixTree[T]) Compact() *RadixTree[T] {
+	txn := t.Txn(false)
+	txn.tree.root = txn.compact(txn.tree.root)
+	return txn.Commit()
+}
+
+// TreeStats counts the nodes in a tree by type, as reported by Stats.
+type TreeStats struct {
+	Node4   int
+	Node16  int
+	Node48  int
+	Node256 int
+	// Leaves is the number of leaves holding keys, which equals Len
+	Leaves int
+}
+
+// Stats counts the nodes in the tree by type. It visits every node.
+func (t *RadixTree[T]) Stats() TreeStats {
+	var s TreeStats
+	it := t.RawIterator()
+	for it.Next(); it.Front() != nil; it.Next() {
+		switch it.Front().getArtNodeType() {
+		case leafType:
+			s.Leaves++
+		case node4:
+			s.Node4++
+		case node16:
+			s.Node16++
+		case node48:
+			s.Node48++
+		case node256:
+			s.Node256++
+		}
+	}
+	return s
+}
+
+// DepthHistogram returns, for each depth, the number of keys stored that far
+// below the root, counting the nodes a Get passes through on its way down.
+// The root itself is at depth 0. Keys clustering at large depths point to
+// long chains of nodes, which slow down every lookup that follows them.
+func (t *RadixTree[T]) DepthHistogram() map[int]int {
+	h := make(map[int]int)
+	depthHistogram(t.root, 0, h)
+	return h
+}
+
+func depthHistogram[T any](n Node[T], depth int, h map[int]int) {
+	l := n.getNodeLeaf()
+	if n.getArtNodeType() == leafType {
+		l = n.(*NodeLeaf[T])
+	}
+	// The empty root of an empty tree carries a leaf with no key at all
+	if l != nil && len(l.getKey()) > 0 {
+		h[depth]++
+	}
+	for _, e := range n.getChildren() {
+		if e != nil {
+			depthHistogram(e, depth+1, h)
+		}
+	}
+}
+
 // Len is used to return the number of elements in the tree
 func (t *RadixTree[T]) Len() int {
 	return int(t.size)
 }
 
+// IsEmpty returns whether the tree holds no keys. An empty tree still has a
+// root node, so this is not the same as checking the root.
+func (t *RadixTree[T]) IsEmpty() bool {
+	return t.size == 0
+}
+
+// RootType returns the type of the tree's root node, which prints as a name
+// such as "node4".
+func (t *RadixTree[T]) RootType() nodeType {
+	return t.root.getArtNodeType()
+}
+
+// RootFanout returns the number of ways the keys branch at the root of the
+// tree, as Node.Fanout does, which shows how they split at the top.
+func (t *RadixTree[T]) RootFanout() int {
+	return t.root.Fanout()
+}
+
+// Generation returns the number of commits that led to this tree. Every
+// Commit or CommitOnly returns a tree one generation past the tree its
+// transaction started from, even if the transaction made no changes, so two
+// trees from the same lineage with equal generations hold the same contents.
+// Trees committed from separate transactions on the same parent share a
+// generation and should not be compared this way.
+func (t *RadixTree[T]) Generation() uint64 {
+	return t.generation
+}
+
 func (t *RadixTree[T]) GetPathIterator(path []byte) *PathIterator[T] {
 	return t.root.PathIterator(path)
 }
@@ -75,8 +319,125 @@ func (t *RadixTree[T]) Insert(key []byte, value T) (*RadixTree[T], T, bool) {
 	return txn.Commit(), old, ok
 }
 
+// Pair is a key and value, as passed to InsertAll.
+type Pair[T any] struct {
+	Key   []byte
+	Value T
+}
+
+// InsertAll inserts every pair in a single transaction and returns the
+// resulting tree. When a key appears more than once the last pair wins.
+func (t *RadixTree[T]) InsertAll(pairs []Pair[T]) *RadixTree[T] {
+	txn := t.Txn(false)
+	for _, p := range pairs {
+		txn.Insert(p.Key, p.Value)
+	}
+	return txn.Commit()
+}
+
 func (t *RadixTree[T]) Get(key []byte) (T, bool) {
-	return t.iterativeSearch(getTreeKey(key))
+	return t.iterativeSearch(t.lookupKey(key))
+}
+
+// GetWithDefault returns the value for key, or def if key is not in the tree.
+func (t *RadixTree[T]) GetWithDefault(key []byte, def T) T {
+	if v, ok := t.Get(key); ok {
+		return v
+	}
+	return def
+}
+
+// lookupKey returns key as it is searched for in the tree: normalized by the
+// tree's KeyTransform, if it has one, and followed by its terminator.
+func (t *RadixTree[T]) lookupKey(key []byte) []byte {
+	if t.opts.KeyTransform != nil {
+		key = t.opts.KeyTransform(key)
+	}
+	return getTreeKey(key)
+}
+
+// GetExactKey is like Get but also returns the key as it is stored in the
+// tree, which has the same bytes as key but not the same backing array. With a
+// KeyTransform it is the key as it was inserted. The returned key must not be
+// modified.
+func (t *RadixTree[T]) GetExactKey(key []byte) ([]byte, T, bool) {
+	var zero T
+	l := t.searchFrom(t.root, 0, t.lookupKey(key), nil)
+	if l == nil {
+		return nil, zero, false
+	}
+	return l.userKey(), l.getValue(), true
+}
+
+// Contains returns whether the key is in the tree. Together with Insert and
+// Delete it lets a RadixTree[struct{}] be used as an immutable set of keys.
+func (t *RadixTree[T]) Contains(key []byte) bool {
+	_, found := t.Get(key)
+	return found
+}
+
+// HasPrefix returns whether any key in the tree starts with prefix, whether or
+// not prefix is itself a key, which is what Contains checks for. It only seeks
+// to the node holding the prefix, so it is cheap even for a short prefix with
+// many keys below it.
+func (t *RadixTree[T]) HasPrefix(prefix []byte) bool {
+	_, _, ok := t.prefixBound(prefix, minimum[T])
+	return ok
+}
+
+// GetMulti is used to look up many keys at once. It returns the values and
+// whether each key was found, in the same order as keys. The keys are looked up
+// in sorted order so that each search can resume from the deepest node it
+// shares with the previous key rather than descending from the root again.
+func (t *RadixTree[T]) GetMulti(keys [][]byte) ([]T, []bool) {
+	values := make([]T, len(keys))
+	found := make([]bool, len(keys))
+	if t.opts.KeyTransform != nil {
+		keys = slices.Clone(keys)
+		for i, key := range keys {
+			keys[i] = t.opts.KeyTransform(key)
+		}
+	}
+
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	if !sort.SliceIsSorted(order, func(a, b int) bool {
+		return bytes.Compare(keys[order[a]], keys[order[b]]) < 0
+	}) {
+		sort.SliceStable(order, func(a, b int) bool {
+			return bytes.Compare(keys[order[a]], keys[order[b]]) < 0
+		})
+	}
+
+	var frames []searchFrame[T]
+	var prev []byte
+	for _, idx := range order {
+		key := keys[idx]
+
+		// Any node entered at a depth within the prefix shared with the
+		// previous key is also on the path for this key.
+		common := 0
+		for common < len(prev) && common < len(key) && prev[common] == key[common] {
+			common++
+		}
+		for len(frames) > 0 && frames[len(frames)-1].depth > common {
+			frames = frames[:len(frames)-1]
+		}
+
+		n, depth := t.root, 0
+		if len(frames) > 0 {
+			top := frames[len(frames)-1]
+			frames = frames[:len(frames)-1]
+			n, depth = top.node, top.depth
+		}
+		if l := t.searchFrom(n, depth, getTreeKey(key), &frames); l != nil {
+			values[idx], found[idx] = l.getValue(), true
+		}
+		prev = key
+	}
+	return values, found
 }
 
 func (t *RadixTree[T]) Delete(key []byte) (*RadixTree[T], T, bool) {
@@ -85,13 +446,35 @@ func (t *RadixTree[T]) Delete(key []byte) (*RadixTree[T], T, bool) {
 	return txn.Commit(), old, ok
 }
 
+// GetWatch returns the value for key, whether it was found, and a channel
+// that is closed when the key is changed. For a missing key the channel is
+// that of the deepest node the search reached, which is closed once a key is
+// added below it. Nodes get their channel when they are created, except in a
+// decoded tree, where a node gets it on the first watch and then keeps it, so
+// misses make at most one channel per node. With DisableWatch no channel is
+// made and the channel returned is nil.
 func (t *RadixTree[T]) GetWatch(key []byte) (<-chan struct{}, T, bool) {
-	val, found, watch := t.iterativeSearchWithWatch(getTreeKey(key))
+	if t.opts.DisableWatch {
+		val, found := t.Get(key)
+		return nil, val, found
+	}
+	val, found, watch := t.iterativeSearchWithWatch(t.lookupKey(key))
 	return watch, val, found
 }
 
+// RootWatch returns a channel that is closed by the next committed change to
+// any key in the tree, made in a transaction with TrackMutate set. It is the
+// cheapest way to learn that something changed, without saying what. The
+// channel is nil if the tree was created with DisableWatch.
+func (t *RadixTree[T]) RootWatch() <-chan struct{} {
+	if t.opts.DisableWatch {
+		return nil
+	}
+	return t.root.getMutateCh()
+}
+
 func (t *RadixTree[T]) LongestPrefix(k []byte) ([]byte, T, bool) {
-	key := getTreeKey(k)
+	key := t.lookupKey(k)
 	var zero T
 	if t.root == nil {
 		return nil, zero, false
@@ -100,12 +483,18 @@ func (t *RadixTree[T]) LongestPrefix(k []byte) ([]byte, T, bool) {
 	var child, last Node[T]
 	depth := 0
 
+	// The root's leaf only counts once its prefix has matched, which the loop
+	// checks like any other node's
 	n := t.root
 	last = nil
-	if n.getNodeLeaf() != nil {
-		last = n.getNodeLeaf()
-	}
 	for {
+		// A leaf holds its full key, so it either matches or ends the search
+		if isLeaf[T](n) {
+			if n.getNodeLeaf() != nil && bytes.HasPrefix(getKey(key), getKey(n.getNodeLeaf().getKey())) {
+				last = n.getNodeLeaf()
+			}
+			break
+		}
 
 		// Bail if the prefix does not match
 		if n.getPartialLen() > 0 {
@@ -116,20 +505,13 @@ func (t *RadixTree[T]) LongestPrefix(k []byte) ([]byte, T, bool) {
 			depth += int(n.getPartialLen())
 		}
 
-		if depth >= len(key) {
-			break
-		}
-
+		// A key ending at this depth is the node's own leaf, never a child
 		if n.getNodeLeaf() != nil && bytes.HasPrefix(getKey(key), getKey(n.getNodeLeaf().getKey())) {
 			last = n.getNodeLeaf()
 		}
 
-		for _, ch := range n.getChildren() {
-			if ch != nil {
-				if ch.getNodeLeaf() != nil && bytes.HasPrefix(getKey(key), getKey(ch.getNodeLeaf().getKey())) {
-					last = ch.getNodeLeaf()
-				}
-			}
+		if depth >= len(key) {
+			break
 		}
 
 		// Recursively search
@@ -141,8 +523,10 @@ func (t *RadixTree[T]) LongestPrefix(k []byte) ([]byte, T, bool) {
 		depth++
 	}
 
-	if last != nil {
-		return getKey(last.getKey()), last.getValue(), true
+	// The empty root of an empty tree carries a leaf with no key at all,
+	// which is a prefix of everything but not a stored key
+	if last != nil && len(last.getKey()) > 0 {
+		return last.(*NodeLeaf[T]).userKey(), last.getValue(), true
 	}
 
 	return nil, zero, false
@@ -156,89 +540,268 @@ func (t *RadixTree[T]) Maximum() *NodeLeaf[T] {
 	return maximum[T](t.root)
 }
 
+// MinimumPrefix returns the smallest key that starts with the given prefix,
+// along with its value and if any such key was found.
+func (t *RadixTree[T]) MinimumPrefix(prefix []byte) ([]byte, T, bool) {
+	return t.prefixBound(prefix, minimum[T])
+}
+
+// MaximumPrefix returns the largest key that starts with the given prefix,
+// along with its value and if any such key was found.
+func (t *RadixTree[T]) MaximumPrefix(prefix []byte) ([]byte, T, bool) {
+	return t.prefixBound(prefix, maximum[T])
+}
+
+// CommonPrefix returns the longest prefix shared by every key that starts with
+// the given prefix, which is where those keys first branch apart. It returns
+// nil if no key starts with prefix. For a tree with a KeyTransform it is a
+// prefix of the normalized keys.
+func (t *RadixTree[T]) CommonPrefix(prefix []byte) []byte {
+	minLeaf := t.prefixLeaf(prefix, minimum[T])
+	if minLeaf == nil {
+		return nil
+	}
+	// Keys are ordered, so whatever the smallest and largest keys share is
+	// shared by every key in between as well.
+	lo := getKey(minLeaf.getKey())
+	hi := getKey(t.prefixLeaf(prefix, maximum[T]).getKey())
+	n := len(prefix)
+	for n < len(lo) && n < len(hi) && lo[n] == hi[n] {
+		n++
+	}
+	return lo[:n:n]
+}
+
+// CountPrefix returns the number of keys that start with the given prefix.
+// It visits every one of them, see EstimatePrefixCount for a faster guess.
+func (t *RadixTree[T]) CountPrefix(prefix []byte) int {
+	if len(prefix) == 0 {
+		return t.Len()
+	}
+	count := 0
+	it := t.root.Iterator()
+	it.SeekPrefix(prefix)
+	for _, _, ok := it.Next(); ok; _, _, ok = it.Next() {
+		if bytes.HasPrefix(it.CurrentPath(), prefix) {
+			count++
+		}
+	}
+	return count
+}
+
+// LenPrefix returns the number of keys that start with prefix, as Len does
+// for the whole tree, so an empty prefix gives Len. It is CountPrefix under
+// the name that goes with Len, and like it visits every key it counts.
+func (t *RadixTree[T]) LenPrefix(prefix []byte) int {
+	return t.CountPrefix(prefix)
+}
+
+// EstimatePrefixCount estimates the number of keys that start with the given
+// prefix without visiting all of them. From the node holding the prefix it
+// follows a few random paths down to a leaf, multiplying the fanout of every
+// node on the way, and averages the products. Its cost is proportional to the
+// depth of the tree rather than the number of keys.
+//
+// The estimate is unbiased, and exact when sibling subtrees hold the same
+// number of keys, so it is close for evenly spread keys such as random IDs.
+// When keys are skewed towards a few branches it can be off by a factor of
+// the fanout of the nodes involved, so it should only be used where a rough
+// size is good enough. It is 0 exactly when no key has the prefix, and equal
+// to Len for an empty prefix.
+func (t *RadixTree[T]) EstimatePrefixCount(prefix []byte) int {
+	if len(prefix) == 0 {
+		return t.Len()
+	}
+	n := t.root.Iterator().SeekPrefix(prefix)
+	if l := minimum[T](n); l == nil || !bytes.HasPrefix(getKey(l.getKey()), prefix) {
+		return 0
+	}
+
+	// A fixed seed keeps the estimate stable for the same tree
+	rnd := rand.New(rand.NewSource(1))
+	var branches []Node[T]
+	total := 0.0
+	for p := 0; p < estimateProbes; p++ {
+		est := 1.0
+		for node := n; node.getArtNodeType() != leafType; {
+			branches = branches[:0]
+			if l := node.getNodeLeaf(); l != nil && len(l.getKey()) > 0 {
+				branches = append(branches, l)
+			}
+			for _, ch := range node.getChildren() {
+				if ch != nil {
+					branches = append(branches, ch)
+				}
+			}
+			if len(branches) == 0 {
+				break
+			}
+			est *= float64(len(branches))
+			node = branches[rnd.Intn(len(branches))]
+		}
+		total += est
+	}
+	return max(1, int(math.Round(total/estimateProbes)))
+}
+
+// FirstN returns up to n of the smallest keys in the tree in ascending order,
+// along with their values.
+func (t *RadixTree[T]) FirstN(n int) ([][]byte, []T) {
+	if n <= 0 || t.Len() == 0 {
+		return nil, nil
+	}
+	keys := make([][]byte, 0, min(n, t.Len()))
+	values := make([]T, 0, min(n, t.Len()))
+	it := t.root.Iterator()
+	it.SeekPrefix(nil)
+	for len(keys) < n {
+		k, v, ok := it.Next()
+		if !ok {
+			break
+		}
+		keys = append(keys, k)
+		values = append(values, v)
+	}
+	return keys, values
+}
+
+// Range returns the keys in [lo, hi) in ascending order, along with their
+// values. A nil lo starts at the first key and a nil hi runs to the last one.
+func (t *RadixTree[T]) Range(lo, hi []byte) ([][]byte, []T) {
+	if t.Len() == 0 {
+		return nil, nil
+	}
+	var keys [][]byte
+	var values []T
+	it := t.root.LowerBoundIterator()
+	it.SeekLowerBound(lo)
+	for k, v, ok := it.Next(); ok; k, v, ok = it.Next() {
+		if hi != nil && bytes.Compare(it.storedKey(), hi) >= 0 {
+			break
+		}
+		keys = append(keys, k)
+		values = append(values, v)
+	}
+	return keys, values
+}
+
+// LastN returns up to n of the largest keys in the tree in descending order,
+// along with their values.
+func (t *RadixTree[T]) LastN(n int) ([][]byte, []T) {
+	if n <= 0 || t.Len() == 0 {
+		return nil, nil
+	}
+	keys := make([][]byte, 0, min(n, t.Len()))
+	values := make([]T, 0, min(n, t.Len()))
+	it := t.root.ReverseIterator()
+	for len(keys) < n {
+		k, v, ok := it.Previous()
+		if !ok {
+			break
+		}
+		keys = append(keys, k)
+		values = append(values, v)
+	}
+	return keys, values
+}
+
+// prefixBound seeks to the subtree holding the keys under prefix and returns
+// the key and value of the leaf picked from it by bound.
+func (t *RadixTree[T]) prefixBound(prefix []byte, bound func(Node[T]) *NodeLeaf[T]) ([]byte, T, bool) {
+	var zero T
+	l := t.prefixLeaf(prefix, bound)
+	if l == nil {
+		return nil, zero, false
+	}
+	return l.userKey(), l.getValue(), true
+}
+
+// prefixLeaf seeks to the subtree holding the keys under prefix and returns
+// the leaf picked from it by bound, or nil if no key starts with prefix.
+func (t *RadixTree[T]) prefixLeaf(prefix []byte, bound func(Node[T]) *NodeLeaf[T]) *NodeLeaf[T] {
+	if t.Len() == 0 {
+		return nil
+	}
+
+	// The seek stops at the deepest node along the prefix, which is either
+	// the root of every key sharing the prefix or a node none of whose keys
+	// share it, so checking the chosen leaf is enough to tell them apart.
+	n := t.root.Iterator().SeekPrefix(prefix)
+	l := bound(n)
+	if l == nil || !bytes.HasPrefix(getKey(l.getKey()), prefix) {
+		return nil
+	}
+	return l
+}
+
 func (t *RadixTree[T]) iterativeSearch(key []byte) (T, bool) {
 	var zero T
-	n := t.root
+	l := t.searchFrom(t.root, 0, key, nil)
+	if l == nil {
+		return zero, false
+	}
+	return l.getValue(), true
+}
+
+// searchFrame records a node visited during a search along with the key depth
+// at which it was entered.
+type searchFrame[T any] struct {
+	node  Node[T]
+	depth int
+}
 
+// searchFrom searches for key starting at node n, which must have been reached
+// by consuming the first depth bytes of key, and returns the leaf holding it or
+// nil if there is none. If frames is non-nil every node
+// visited on the way down is appended to it so a later search for a key sharing
+// a prefix can resume from there.
+func (t *RadixTree[T]) searchFrom(n Node[T], depth int, key []byte, frames *[]searchFrame[T]) *NodeLeaf[T] {
 	if n == nil {
-		return zero, false
+		return nil
 	}
 
 	var child Node[T]
-	depth := 0
+	var fp uint64
 
 	for {
-		// Might be a leaf
+		if frames != nil {
+			*frames = append(*frames, searchFrame[T]{n, depth})
+		}
 
-		if isLeaf[T](n) {
-			// Check if the expanded path matches
-			if n.getArtNodeType() == leafType {
-				if leafMatches(n.getKey(), key) == 0 {
-					return n.getValue(), true
-				}
-			}
-			nL := n.getNodeLeaf()
-			if nL != nil && leafMatches(nL.getKey(), key) == 0 {
-				return nL.getValue(), true
+		// A bare leaf holds its full key
+		if n.getArtNodeType() == leafType {
+			if leafHasKey(n.(*NodeLeaf[T]), key, &fp) {
+				return n.(*NodeLeaf[T])
 			}
+			return nil
+		}
+
+		// Check the key stored at this node
+		nL := n.getNodeLeaf()
+		if nL != nil && leafHasKey(nL, key, &fp) {
+			return nL
+		}
+		if isLeaf[T](n) {
+			return nil
 		}
 
 		// Bail if the prefix does not match
 		if n.getPartialLen() > 0 {
 			prefixLen := checkPrefix(n.getPartial(), int(n.getPartialLen()), key, depth)
 			if prefixLen != min(maxPrefixLen, int(n.getPartialLen())) {
-				if n.getNodeLeaf() != nil {
-					if leafMatches(n.getNodeLeaf().getKey(), key) == 0 {
-						return n.getNodeLeaf().getValue(), true
-					}
-				}
-				for _, ch := range n.getChildren() {
-					if ch != nil && ch.getNodeLeaf() != nil {
-						chNodeLeaf := ch.getNodeLeaf()
-						if leafMatches(chNodeLeaf.getKey(), key) == 0 {
-							return chNodeLeaf.getValue(), true
-						}
-					}
-				}
-				return zero, false
+				return nil
 			}
 			depth += int(n.getPartialLen())
 		}
 
 		if depth >= len(key) {
-			if n.getNodeLeaf() != nil {
-				if leafMatches(n.getNodeLeaf().getKey(), key) == 0 {
-					return n.getNodeLeaf().getValue(), true
-				}
-			}
-			for _, ch := range n.getChildren() {
-				if ch != nil && ch.getNodeLeaf() != nil {
-					chNodeLeaf := ch.getNodeLeaf()
-					if leafMatches(chNodeLeaf.getKey(), key) == 0 {
-						return chNodeLeaf.getValue(), true
-					}
-				}
-			}
-			return zero, false
+			return nil
 		}
 
 		// Recursively search
 		child, _ = t.findChild(n, key[depth])
 		if child == nil {
-			if n.getNodeLeaf() != nil {
-				if leafMatches(n.getNodeLeaf().getKey(), key) == 0 {
-					return n.getNodeLeaf().getValue(), true
-				}
-			}
-			for _, ch := range n.getChildren() {
-				if ch != nil && ch.getNodeLeaf() != nil {
-					chNodeLeaf := ch.getNodeLeaf()
-					if leafMatches(chNodeLeaf.getKey(), key) == 0 {
-						return chNodeLeaf.getValue(), true
-					}
-				}
-			}
-			return zero, false
+			return nil
 		}
 		n = child
 		depth++
@@ -254,79 +817,43 @@ func (t *RadixTree[T]) iterativeSearchWithWatch(key []byte) (T, bool, <-chan str
 	}
 
 	var child Node[T]
+	var fp uint64
 	depth := 0
 
 	for {
-		// Might be a leaf
+		// A bare leaf holds its full key
+		if n.getArtNodeType() == leafType {
+			if leafHasKey(n.(*NodeLeaf[T]), key, &fp) {
+				return n.getValue(), true, n.getMutateCh()
+			}
+			return zero, false, n.getMutateCh()
+		}
 
+		// Check the key stored at this node
+		nL := n.getNodeLeaf()
+		if nL != nil && leafHasKey(nL, key, &fp) {
+			return nL.getValue(), true, nL.getMutateCh()
+		}
 		if isLeaf[T](n) {
-			if n.getArtNodeType() == leafType {
-				if leafMatches(n.getKey(), key) == 0 {
-					return n.getValue(), true, n.getMutateCh()
-				}
-			}
-			// Check if the expanded path matches
-			nL := n.getNodeLeaf()
-			if leafMatches(nL.getKey(), key) == 0 {
-				return nL.getValue(), true, nL.getMutateCh()
-			}
+			return zero, false, n.getMutateCh()
 		}
 
 		// Bail if the prefix does not match
 		if n.getPartialLen() > 0 {
 			prefixLen := checkPrefix(n.getPartial(), int(n.getPartialLen()), key, depth)
 			if prefixLen != min(maxPrefixLen, int(n.getPartialLen())) {
-				if n.getNodeLeaf() != nil {
-					if leafMatches(n.getNodeLeaf().getKey(), key) == 0 {
-						return n.getNodeLeaf().getValue(), true, n.getNodeLeaf().getMutateCh()
-					}
-				}
-				for _, ch := range n.getChildren() {
-					if ch != nil && ch.getNodeLeaf() != nil {
-						chNodeLeaf := ch.getNodeLeaf()
-						if leafMatches(chNodeLeaf.getKey(), key) == 0 {
-							return chNodeLeaf.getValue(), true, chNodeLeaf.getMutateCh()
-						}
-					}
-				}
 				return zero, false, n.getMutateCh()
 			}
 			depth += int(n.getPartialLen())
 		}
 
 		if depth >= len(key) {
-			if n.getNodeLeaf() != nil {
-				if leafMatches(n.getNodeLeaf().getKey(), key) == 0 {
-					return n.getNodeLeaf().getValue(), true, n.getNodeLeaf().getMutateCh()
-				}
-			}
-			for _, ch := range n.getChildren() {
-				if ch != nil && ch.getNodeLeaf() != nil {
-					chNodeLeaf := ch.getNodeLeaf()
-					if leafMatches(chNodeLeaf.getKey(), key) == 0 {
-						return chNodeLeaf.getValue(), true, chNodeLeaf.getMutateCh()
-					}
-				}
-			}
 			return zero, false, n.getMutateCh()
 		}
 
 		// Recursively search
 		child, _ = t.findChild(n, key[depth])
 		if child == nil {
-			if n.getNodeLeaf() != nil {
-				if leafMatches(n.getNodeLeaf().getKey(), key) == 0 {
-					return n.getNodeLeaf().getValue(), true, n.getNodeLeaf().getMutateCh()
-				}
-			}
-			for _, ch := range n.getChildren() {
-				if ch != nil && ch.getNodeLeaf() != nil {
-					chNodeLeaf := ch.getNodeLeaf()
-					if leafMatches(chNodeLeaf.getKey(), key) == 0 {
-						return chNodeLeaf.getValue(), true, chNodeLeaf.getMutateCh()
-					}
-				}
-			}
 			return zero, false, n.getMutateCh()
 		}
 		n = child
@@ -340,6 +867,65 @@ func (t *RadixTree[T]) DeletePrefix(key []byte) (*RadixTree[T], bool) {
 	return txn.Commit(), ok
 }
 
+// DeleteAll returns an empty tree in place of this one, along with the number
+// of keys removed. Unlike DeletePrefix with an empty prefix, nothing is
+// walked: the new tree simply starts from a fresh root, one generation on and
+// with the same options.
+func (t *RadixTree[T]) DeleteAll() (*RadixTree[T], int) {
+	nt := &RadixTree[T]{
+		root:       &Node4[T]{leaf: &NodeLeaf[T]{}},
+		maxNodeId:  t.maxNodeId + 2,
+		generation: t.generation + 1,
+		opts:       t.opts,
+	}
+	nt.root.setId(t.maxNodeId + 1)
+	nt.root.getNodeLeaf().setId(t.maxNodeId + 2)
+	return nt, t.Len()
+}
+
+// DeleteChildren is used to delete the keys one level below the prefix, as
+// described by Txn.DeleteChildren.
+func (t *RadixTree[T]) DeleteChildren(prefix []byte, sep byte) (*RadixTree[T], bool) {
+	txn := t.Txn(false)
+	ok := txn.DeleteChildren(prefix, sep)
+	return txn.Commit(), ok
+}
+
+// ListChildren lists the distinct segments directly below prefix, in the way
+// a directory listing would. Each key under prefix contributes the bytes after
+// prefix up to, but not including, the next sep, so deeper keys collapse into
+// their first segment. Segments are returned in order, and the bool reports
+// whether any key, including prefix itself, starts with prefix. With sep '/'
+// and prefix "a/", the keys "a/b/c", "a/b/d" and "a/e" list as "b" and "e".
+// For a tree with a KeyTransform the segments are taken from the normalized
+// keys.
+func (t *RadixTree[T]) ListChildren(prefix []byte, sep byte) ([][]byte, bool) {
+	var segments [][]byte
+	found := false
+	it := t.root.Iterator()
+	it.SeekPrefix(prefix)
+	for _, _, ok := it.Next(); ok; _, _, ok = it.Next() {
+		key := it.CurrentPath()
+		if !bytes.HasPrefix(key, prefix) {
+			continue
+		}
+		found = true
+		rest := key[len(prefix):]
+		if len(rest) == 0 {
+			continue
+		}
+		if i := bytes.IndexByte(rest, sep); i >= 0 {
+			rest = rest[:i:i]
+		}
+		// Keys come out in order, so repeats of a segment are adjacent
+		if len(segments) > 0 && bytes.Equal(segments[len(segments)-1], rest) {
+			continue
+		}
+		segments = append(segments, rest)
+	}
+	return segments, found
+}
+
 // findChild finds the child node pointer based on the given character in the ART tree node.
 func (t *RadixTree[T]) findChild(n Node[T], c byte) (Node[T], int) {
 	return findChild(n, c)
@@ -356,6 +942,413 @@ func (t *RadixTree[T]) Walk(fn WalkFn[T]) {
 	recursiveWalk(t.root, fn)
 }
 
+// DistinctValues returns the values in the tree with duplicates under eq
+// removed, each in the place of its first key, such as the set of states a
+// tree of keys to states is in. Every value is compared with the distinct
+// ones found before it, so it is meant for small sets of values.
+func (t *RadixTree[T]) DistinctValues(eq func(a, b T) bool) []T {
+	var out []T
+	t.Walk(func(_ []byte, v T) bool {
+		if !slices.ContainsFunc(out, func(d T) bool { return eq(d, v) }) {
+			out = append(out, v)
+		}
+		return false
+	})
+	return out
+}
+
+// WalkPrefixReverse walks the keys starting with prefix in descending order,
+// which visits the newest entries of a namespace first when its keys are
+// ordered by time. fn returns true to stop the walk, as with Walk.
+func (t *RadixTree[T]) WalkPrefixReverse(prefix []byte, fn WalkFn[T]) {
+	it := t.root.ReverseIterator()
+	it.SeekPrefix(prefix)
+	for k, v, ok := it.Previous(); ok; k, v, ok = it.Previous() {
+		if fn(k, v) {
+			return
+		}
+	}
+}
+
+// WalkPrefixStripped walks the keys starting with prefix in order, passing fn
+// each key with the prefix cut off, as a directory listing shows names
+// relative to the directory. A key equal to the prefix is passed as an empty
+// suffix. For a tree with a KeyTransform the suffixes are cut from the
+// normalized keys. fn returns true to stop the walk, as with Walk.
+func (t *RadixTree[T]) WalkPrefixStripped(prefix []byte, fn WalkFn[T]) {
+	it := t.root.Iterator()
+	it.SeekPrefix(prefix)
+	for _, v, ok := it.Next(); ok; _, v, ok = it.Next() {
+		if fn(it.CurrentPath()[len(prefix):], v) {
+			return
+		}
+	}
+}
+
+// WalkKeyLen walks the keys of exactly n bytes in order, for trees using
+// fixed-width keys alongside others. Subtrees whose keys are all longer than n
+// are skipped, but shorter keys are only told apart at their leaves. With a
+// KeyTransform, n is the length of the normalized keys. fn returns true to
+// stop the walk, as with Walk.
+func (t *RadixTree[T]) WalkKeyLen(n int, fn WalkFn[T]) {
+	if n < 0 {
+		return
+	}
+	walkKeyLen(t.root, 0, n+1, fn)
+}
+
+// AllReverse returns an iterator over the keys and values in the tree in
+// descending key order, for use in a range loop. Breaking out of the loop
+// stops the iteration.
+func (t *RadixTree[T]) AllReverse() iter.Seq2[[]byte, T] {
+	return func(yield func([]byte, T) bool) {
+		it := t.root.ReverseIterator()
+		for k, v, ok := it.Previous(); ok; k, v, ok = it.Previous() {
+			if !yield(k, v) {
+				return
+			}
+		}
+	}
+}
+
+// AllRef returns an iterator over the keys in the tree in ascending order,
+// each with a pointer to its stored value, for use in a range loop. Scanning
+// through pointers avoids copying values that are large structs. The values
+// are shared with every tree derived from this one, so they must only be
+// read through the pointers, never written. Breaking out of the loop stops
+// the iteration.
+func (t *RadixTree[T]) AllRef() iter.Seq2[[]byte, *T] {
+	return func(yield func([]byte, *T) bool) {
+		walkLeaves(t.root, func(l *NodeLeaf[T]) bool {
+			return !yield(l.userKey(), &l.value)
+		})
+	}
+}
+
+// walkLeaves calls fn with each leaf holding a key below n in key order, as
+// recursiveWalk does with keys and values, stopping if fn returns true.
+func walkLeaves[T any](n Node[T], fn func(l *NodeLeaf[T]) bool) bool {
+	l := n.getNodeLeaf()
+	if n.getArtNodeType() == leafType {
+		l = n.(*NodeLeaf[T])
+	}
+	if l != nil && len(l.getKey()) > 0 && fn(l) {
+		return true
+	}
+	if n.getArtNodeType() == node48 {
+		for i := 0; i < 256; i++ {
+			idx := n.getKeyAtIdx(i)
+			if idx == 0 {
+				continue
+			}
+			if e := n.getChild(int(idx - 1)); e != nil && walkLeaves(e, fn) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, e := range n.getChildren() {
+		if e != nil && walkLeaves(e, fn) {
+			return true
+		}
+	}
+	return false
+}
+
+// ChangedSince returns an iterator over the keys and values in the tree that
+// were written after old, in key order. old must be an earlier version that
+// this tree was derived from through transactions. Nodes are copied before
+// being changed, so any node no newer than old is shared with it and its
+// whole subtree is skipped. Every key inserted or updated since old is
+// included, along with any whose leaf was copied when the node holding it was
+// resized. Deleted keys are not reported.
+func (t *RadixTree[T]) ChangedSince(old *RadixTree[T]) iter.Seq2[[]byte, T] {
+	return func(yield func([]byte, T) bool) {
+		changedSince(t.root, old.maxNodeId, yield)
+	}
+}
+
+// SharedNodeCount returns how many nodes, leaves included, a and b have in
+// common, which shows how much of the memory of two versions of a tree is
+// shared. Nodes are matched by identity rather than by id, as transactions
+// cloned from the same tree hand out the same ids to different nodes. A
+// shared node's whole subtree is shared as well.
+func SharedNodeCount[T any](a, b *RadixTree[T]) int {
+	nodes := make(map[Node[T]]struct{})
+	walkNodes(a.root, func(n Node[T]) bool {
+		nodes[n] = struct{}{}
+		return true
+	})
+	shared := 0
+	walkNodes(b.root, func(n Node[T]) bool {
+		if _, ok := nodes[n]; ok {
+			shared += countNodes(n)
+			return false
+		}
+		return true
+	})
+	return shared
+}
+
+// walkNodes calls fn for n and every node below it, own leaves included,
+// descending below a node only if fn returns true for it.
+func walkNodes[T any](n Node[T], fn func(Node[T]) bool) {
+	if n == nil || !fn(n) {
+		return
+	}
+	if l := n.getNodeLeaf(); l != nil {
+		walkNodes[T](l, fn)
+	}
+	children := n.getChildren()
+	if t := n.getArtNodeType(); t == node4 || t == node16 {
+		children = children[:numChildren(n)]
+	}
+	for _, e := range children {
+		walkNodes(e, fn)
+	}
+}
+
+// countNodes returns the number of nodes at and below n.
+func countNodes[T any](n Node[T]) int {
+	count := 0
+	walkNodes(n, func(Node[T]) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+// changedSince yields the leaves below n with an id above maxId, returning
+// false if yield asked to stop.
+func changedSince[T any](n Node[T], maxId uint64, yield func([]byte, T) bool) bool {
+	if n == nil || n.getId() <= maxId {
+		return true
+	}
+	l := n.getNodeLeaf()
+	if n.getArtNodeType() == leafType {
+		l = n.(*NodeLeaf[T])
+	}
+	if l != nil && l.getId() > maxId && len(l.getKey()) > 0 && !yield(l.userKey(), l.getValue()) {
+		return false
+	}
+	if n.getArtNodeType() == node48 {
+		for i := 0; i < 256; i++ {
+			if idx := n.getKeyAtIdx(i); idx != 0 && !changedSince(n.getChild(int(idx-1)), maxId, yield) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, e := range n.getChildren() {
+		if !changedSince(e, maxId, yield) {
+			return false
+		}
+	}
+	return true
+}
+
+// WalkTyped walks a tree holding values of any type, calling fn only for the
+// entries whose value is a U and skipping all others. fn returns true to stop
+// the walk, as with Walk.
+func WalkTyped[U any](t *RadixTree[any], fn func(k []byte, v U) bool) {
+	t.Walk(func(k []byte, v any) bool {
+		u, ok := v.(U)
+		return ok && fn(k, u)
+	})
+}
+
+// Sample returns up to n keys chosen uniformly at random from the tree. The
+// keys are picked by reservoir sampling during a single walk, so the whole key
+// set is never materialized, and the same seed always yields the same sample
+// for the same tree. If n is at least Len all keys are returned in order.
+func (t *RadixTree[T]) Sample(n int, seed int64) [][]byte {
+	if n <= 0 || t.Len() == 0 {
+		return nil
+	}
+	rnd := rand.New(rand.NewSource(seed))
+	sample := make([][]byte, 0, min(n, t.Len()))
+	seen := 0
+	t.Walk(func(k []byte, v T) bool {
+		if seen < n {
+			sample = append(sample, k)
+		} else if j := rnd.Intn(seen + 1); j < n {
+			sample[j] = k
+		}
+		seen++
+		return false
+	})
+	return sample
+}
+
+// RangeBound is the key range [Lo, Hi) as taken by Range. A nil Lo starts at
+// the first key and a nil Hi runs to the last one.
+type RangeBound struct {
+	Lo, Hi []byte
+}
+
+// splitSamplesPerRange is how many sampled keys Split draws for each range,
+// which keeps the ranges close in size for large trees.
+const splitSamplesPerRange = 256
+
+// Split divides the tree's keys into at most n ranges holding roughly the same
+// number of keys each, so that parallel consumers can each scan one of them.
+// The ranges are in order, do not overlap and together cover every key, with
+// the first starting and the last ending unbounded. The boundaries are picked
+// from a sample of the keys, so they are the same for the same tree. Fewer
+// than n ranges are returned when the tree has fewer than n keys, and an
+// empty tree gives a single range.
+func (t *RadixTree[T]) Split(n int) []RangeBound {
+	if n <= 0 {
+		return nil
+	}
+	sample := t.Sample(n*splitSamplesPerRange, 0)
+	if t.opts.KeyTransform != nil {
+		// The tree is ordered by the normalized keys
+		for i, k := range sample {
+			sample[i] = t.opts.KeyTransform(k)
+		}
+	}
+	slices.SortFunc(sample, bytes.Compare)
+
+	ranges := make([]RangeBound, 0, n)
+	var lo []byte
+	for i := 1; i < n; i++ {
+		// With fewer keys than ranges some boundaries repeat, and a range
+		// ending at the first key would be empty
+		j := i * len(sample) / n
+		if j == 0 || bytes.Equal(sample[j], lo) {
+			continue
+		}
+		hi := sample[j]
+		ranges = append(ranges, RangeBound{lo, hi})
+		lo = hi
+	}
+	return append(ranges, RangeBound{lo, nil})
+}
+
+// Partitions splits the tree into trees of at most approxSize keys each and
+// yields them in key order, so that each can be processed independently.
+// Together they hold every key exactly once. Each partition holds the keys of
+// a run of neighbouring subtrees of one node, taken until the next would not
+// fit, so most partitions come close to approxSize. A partition shares its
+// subtrees with the tree rather than copying them, so it is cheap to make
+// and, being immutable, safe to hand to another goroutine.
+// Partitions are meant for reading: a watched write to one closes the watch
+// channels of the nodes it shares with the tree. A tree of at most approxSize
+// keys is yielded whole.
+func (t *RadixTree[T]) Partitions(approxSize int) iter.Seq[*RadixTree[T]] {
+	return func(yield func(*RadixTree[T]) bool) {
+		if t.Len() == 0 {
+			return
+		}
+		if t.Len() <= approxSize {
+			yield(t)
+			return
+		}
+		t.partition(t.root, 0, max(approxSize, 1), yield)
+	}
+}
+
+// partition yields the keys below n, whose prefix starts at byte depth of its
+// keys, grouped into partitions of at most size keys where the subtrees allow.
+// It returns false once yield asks to stop.
+func (t *RadixTree[T]) partition(n Node[T], depth, size int, yield func(*RadixTree[T]) bool) bool {
+	depth += int(n.getPartialLen())
+
+	var leaf *NodeLeaf[T]
+	var keys []byte
+	var children []Node[T]
+	count := 0
+	if l := n.getNodeLeaf(); l != nil && len(l.getKey()) > 0 {
+		leaf, count = l, 1
+	}
+	flush := func() bool {
+		if count == 0 {
+			return true
+		}
+		p := t.partitionTree(leaf, keys, children, depth, count)
+		leaf, keys, children, count = nil, nil, nil, 0
+		return yield(p)
+	}
+
+	ok := true
+	visit := func(c byte, ch Node[T]) {
+		if !ok {
+			return
+		}
+		chSize := subtreeSize(ch)
+		if chSize > size {
+			ok = flush() && t.partition(ch, depth+1, size, yield)
+			return
+		}
+		if count > 0 && count+chSize > size {
+			ok = flush()
+		}
+		keys = append(keys, c)
+		children = append(children, ch)
+		count += chSize
+	}
+	switch n.getArtNodeType() {
+	case node4, node16:
+		for i := 0; i < numChildren(n); i++ {
+			if ch := n.getChild(i); ch != nil {
+				visit(n.getKeyAtIdx(i), ch)
+			}
+		}
+	case node48:
+		for c := 0; c < 256; c++ {
+			if idx := n.getKeyAtIdx(c); idx != 0 {
+				if ch := n.getChild(int(idx - 1)); ch != nil {
+					visit(byte(c), ch)
+				}
+			}
+		}
+	case node256:
+		for c := 0; c < 256; c++ {
+			if ch := n.getChild(c); ch != nil {
+				visit(byte(c), ch)
+			}
+		}
+	}
+	return ok && flush()
+}
+
+// partitionTree returns a tree holding leaf, if it is set, and children along
+// the edges for keys. Its root stands in for the node they came from, with the
+// first depth bytes of their keys as its prefix.
+func (t *RadixTree[T]) partitionTree(leaf *NodeLeaf[T], keys []byte, children []Node[T], depth, count int) *RadixTree[T] {
+	txn := &Txn[T]{tree: &RadixTree[T]{maxNodeId: t.maxNodeId, opts: t.opts}}
+	ntype := node256
+	switch {
+	case len(children) <= 4:
+		ntype = node4
+	case len(children) <= 16:
+		ntype = node16
+	case len(children) <= 48:
+		ntype = node48
+	}
+	n := txn.allocNode(ntype)
+	l := leaf
+	if l == nil {
+		l = minimum[T](children[0])
+	}
+	n.setPartialLen(uint32(depth))
+	copy(n.getPartial(), l.getKey()[:min(maxPrefixLen, depth)])
+	if leaf != nil {
+		n.setNodeLeaf(leaf)
+	}
+	for i, ch := range children {
+		n = txn.addChild(n, keys[i], ch)
+	}
+	return &RadixTree[T]{
+		n,
+		uint64(count),
+		txn.tree.maxNodeId,
+		t.generation,
+		t.opts,
+	}
+}
+
 func (t *RadixTree[T]) DFS(fn DfsFn[T]) {
 	t.DFSNode(t.root, fn)
 }
@@ -365,7 +1358,7 @@ func (t *RadixTree[T]) DFSPrintTreeUtil(node Node[T], depth int) {
 	for i := 0; i < depth*5; i++ {
 		stPadding += " "
 	}
-	fmt.Print(stPadding + "id -> " + strconv.Itoa(int(node.getId())) + " type -> " + strconv.Itoa(int(node.getArtNodeType())))
+	fmt.Print(stPadding + "id -> " + strconv.Itoa(int(node.getId())) + " type -> " + NodeTypeName(node))
 	fmt.Print(" key -> " + string(node.getKey()))
 	fmt.Print(" partial -> " + string(node.getPartial()))
 	fmt.Print(" num ch -> " + string(strconv.Itoa(int(node.getNumChildren()))))
@@ -386,15 +1379,42 @@ func (t *RadixTree[T]) DFSPrintTree() {
 	t.DFSPrintTreeUtil(t.root, 0)
 }
 
+// subtreeSize counts the keys stored at and below n.
+func subtreeSize[T any](n Node[T]) int {
+	size := 0
+	recursiveWalk(n, func(k []byte, v T) bool {
+		size++
+		return false
+	})
+	return size
+}
+
 // recursiveWalk is used to do a pre-order walk of a node
 // recursively. Returns true if the walk should be aborted
 func recursiveWalk[T any](n Node[T], fn WalkFn[T]) bool {
-	// Visit the leaf values if any
-	if n.isLeaf() && n.getNodeLeaf() != nil && fn(getKey(n.getNodeLeaf().getKey()), n.getValue()) {
+	// Visit the leaf values if any. The empty root of an empty tree carries a
+	// leaf with no key at all, which is not a stored key.
+	l := n.getNodeLeaf()
+	if n.getArtNodeType() == leafType {
+		l = n.(*NodeLeaf[T])
+	}
+	if l != nil && len(l.getKey()) > 0 && fn(l.userKey(), l.getValue()) {
 		return true
 	}
 
-	// Recurse on the children
+	// Recurse on the children in key order
+	if n.getArtNodeType() == node48 {
+		for i := 0; i < 256; i++ {
+			idx := n.getKeyAtIdx(i)
+			if idx == 0 {
+				continue
+			}
+			if e := n.getChild(int(idx - 1)); e != nil && recursiveWalk(e, fn) {
+				return true
+			}
+		}
+		return false
+	}
 	for _, e := range n.getChildren() {
 		if e != nil {
 			if recursiveWalk(e, fn) {
@@ -405,6 +1425,44 @@ func recursiveWalk[T any](n Node[T], fn WalkFn[T]) bool {
 	return false
 }
 
+// walkKeyLen walks the keys below n whose stored length, terminator
+// included, is keyLen, given that n's prefix starts at byte depth. Returns
+// true if the walk should be aborted.
+func walkKeyLen[T any](n Node[T], depth, keyLen int, fn WalkFn[T]) bool {
+	l := n.getNodeLeaf()
+	if n.getArtNodeType() == leafType {
+		l = n.(*NodeLeaf[T])
+	}
+	if l != nil && len(l.getKey()) == keyLen && fn(l.userKey(), l.getValue()) {
+		return true
+	}
+
+	// Every key below the children is at least one byte longer than the
+	// bytes leading to them
+	depth += int(n.getPartialLen())
+	if depth+1 > keyLen {
+		return false
+	}
+	if n.getArtNodeType() == node48 {
+		for i := 0; i < 256; i++ {
+			idx := n.getKeyAtIdx(i)
+			if idx == 0 {
+				continue
+			}
+			if e := n.getChild(int(idx - 1)); e != nil && walkKeyLen(e, depth+1, keyLen, fn) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, e := range n.getChildren() {
+		if e != nil && walkKeyLen(e, depth+1, keyLen, fn) {
+			return true
+		}
+	}
+	return false
+}
+
 type DfsFn[T any] func(n Node[T])
 
 // recursiveWalk is used to do a pre-order walk of a node
@@ -5,15 +5,22 @@ package adaptive
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"github.com/hashicorp/go-uuid"
 	"github.com/stretchr/testify/require"
+	"maps"
 	"math/rand"
 	"os"
 	"slices"
 	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"testing/quick"
 	"time"
+	"unique"
+	"unsafe"
 )
 
 func TestRadix_HugeTxn(t *testing.T) {
@@ -160,6 +167,64 @@ func TestARTree_InsertVeryLongKey(t *testing.T) {
 	require.Equal(t, art.size, uint64(2))
 }
 
+func TestARTree_InsertMegabyteKey(t *testing.T) {
+	t.Parallel()
+
+	key := bytes.Repeat([]byte("a"), 1<<20)
+	sibling := append(bytes.Repeat([]byte("a"), 1<<20), 'b')
+
+	art := NewRadixTree[int]()
+	art, _, _ = art.Insert(key, 1)
+	art, _, _ = art.Insert(sibling, 2)
+
+	// A chain of keys that each extend the previous one by a single byte
+	// builds a tree that is one level deeper per key.
+	txn := art.Txn(false)
+	for i := 1; i <= 2000; i++ {
+		txn.Insert(bytes.Repeat([]byte("a"), i), -i)
+	}
+	art = txn.Commit()
+	require.Equal(t, 2002, art.Len())
+
+	v, ok := art.Get(key)
+	require.True(t, ok)
+	require.Equal(t, 1, v)
+	v, ok = art.Get(sibling)
+	require.True(t, ok)
+	require.Equal(t, 2, v)
+	v, ok = art.Get(bytes.Repeat([]byte("a"), 2000))
+	require.True(t, ok)
+	require.Equal(t, -2000, v)
+
+	art, _, ok = art.Delete(key)
+	require.True(t, ok)
+	_, ok = art.Get(key)
+	require.False(t, ok)
+	v, ok = art.Get(sibling)
+	require.True(t, ok)
+	require.Equal(t, 2, v)
+	require.Equal(t, 2001, art.Len())
+}
+
+func TestDelete_MissingKey(t *testing.T) {
+	r := NewRadixTree[int]()
+	keys := []string{"abc", "abd", "xyz", "xyw"}
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	for _, missing := range []string{"q", "abz", "ab", "abcd", "xy", ""} {
+		nr, _, ok := r.Delete([]byte(missing))
+		require.False(t, ok, "key %q", missing)
+		require.Equal(t, len(keys), nr.Len())
+		for i, k := range keys {
+			v, found := nr.Get([]byte(k))
+			require.True(t, found, "lost %q deleting %q", k, missing)
+			require.Equal(t, i, v)
+		}
+	}
+}
+
 func TestARTree_InsertAndSearchAndDeleteWords(t *testing.T) {
 	t.Parallel()
 
@@ -978,6 +1043,21 @@ func TestDeletePrefix(t *testing.T) {
 				"RA",
 			},
 		},
+		{
+			"prefix matches a child between others",
+			[]string{
+				"a1",
+				"b",
+				"c1",
+				"c2",
+			},
+			"b",
+			[]string{
+				"a1",
+				"c1",
+				"c2",
+			},
+		},
 	}
 
 	for _, testCase := range cases {
@@ -997,7 +1077,11 @@ func TestDeletePrefix(t *testing.T) {
 				t.Fatalf("Bad tree length, got %d want %d tree %v, deleting prefix %v ", got, want, testCase.treeNodes, testCase.prefix)
 			}
 
-			//verifyTree(t, testCase.expectedOut, r)
+			require.Equal(t, testCase.expectedOut, walkKeys(r))
+			for _, k := range testCase.expectedOut {
+				require.True(t, r.Contains([]byte(k)), "key %q", k)
+			}
+			verifyTree(t, r)
 			//Delete a non-existant node
 			r, ok = r.DeletePrefix([]byte("CCCCC"))
 			if ok {
@@ -1007,6 +1091,39 @@ func TestDeletePrefix(t *testing.T) {
 	}
 }
 
+func TestDeletePrefix_ShrinksNodes(t *testing.T) {
+	build := func() *RadixTree[int] {
+		r := NewRadixTree[int]()
+		for c := 0; c < 256; c++ {
+			r, _, _ = r.Insert([]byte{'p', '/', byte(c), 'x'}, c)
+		}
+		r, _, _ = r.Insert([]byte("q"), -1)
+		require.Equal(t, 1, r.Stats().Node256)
+		return r
+	}
+
+	// One tree per deletion, so every node on the way is copied, and one
+	// transaction, so they are changed in place after the first copy
+	r := build()
+	for c := 0; c < 254; c++ {
+		r, _ = r.DeletePrefix([]byte{'p', '/', byte(c)})
+	}
+	txn := build().Txn(false)
+	for c := 0; c < 254; c++ {
+		txn.DeletePrefix([]byte{'p', '/', byte(c)})
+	}
+
+	for _, r := range []*RadixTree[int]{r, txn.Commit()} {
+		stats := r.Stats()
+		require.Zero(t, stats.Node256)
+		require.Zero(t, stats.Node48)
+		require.Zero(t, stats.Node16)
+		require.Equal(t, 3, stats.Leaves)
+		require.Equal(t, []string{"p/\xfex", "p/\xffx", "q"}, walkKeys(r))
+		verifyTree(t, r)
+	}
+}
+
 func TestIteratePrefix(t *testing.T) {
 	r := NewRadixTree[any]()
 
@@ -1191,6 +1308,45 @@ func TestTrackMutate_DeletePrefix(t *testing.T) {
 
 }
 
+func TestTrackMutate_DeletePrefixCollapse(t *testing.T) {
+	r := NewRadixTree[any]()
+	for _, k := range []string{"foo/a/1", "foo/a/2", "foo/b/1", "foo/b/2", "zip"} {
+		r, _, _ = r.Insert([]byte(k), nil)
+	}
+
+	// The node holding "foo/" only branches between the two subtrees, so it
+	// is collapsed into the remaining one once the other is deleted
+	prefixWatch := r.Root().Iterator().SeekPrefixWatch([]byte("foo/"))
+	leafWatch, _, _ := r.GetWatch([]byte("foo/b/1"))
+	unrelatedWatch, _, _ := r.GetWatch([]byte("zip"))
+
+	txn := r.Txn(false)
+	txn.TrackMutate(true)
+	if !txn.DeletePrefix([]byte("foo/b")) {
+		t.Fatalf("Expected delete prefix to return true")
+	}
+	r = txn.Commit()
+
+	select {
+	case <-prefixWatch:
+	default:
+		t.Fatalf("prefix watch was not triggered")
+	}
+	select {
+	case <-leafWatch:
+	default:
+		t.Fatalf("leaf watch was not triggered")
+	}
+	select {
+	case <-unrelatedWatch:
+		t.Fatalf("unrelated watch was triggered")
+	default:
+	}
+
+	require.Equal(t, []string{"foo/a/1", "foo/a/2", "zip"}, walkKeys(r))
+	verifyTree(t, r)
+}
+
 // hasAnyClosedMutateCh scans the given tree and returns true if there are any
 // closed mutate channels on any nodes or leaves.
 func hasAnyClosedMutateCh[T any](r *RadixTree[T]) bool {
@@ -1854,6 +2010,88 @@ func TestTreeInsertAndDeleteAllUUIDs(t *testing.T) {
 	}
 
 	require.Equal(t, uint64(0), tree.size)
+	verifyTree(t, tree)
+	require.Equal(t, 1, nodeCount(tree))
+}
+
+func TestDeleteCompacts(t *testing.T) {
+	uuids := loadTestFile("test-text/uuid.txt")[:20000]
+	r := NewRadixTree[int]()
+	for i, w := range uuids {
+		r, _, _ = r.Insert(w, i)
+	}
+	// Keys that are prefixes of other keys give internal nodes their own
+	// leaves, which must be folded away when deleted.
+	for i, w := range uuids[:len(uuids)/2] {
+		r, _, _ = r.Insert(w[:len(w)-i%8-1], i)
+	}
+	verifyTree(t, r)
+
+	rnd := rand.New(rand.NewSource(3))
+	keep := NewRadixTree[int]()
+	r.Walk(func(k []byte, v int) bool {
+		if rnd.Intn(2) == 0 {
+			r, _, _ = r.Delete(k)
+		} else {
+			keep, _, _ = keep.Insert(k, v)
+		}
+		return false
+	})
+	verifyTree(t, r)
+	require.Equal(t, keep.Len(), r.Len())
+
+	// A tree shrunk by deletes holds no more nodes than one built directly
+	// from the keys that are left.
+	require.Equal(t, nodeCount(keep), nodeCount(r))
+
+	keep.Walk(func(k []byte, v int) bool {
+		r, _, _ = r.Delete(k)
+		return false
+	})
+	verifyTree(t, r)
+	require.Equal(t, 1, nodeCount(r))
+}
+
+// nodeCount returns the number of internal nodes in the tree.
+func nodeCount[T any](r *RadixTree[T]) int {
+	count := 0
+	it := r.RawIterator()
+	for it.Next(); it.Front() != nil; it.Next() {
+		if it.Front().getArtNodeType() != leafType {
+			count++
+		}
+	}
+	return count
+}
+
+// verifyTree checks that no internal node below the root is left empty or
+// holds a single child without a leaf of its own, and that the tree's size
+// matches the number of keys stored in it.
+func verifyTree[T any](t *testing.T, r *RadixTree[T]) {
+	t.Helper()
+	leaves := 0
+	it := r.RawIterator()
+	for it.Next(); it.Front() != nil; it.Next() {
+		n := it.Front()
+		if n.getArtNodeType() == leafType {
+			leaves++
+			continue
+		}
+		children := 0
+		for _, ch := range n.getChildren() {
+			if ch != nil {
+				children++
+			}
+		}
+		require.Equal(t, numChildren(n), children, "path %q", it.Path())
+		if n == r.root {
+			continue
+		}
+		if n.getNodeLeaf() == nil {
+			require.Greater(t, children, 1, "path %q", it.Path())
+		}
+	}
+	require.Equal(t, r.Len(), leaves)
 }
 
 func BenchmarkGroupedOperations(b *testing.B) {
@@ -1888,6 +2126,67 @@ func BenchmarkInsertART(b *testing.B) {
 	}
 }
 
+func BenchmarkInsertART_DisableWatch(b *testing.B) {
+	r := NewRadixTreeWithOptions[int](Options{DisableWatch: true})
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		uuid1, _ := uuid.GenerateUUID()
+		r, _, _ = r.Insert([]byte(uuid1), n)
+	}
+}
+
+// arenaAllocator hands out nodes from chunks of 1024, making one heap
+// allocation per chunk instead of one per node.
+type arenaAllocator[T any] struct {
+	leaves []NodeLeaf[T]
+	n4s    []Node4[T]
+	n16s   []Node16[T]
+	n48s   []Node48[T]
+	n256s  []Node256[T]
+}
+
+func arenaNext[N any](chunk *[]N) *N {
+	if len(*chunk) == 0 {
+		*chunk = make([]N, 1024)
+	}
+	n := &(*chunk)[0]
+	*chunk = (*chunk)[1:]
+	return n
+}
+
+func (a *arenaAllocator[T]) NewLeaf() *NodeLeaf[T]   { return arenaNext(&a.leaves) }
+func (a *arenaAllocator[T]) NewNode4() *Node4[T]     { return arenaNext(&a.n4s) }
+func (a *arenaAllocator[T]) NewNode16() *Node16[T]   { return arenaNext(&a.n16s) }
+func (a *arenaAllocator[T]) NewNode48() *Node48[T]   { return arenaNext(&a.n48s) }
+func (a *arenaAllocator[T]) NewNode256() *Node256[T] { return arenaNext(&a.n256s) }
+
+func BenchmarkInsertTxn_Allocator(b *testing.B) {
+	keys := make([][]byte, 100_000)
+	for i := range keys {
+		uuid1, _ := uuid.GenerateUUID()
+		keys[i] = []byte(uuid1)
+	}
+	for _, bc := range []struct {
+		name  string
+		alloc func() any
+	}{
+		{"default", func() any { return nil }},
+		{"arena", func() any { return &arenaAllocator[int]{} }},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				r := NewRadixTreeWithOptions[int](Options{DisableWatch: true, Allocator: bc.alloc()})
+				txn := r.Txn(false)
+				for i, k := range keys {
+					txn.Insert(k, i)
+				}
+				txn.Commit()
+			}
+		})
+	}
+}
+
 func BenchmarkSearchART(b *testing.B) {
 	r := NewRadixTree[int]()
 	b.ResetTimer()
@@ -1974,6 +2273,31 @@ func BenchmarkSeekLowerBound(b *testing.B) {
 	}
 }
 
+// BenchmarkSeekLowerBound_Min seeks to the empty key and to the smallest key
+// in the tree, which should cost about the same.
+func BenchmarkSeekLowerBound_Min(b *testing.B) {
+	r := NewRadixTree[int]()
+	for i, k := range loadTestFile("test-text/words.txt") {
+		r, _, _ = r.Insert(k, i)
+	}
+	first := getKey(r.Minimum().getKey())
+	for _, bc := range []struct {
+		name string
+		key  []byte
+	}{{"Empty", nil}, {"MinKey", first}} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				it := r.root.LowerBoundIterator()
+				it.SeekLowerBound(bc.key)
+				if _, _, ok := it.Next(); !ok {
+					b.Fatal("no key")
+				}
+			}
+		})
+	}
+}
+
 func BenchmarkSeekReverseLowerBound(b *testing.B) {
 	r := NewRadixTree[int]()
 	b.ResetTimer()
@@ -1996,3 +2320,3203 @@ func BenchmarkSeekReverseLowerBound(b *testing.B) {
 		}
 	}
 }
+
+func TestGetMulti(t *testing.T) {
+	r := NewRadixTree[int]()
+	keys := []string{
+		"",
+		"foo",
+		"foobar",
+		"foobarbaz",
+		"foozip",
+		"zip",
+	}
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	lookup := [][]byte{
+		[]byte("foozip"),
+		[]byte("nope"),
+		[]byte("foo"),
+		[]byte(""),
+		[]byte("foobarbaz"),
+		[]byte("fooba"),
+		[]byte("zip"),
+		[]byte("foo"),
+	}
+	values, found := r.GetMulti(lookup)
+	require.Len(t, values, len(lookup))
+	require.Len(t, found, len(lookup))
+	for i, k := range lookup {
+		v, ok := r.Get(k)
+		require.Equal(t, ok, found[i], "key %q", k)
+		require.Equal(t, v, values[i], "key %q", k)
+	}
+
+	uuids := loadTestFile("test-text/uuid.txt")
+	r = NewRadixTree[int]()
+	for i, w := range uuids {
+		r, _, _ = r.Insert(w, i)
+	}
+	values, found = r.GetMulti(uuids)
+	for i := range uuids {
+		require.True(t, found[i])
+		require.Equal(t, i, values[i])
+	}
+}
+
+func BenchmarkGetMulti(b *testing.B) {
+	r := NewRadixTree[int]()
+	keys := make([][]byte, 1000)
+	for i := range keys {
+		uuid1, _ := uuid.GenerateUUID()
+		keys[i] = []byte(uuid1)
+		r, _, _ = r.Insert(keys[i], i)
+	}
+	slices.SortFunc(keys, bytes.Compare)
+
+	b.Run("GetMulti", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			r.GetMulti(keys)
+		}
+	})
+	b.Run("Get", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			for _, k := range keys {
+				r.Get(k)
+			}
+		}
+	})
+}
+
+func TestLongestPrefix_Random(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	r := NewRadixTree[int]()
+	var keys []string
+	for i := 0; i < 5000; i++ {
+		b := make([]byte, rnd.Intn(12))
+		for j := range b {
+			b[j] = "abc/"[rnd.Intn(4)]
+		}
+		keys = append(keys, string(b))
+		r, _, _ = r.Insert(b, i)
+	}
+
+	for i := 0; i < 5000; i++ {
+		b := make([]byte, rnd.Intn(16))
+		for j := range b {
+			b[j] = "abc/"[rnd.Intn(4)]
+		}
+		want := ""
+		wantOk := false
+		for _, k := range keys {
+			if strings.HasPrefix(string(b), k) && (!wantOk || len(k) > len(want)) {
+				want, wantOk = k, true
+			}
+		}
+		m, _, ok := r.LongestPrefix(b)
+		require.Equal(t, wantOk, ok, "input %q", b)
+		require.Equal(t, want, string(m), "input %q", b)
+	}
+}
+
+func TestLongestPrefix_EmptyKey(t *testing.T) {
+	r := NewRadixTree[int]()
+	r, _, _ = r.Insert([]byte(""), 1)
+	r, _, _ = r.Insert([]byte("foo"), 2)
+	for in, want := range map[string]string{
+		"":       "",
+		"bar":    "",
+		"fo":     "",
+		"foo":    "foo",
+		"foobar": "foo",
+		"$":      "",
+		"foo$":   "foo",
+	} {
+		m, _, ok := r.LongestPrefix([]byte(in))
+		require.True(t, ok, "input %q", in)
+		require.Equal(t, want, string(m), "input %q", in)
+	}
+
+	// The empty key matches whatever the shape of the tree around it
+	for _, keys := range [][]string{{""}, {"", "$"}, {"", "$$", "$a"}, {"", "abcdefghijklmnop"}} {
+		r := NewRadixTree[int]()
+		for _, k := range keys {
+			r, _, _ = r.Insert([]byte(k), 0)
+		}
+		for _, in := range []string{"b", "ab", "abcdefghijklmnoz"} {
+			m, _, ok := r.LongestPrefix([]byte(in))
+			require.True(t, ok, "keys %q input %q", keys, in)
+			require.Equal(t, "", string(m), "keys %q input %q", keys, in)
+		}
+	}
+
+	// Without it, a root left holding a single key after a delete must
+	// still match the search against the root's prefix
+	r = NewRadixTree[int]()
+	r, _, _ = r.Insert([]byte(""), 0)
+	r, _, _ = r.Insert([]byte("$"), 0)
+	r, _, _ = r.Delete([]byte(""))
+	_, _, ok := r.LongestPrefix([]byte("b"))
+	require.False(t, ok)
+	m, _, ok := r.LongestPrefix([]byte("$b"))
+	require.True(t, ok)
+	require.Equal(t, "$", string(m))
+}
+
+func BenchmarkLongestPrefixDeep(b *testing.B) {
+	r := NewRadixTree[int]()
+	txn := r.Txn(false)
+	prefix := ""
+	for depth := 0; depth < 64; depth++ {
+		txn.Insert([]byte(prefix), depth)
+		for c := 0; c < 256; c++ {
+			txn.Insert([]byte(prefix+string([]byte{byte(c), 'x'})), c)
+		}
+		prefix += "a"
+	}
+	r = txn.Commit()
+	search := []byte(prefix + "zzz")
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		r.LongestPrefix(search)
+	}
+}
+
+func TestGetFuzz(t *testing.T) {
+	r := NewRadixTree[string]()
+	set := make(map[string]string)
+
+	// Each call inserts a new random key and then looks up another random key,
+	// which must agree with a plain map holding the same set of keys.
+	radixInsertAndGet := func(newKey, searchKey readableString) (string, bool) {
+		r, _, _ = r.Insert([]byte(newKey), string(newKey))
+		return r.Get([]byte(searchKey))
+	}
+
+	mapInsertAndGet := func(newKey, searchKey readableString) (string, bool) {
+		set[string(newKey)] = string(newKey)
+		v, ok := set[string(searchKey)]
+		return v, ok
+	}
+
+	if err := quick.CheckEqual(radixInsertAndGet, mapInsertAndGet, &quick.Config{
+		MaxCount: 5000,
+	}); err != nil {
+		t.Error(err)
+	}
+
+	for k, v := range set {
+		got, ok := r.Get([]byte(k))
+		require.True(t, ok, "key %q", k)
+		require.Equal(t, v, got)
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	uuids := loadTestFile("test-text/uuid.txt")
+	r := NewRadixTree[int]()
+	for i, w := range uuids {
+		r, _, _ = r.Insert(w, i)
+	}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		r.Get(uuids[n%len(uuids)])
+	}
+}
+
+func TestSample(t *testing.T) {
+	r := NewRadixTree[int]()
+	for i, w := range loadTestFile("test-text/uuid.txt") {
+		r, _, _ = r.Insert(w, i)
+	}
+
+	s1 := r.Sample(10, 42)
+	s2 := r.Sample(10, 42)
+	require.Len(t, s1, 10)
+	require.Equal(t, s1, s2)
+	for _, k := range s1 {
+		_, ok := r.Get(k)
+		require.True(t, ok)
+	}
+	require.NotEqual(t, s1, r.Sample(10, 43))
+
+	all := r.Sample(r.Len()+5, 1)
+	require.Len(t, all, r.Len())
+	var keys [][]byte
+	r.Walk(func(k []byte, v int) bool {
+		keys = append(keys, k)
+		return false
+	})
+	require.Equal(t, keys, all)
+
+	require.Empty(t, r.Sample(0, 1))
+	require.Empty(t, NewRadixTree[int]().Sample(3, 1))
+}
+
+func TestMinimumMaximumPrefix(t *testing.T) {
+	r := NewRadixTree[int]()
+	keys := []string{
+		"bar",
+		"foo",
+		"foo/a",
+		"foo/b/c",
+		"foo/zip",
+		"foobar",
+		"zoo",
+	}
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	type exp struct {
+		prefix string
+		min    string
+		max    string
+	}
+	cases := []exp{
+		{"", "bar", "zoo"},
+		{"f", "foo", "foobar"},
+		{"foo", "foo", "foobar"},
+		{"foo/", "foo/a", "foo/zip"},
+		{"foo/b", "foo/b/c", "foo/b/c"},
+		{"foo/z", "foo/zip", "foo/zip"},
+		{"zoo", "zoo", "zoo"},
+	}
+	for _, c := range cases {
+		k, v, ok := r.MinimumPrefix([]byte(c.prefix))
+		require.True(t, ok, "prefix %q", c.prefix)
+		require.Equal(t, c.min, string(k), "prefix %q", c.prefix)
+		require.Equal(t, slices.Index(keys, c.min), v)
+
+		k, v, ok = r.MaximumPrefix([]byte(c.prefix))
+		require.True(t, ok, "prefix %q", c.prefix)
+		require.Equal(t, c.max, string(k), "prefix %q", c.prefix)
+		require.Equal(t, slices.Index(keys, c.max), v)
+	}
+
+	for _, prefix := range []string{"a", "baz", "foo/c", "foo/zipper", "fop", "zoom"} {
+		_, _, ok := r.MinimumPrefix([]byte(prefix))
+		require.False(t, ok, "prefix %q", prefix)
+		_, _, ok = r.MaximumPrefix([]byte(prefix))
+		require.False(t, ok, "prefix %q", prefix)
+	}
+
+	_, _, ok := NewRadixTree[int]().MinimumPrefix(nil)
+	require.False(t, ok)
+}
+
+func TestWalk(t *testing.T) {
+	rnd := rand.New(rand.NewSource(7))
+	r := NewRadixTree[int]()
+	expect := make(map[string]int)
+	for i := 0; i < 3000; i++ {
+		// A wide first byte produces node48 and node256 parents, and the short
+		// alphabet afterwards produces keys that are prefixes of others.
+		b := []byte{byte(rnd.Intn(60))}
+		for j := rnd.Intn(6); j > 0; j-- {
+			b = append(b, "ab"[rnd.Intn(2)])
+		}
+		r, _, _ = r.Insert(b, i)
+		expect[string(b)] = i
+	}
+
+	var keys []string
+	for k := range expect {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var out []string
+	r.Walk(func(k []byte, v int) bool {
+		require.Equal(t, expect[string(k)], v, "key %q", k)
+		out = append(out, string(k))
+		return false
+	})
+	require.Equal(t, keys, out)
+
+	NewRadixTree[int]().Walk(func(k []byte, v int) bool {
+		t.Fatalf("walked %q on an empty tree", k)
+		return false
+	})
+}
+
+func TestTxn_CloneIsolation(t *testing.T) {
+	r := NewRadixTree[int]()
+	for i, k := range []string{"foo", "foobar", "zip"} {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	txn := r.Txn(false)
+	txn.Insert([]byte("pending/a"), 10)
+	txn.Insert([]byte("pending/b"), 11)
+	txn.Insert([]byte("foo"), 12)
+
+	clone := txn.Clone(false)
+	txn.Insert([]byte("pending/c"), 20)
+	txn.Insert([]byte("foobaz"), 21)
+	txn.Delete([]byte("zip"))
+	clone.Insert([]byte("pending/d"), 30)
+	clone.Insert([]byte("foobat"), 31)
+	clone.Insert([]byte("foo"), 32)
+
+	collect := func(tree *RadixTree[int]) map[string]int {
+		out := make(map[string]int)
+		tree.Walk(func(k []byte, v int) bool {
+			out[string(k)] = v
+			return false
+		})
+		return out
+	}
+
+	require.Equal(t, map[string]int{
+		"foo":       12,
+		"foobar":    1,
+		"foobaz":    21,
+		"pending/a": 10,
+		"pending/b": 11,
+		"pending/c": 20,
+	}, collect(txn.Commit()))
+	require.Equal(t, map[string]int{
+		"foo":       32,
+		"foobar":    1,
+		"foobat":    31,
+		"pending/a": 10,
+		"pending/b": 11,
+		"pending/d": 30,
+		"zip":       2,
+	}, collect(clone.Commit()))
+	require.Equal(t, map[string]int{
+		"foo":    0,
+		"foobar": 1,
+		"zip":    2,
+	}, collect(r))
+}
+
+func TestGeneration(t *testing.T) {
+	r := NewRadixTree[int]()
+	require.Equal(t, uint64(0), r.Generation())
+
+	r, _, _ = r.Insert([]byte("foo"), 1)
+	require.Equal(t, uint64(1), r.Generation())
+
+	txn := r.Txn(false)
+	txn.Insert([]byte("bar"), 2)
+	txn.Insert([]byte("baz"), 3)
+	txn.Delete([]byte("foo"))
+	r = txn.Commit()
+	require.Equal(t, uint64(2), r.Generation())
+
+	// A transaction that changes nothing still advances the generation.
+	r = r.Txn(false).Commit()
+	require.Equal(t, uint64(3), r.Generation())
+
+	r, _, _ = r.Delete([]byte("missing"))
+	require.Equal(t, uint64(4), r.Generation())
+
+	require.Equal(t, r.Generation(), r.Clone(false).Generation())
+	require.Equal(t, r.Generation()+1, r.Txn(false).Clone(false).CommitOnly().Generation())
+}
+
+func TestDeleteChildren(t *testing.T) {
+	r := NewRadixTree[int]()
+	keys := []string{"foo", "foo/", "foo/a", "foo/a/b", "foo/b", "foo/b/", "foobar", "zip/a"}
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	r, ok := r.DeleteChildren([]byte("foo/"), '/')
+	require.True(t, ok)
+	var out []string
+	r.Walk(func(k []byte, v int) bool {
+		out = append(out, string(k))
+		return false
+	})
+	require.Equal(t, []string{"foo", "foo/", "foo/a/b", "foo/b/", "foobar", "zip/a"}, out)
+	require.Equal(t, len(out), r.Len())
+
+	r, ok = r.DeleteChildren([]byte("foo/"), '/')
+	require.False(t, ok)
+	require.Equal(t, len(out), r.Len())
+
+	r, ok = r.DeleteChildren([]byte("foo/a/"), '/')
+	require.True(t, ok)
+	_, found := r.Get([]byte("foo/a/b"))
+	require.False(t, found)
+	require.Equal(t, len(out)-1, r.Len())
+}
+
+func TestRenamePrefix(t *testing.T) {
+	r := NewRadixTree[int]()
+	keys := []string{"bar/x", "foo", "foo/", "foo/a", "foo/a/b", "foo/b", "foobar", "zip"}
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	txn := r.Txn(false)
+	require.Equal(t, 4, txn.RenamePrefix([]byte("foo/"), []byte("bar/")))
+	r = txn.Commit()
+	require.Equal(t, []string{"bar/", "bar/a", "bar/a/b", "bar/b", "bar/x", "foo", "foobar", "zip"}, walkKeys(r))
+	for k, v := range map[string]int{"bar/": 2, "bar/a": 3, "bar/a/b": 4, "bar/b": 5, "bar/x": 0, "foo": 1} {
+		got, ok := r.Get([]byte(k))
+		require.True(t, ok, "key %q", k)
+		require.Equal(t, v, got, "key %q", k)
+	}
+	_, ok := r.Get([]byte("foo/a"))
+	require.False(t, ok)
+	verifyTree(t, r)
+
+	// A renamed key replaces the one stored under its new name
+	txn = r.Txn(false)
+	require.Equal(t, 1, txn.RenamePrefix([]byte("zip"), []byte("bar/x")))
+	v, _ := txn.Get([]byte("bar/x"))
+	require.Equal(t, 7, v)
+	require.Equal(t, 7, txn.GetTree().Len())
+
+	// The new prefix may extend the old one
+	txn = r.Txn(false)
+	require.Equal(t, 2, txn.RenamePrefix([]byte("foo"), []byte("foo/old/")))
+	require.Equal(t, []string{"bar/", "bar/a", "bar/a/b", "bar/b", "bar/x", "foo/old/", "foo/old/bar", "zip"}, walkKeys(txn.Commit()))
+
+	// Nothing moves for a missing prefix or a rename to the same prefix
+	txn = r.Txn(false)
+	require.Zero(t, txn.RenamePrefix([]byte("nope"), []byte("bar/")))
+	require.Equal(t, 5, txn.RenamePrefix([]byte("bar/"), []byte("bar/")))
+	require.False(t, txn.Dirty())
+
+	// With StrictNoOverwrite a key whose new name is taken stays put
+	r = NewRadixTreeWithOptions[int](Options{StrictNoOverwrite: true})
+	for i, k := range []string{"a/x", "a/y", "b/x", "a/a/y"} {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+	txn = r.Txn(false)
+	require.Equal(t, 2, txn.RenamePrefix([]byte("a/"), []byte("b/")))
+	r = txn.Commit()
+	require.Equal(t, []string{"a/x", "b/a/y", "b/x", "b/y"}, walkKeys(r))
+	v, _ = r.Get([]byte("a/x"))
+	require.Equal(t, 0, v)
+	v, _ = r.Get([]byte("b/x"))
+	require.Equal(t, 2, v)
+
+	// and so does a key that would move onto the name of a key kept in place
+	r = NewRadixTreeWithOptions[int](Options{StrictNoOverwrite: true})
+	for i, k := range []string{"a/a/b", "a/b", "a/c", "b"} {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+	txn = r.Txn(false)
+	require.Equal(t, 1, txn.RenamePrefix([]byte("a/"), nil))
+	require.Equal(t, []string{"a/a/b", "a/b", "b", "c"}, walkKeys(txn.Commit()))
+}
+
+func TestRetainPrefixes(t *testing.T) {
+	keys := []string{"", "bar", "bar/a", "ba", "baz", "fo", "foo", "foo/a", "foo/a/b", "foobar", "zip", "zip/foo"}
+	load := func() *Txn[int] {
+		r := NewRadixTree[int]()
+		for i, k := range keys {
+			r, _, _ = r.Insert([]byte(k), i)
+		}
+		return r.Txn(false)
+	}
+
+	txn := load()
+	require.Equal(t, 6, txn.RetainPrefixes([][]byte{[]byte("foo"), []byte("bar")}))
+	r := txn.Commit()
+	require.Equal(t, []string{"bar", "bar/a", "foo", "foo/a", "foo/a/b", "foobar"}, walkKeys(r))
+	v, ok := r.Get([]byte("foo/a"))
+	require.True(t, ok)
+	require.Equal(t, 7, v)
+	verifyTree(t, r)
+
+	// Overlapping and repeated prefixes keep the union of their keys
+	txn = load()
+	require.Equal(t, 9, txn.RetainPrefixes([][]byte{[]byte("foo/a/b"), []byte("foo/"), []byte("zip/"), []byte("foo/")}))
+	require.Equal(t, []string{"foo/a", "foo/a/b", "zip/foo"}, walkKeys(txn.Commit()))
+
+	// An empty prefix keeps everything, and no prefixes keep nothing
+	txn = load()
+	require.Zero(t, txn.RetainPrefixes([][]byte{[]byte("zzz"), nil}))
+	require.False(t, txn.Dirty())
+	txn = load()
+	require.Equal(t, len(keys), txn.RetainPrefixes(nil))
+	require.True(t, txn.Commit().IsEmpty())
+	require.Zero(t, NewRadixTree[int]().Txn(false).RetainPrefixes(nil))
+}
+
+func TestDeleteRangeFunc(t *testing.T) {
+	r := NewRadixTree[int]()
+	for i := 0; i < 100; i++ {
+		r, _, _ = r.Insert([]byte(fmt.Sprintf("key%03d", i)), i)
+	}
+	var watches []<-chan struct{}
+	for i := 0; i < 100; i++ {
+		ch, _, _ := r.GetWatch([]byte(fmt.Sprintf("key%03d", i)))
+		watches = append(watches, ch)
+	}
+
+	// Delete every other key in [key020, key040)
+	txn := r.Txn(false)
+	txn.TrackMutate(true)
+	var seen []string
+	n := txn.DeleteRangeFunc([]byte("key020"), []byte("key040"), func(k []byte, v int) bool {
+		seen = append(seen, string(k))
+		return v%2 == 0
+	})
+	require.Equal(t, 10, n)
+	require.Len(t, seen, 20)
+	require.Equal(t, "key020", seen[0])
+	require.Equal(t, "key039", seen[19])
+	r = txn.Commit()
+	require.Equal(t, 90, r.Len())
+
+	for i := 0; i < 100; i++ {
+		_, ok := r.Get([]byte(fmt.Sprintf("key%03d", i)))
+		deleted := i >= 20 && i < 40 && i%2 == 0
+		require.Equal(t, !deleted, ok, "key%03d", i)
+		select {
+		case <-watches[i]:
+			require.True(t, deleted, "watch for key%03d fired", i)
+		default:
+			require.False(t, deleted, "watch for key%03d did not fire", i)
+		}
+	}
+
+	// Nothing is deleted when the callback vetoes every key, or the range
+	// is empty
+	txn = r.Txn(false)
+	require.Equal(t, 0, txn.DeleteRangeFunc(nil, []byte("zzz"), func([]byte, int) bool { return false }))
+	require.Equal(t, 0, txn.DeleteRangeFunc([]byte("key050"), []byte("key050"), func([]byte, int) bool { return true }))
+	require.False(t, txn.Dirty())
+
+	// A nil lower bound starts at the first key
+	require.Equal(t, 10, txn.DeleteRangeFunc(nil, []byte("key010"), func([]byte, int) bool { return true }))
+	r = txn.Commit()
+	require.Equal(t, 80, r.Len())
+
+	// A nil upper bound runs to the last key
+	txn = r.Txn(false)
+	require.Equal(t, 10, txn.DeleteRangeFunc([]byte("key090"), nil, func([]byte, int) bool { return true }))
+	require.Equal(t, 70, txn.Commit().Len())
+	txn = r.Txn(false)
+	require.Equal(t, 80, txn.DeleteRangeFunc(nil, nil, func([]byte, int) bool { return true }))
+	require.Equal(t, 0, txn.Commit().Len())
+
+	empty := NewRadixTree[int]().Txn(false)
+	require.Equal(t, 0, empty.DeleteRangeFunc(nil, []byte("z"), func([]byte, int) bool { return true }))
+}
+
+func TestTxn_Abort(t *testing.T) {
+	r := NewRadixTree[int]()
+	orig := []string{"foo", "foobar", "zip"}
+	for i, k := range orig {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+	maxNodeId := r.maxNodeId
+
+	txn := r.Txn(false)
+	txn.TrackMutate(true)
+	for i := 0; i < 100; i++ {
+		txn.Insert([]byte(fmt.Sprintf("key%03d", i)), i)
+	}
+	txn.Insert([]byte("foo"), 100)
+	txn.Delete([]byte("zip"))
+	require.Equal(t, 102, txn.GetTree().Len())
+	txn.Abort()
+
+	// The transaction is back to the contents of the tree it came from
+	require.Equal(t, len(orig), txn.GetTree().Len())
+	for i, k := range orig {
+		v, ok := txn.Get([]byte(k))
+		require.True(t, ok, "key %q", k)
+		require.Equal(t, i, v)
+	}
+	_, ok := txn.Get([]byte("key000"))
+	require.False(t, ok)
+
+	// The source tree and a fresh transaction from it are untouched
+	require.Equal(t, len(orig), r.Len())
+	require.Equal(t, maxNodeId, r.maxNodeId)
+	fresh := r.Txn(false)
+	for i, k := range orig {
+		v, ok := r.Get([]byte(k))
+		require.True(t, ok, "key %q", k)
+		require.Equal(t, i, v)
+		v, ok = fresh.Get([]byte(k))
+		require.True(t, ok, "key %q", k)
+		require.Equal(t, i, v)
+	}
+
+	// The aborted transaction can still be used and committed
+	txn.Insert([]byte("zap"), 3)
+	nr := txn.Commit()
+	require.Equal(t, len(orig)+1, nr.Len())
+	require.True(t, nr.Contains([]byte("zap")))
+	require.False(t, r.Contains([]byte("zap")))
+	verifyTree(t, nr)
+}
+
+func TestTxn_GetUncommitted(t *testing.T) {
+	r := NewRadixTree[int]()
+	for i, k := range []string{"foo", "foobar", "zip"} {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	txn := r.Txn(false)
+	txn.Insert([]byte("foobaz"), 10)
+	old, updated := txn.Insert([]byte("foo"), 11)
+	require.True(t, updated)
+	require.Equal(t, 0, old)
+	require.Equal(t, 4, txn.GetTree().Len())
+	v, ok := txn.Get([]byte("foobaz"))
+	require.True(t, ok)
+	require.Equal(t, 10, v)
+	v, ok = txn.Get([]byte("foo"))
+	require.True(t, ok)
+	require.Equal(t, 11, v)
+
+	txn.Delete([]byte("foobar"))
+	_, ok = txn.Get([]byte("foobar"))
+	require.False(t, ok)
+	v, ok = txn.Get([]byte("foo"))
+	require.True(t, ok)
+	require.Equal(t, 11, v)
+
+	txn.DeletePrefix([]byte("zi"))
+	_, ok = txn.Get([]byte("zip"))
+	require.False(t, ok)
+
+	// Deleting every key swaps in a fresh empty root, which must still be
+	// searched and then written to.
+	txn.Delete([]byte("foo"))
+	txn.Delete([]byte("foobaz"))
+	for _, k := range []string{"foo", "foobar", "foobaz", "zip", ""} {
+		_, ok = txn.Get([]byte(k))
+		require.False(t, ok, "key %q", k)
+	}
+	txn.Insert([]byte("zap"), 12)
+	v, ok = txn.Get([]byte("zap"))
+	require.True(t, ok)
+	require.Equal(t, 12, v)
+
+	// None of this is visible in the tree the transaction started from.
+	v, ok = r.Get([]byte("foo"))
+	require.True(t, ok)
+	require.Equal(t, 0, v)
+	_, ok = r.Get([]byte("zap"))
+	require.False(t, ok)
+
+	r = txn.Commit()
+	require.Equal(t, 1, r.Len())
+	v, ok = r.Get([]byte("zap"))
+	require.True(t, ok)
+	require.Equal(t, 12, v)
+}
+
+func TestFirstNLastN(t *testing.T) {
+	r := NewRadixTree[int]()
+	keys := []string{"a", "foo", "foo/a", "foo/b", "foobar", "zip", "zip/zap"}
+	for _, i := range rand.New(rand.NewSource(1)).Perm(len(keys)) {
+		r, _, _ = r.Insert([]byte(keys[i]), i)
+	}
+
+	toStrings := func(b [][]byte) []string {
+		var out []string
+		for _, k := range b {
+			out = append(out, string(k))
+		}
+		return out
+	}
+
+	k, v := r.FirstN(3)
+	require.Equal(t, []string{"a", "foo", "foo/a"}, toStrings(k))
+	require.Equal(t, []int{0, 1, 2}, v)
+
+	k, v = r.LastN(3)
+	require.Equal(t, []string{"zip/zap", "zip", "foobar"}, toStrings(k))
+	require.Equal(t, []int{6, 5, 4}, v)
+
+	// Keys that are a prefix of others come after them in reverse.
+	k, _ = r.LastN(6)
+	require.Equal(t, []string{"zip/zap", "zip", "foobar", "foo/b", "foo/a", "foo"}, toStrings(k))
+
+	k, _ = r.FirstN(100)
+	require.Equal(t, keys, toStrings(k))
+	k, _ = r.LastN(100)
+	require.Len(t, k, len(keys))
+
+	k, v = r.FirstN(0)
+	require.Nil(t, k)
+	require.Nil(t, v)
+	k, _ = NewRadixTree[int]().LastN(3)
+	require.Nil(t, k)
+}
+
+func TestContains(t *testing.T) {
+	r := NewRadixTree[struct{}]()
+	require.False(t, r.Contains(nil))
+	require.False(t, r.Contains([]byte("foo")))
+
+	for _, k := range []string{"foo", "foobar", "zip"} {
+		r, _, _ = r.Insert([]byte(k), struct{}{})
+	}
+	for _, k := range []string{"foo", "foobar", "zip"} {
+		require.True(t, r.Contains([]byte(k)), "key %q", k)
+	}
+	for _, k := range []string{"", "fo", "foob", "zipper"} {
+		require.False(t, r.Contains([]byte(k)), "key %q", k)
+	}
+
+	old := r
+	r, _, _ = r.Delete([]byte("foo"))
+	require.False(t, r.Contains([]byte("foo")))
+	require.True(t, r.Contains([]byte("foobar")))
+	require.True(t, old.Contains([]byte("foo")))
+}
+
+func TestGetWithDefault(t *testing.T) {
+	r := NewRadixTree[string]()
+	require.Equal(t, "def", r.GetWithDefault([]byte("timeout"), "def"))
+
+	r, _, _ = r.Insert([]byte("timeout"), "30s")
+	r, _, _ = r.Insert([]byte("retries"), "")
+	require.Equal(t, "30s", r.GetWithDefault([]byte("timeout"), "10s"))
+	// A stored zero value is returned rather than the default
+	require.Equal(t, "", r.GetWithDefault([]byte("retries"), "3"))
+	require.Equal(t, "10s", r.GetWithDefault([]byte("time"), "10s"))
+	require.Equal(t, "10s", r.GetWithDefault(nil, "10s"))
+}
+
+func TestHasPrefix(t *testing.T) {
+	r := NewRadixTree[int]()
+	require.False(t, r.HasPrefix(nil))
+	require.False(t, r.HasPrefix([]byte("foo")))
+
+	r, _, _ = r.Insert([]byte("foobar"), 1)
+	require.True(t, r.HasPrefix([]byte("foo")))
+	require.False(t, r.Contains([]byte("foo")))
+
+	for _, k := range []string{"zip", "0123456789abcdefghij", "0123456789abcdefghik"} {
+		r, _, _ = r.Insert([]byte(k), 1)
+	}
+	for _, p := range []string{"", "f", "foobar", "z", "0123456789abcdefghi", "0123456789abcdefghij"} {
+		require.True(t, r.HasPrefix([]byte(p)), "prefix %q", p)
+	}
+	for _, p := range []string{"foobarz", "fooc", "a", "zipper", "0123456789abcdefghil", "0123456789abcdefgi"} {
+		require.False(t, r.HasPrefix([]byte(p)), "prefix %q", p)
+	}
+}
+
+func TestGetExactKey(t *testing.T) {
+	r := NewRadixTree[int]()
+	keys := []string{"foo", "foobar", "zip", "0123456789abcdefghij"}
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	for i, k := range keys {
+		lookup := []byte(k)
+		key, v, ok := r.GetExactKey(lookup)
+		require.True(t, ok, "key %q", k)
+		require.Equal(t, i, v)
+		require.Equal(t, []byte(k), key)
+		require.NotSame(t, &lookup[0], &key[0])
+
+		// The same stored key comes back for every lookup
+		again, _, _ := r.GetExactKey([]byte(k))
+		require.Same(t, &key[0], &again[0])
+	}
+
+	for _, k := range []string{"", "fo", "foob", "zipper"} {
+		key, _, ok := r.GetExactKey([]byte(k))
+		require.False(t, ok, "key %q", k)
+		require.Nil(t, key)
+	}
+}
+
+func TestListChildren(t *testing.T) {
+	r := NewRadixTree[int]()
+	keys := []string{"a", "a/", "a/b/c", "a/b/d", "a/bc", "a/e", "a/e/", "ab/c", "z/y"}
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	toStrings := func(b [][]byte) []string {
+		out := []string{}
+		for _, k := range b {
+			out = append(out, string(k))
+		}
+		return out
+	}
+
+	cases := []struct {
+		prefix string
+		want   []string
+		found  bool
+	}{
+		{"a/", []string{"b", "bc", "e"}, true},
+		{"a/b/", []string{"c", "d"}, true},
+		{"a/e/", []string{}, true},
+		{"a", []string{"", "b"}, true},
+		{"", []string{"a", "ab", "z"}, true},
+		{"a/x", []string{}, false},
+		{"b", []string{}, false},
+	}
+	for _, c := range cases {
+		segments, found := r.ListChildren([]byte(c.prefix), '/')
+		require.Equal(t, c.want, toStrings(segments), "prefix %q", c.prefix)
+		require.Equal(t, c.found, found, "prefix %q", c.prefix)
+	}
+}
+
+func TestCommonPrefix(t *testing.T) {
+	r := NewRadixTree[int]()
+	keys := []string{"foobar", "foobaz", "zipper/a/1", "zipper/a/2", "zipper/b", "longlonglonglong/1", "longlonglonglong/2"}
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	cases := []struct {
+		prefix, want string
+	}{
+		{"foo", "fooba"},
+		{"f", "fooba"},
+		{"fooba", "fooba"},
+		{"foobar", "foobar"},
+		{"zip", "zipper/"},
+		{"zipper/a", "zipper/a/"},
+		{"l", "longlonglonglong/"},
+		{"", ""},
+	}
+	for _, c := range cases {
+		require.Equal(t, c.want, string(r.CommonPrefix([]byte(c.prefix))), "prefix %q", c.prefix)
+	}
+
+	require.Nil(t, r.CommonPrefix([]byte("foobarbaz")))
+	require.Nil(t, r.CommonPrefix([]byte("x")))
+	require.Nil(t, NewRadixTree[int]().CommonPrefix(nil))
+
+	// A key that is a prefix of the others bounds the shared prefix
+	r, _, _ = r.Insert([]byte("foob"), 0)
+	require.Equal(t, "foob", string(r.CommonPrefix([]byte("foo"))))
+}
+
+func TestFindChildCorruptNode48(t *testing.T) {
+	r := NewRadixTree[int]()
+	for i := 0; i < 20; i++ {
+		r, _, _ = r.Insert([]byte{'A' + byte(i)}, i)
+	}
+	n, ok := r.root.(*Node48[int])
+	require.True(t, ok, "root is %T", r.root)
+
+	// Point unused key bytes at an empty slot and past the last slot
+	n.keys['x'] = 40
+	n.keys['y'] = 200
+
+	for _, k := range []string{"x", "y", "xyz"} {
+		_, found := r.Get([]byte(k))
+		require.False(t, found, "key %q", k)
+		ch, _ := findChild[int](n, k[0])
+		require.Nil(t, ch)
+	}
+	v, found := r.Get([]byte("C"))
+	require.True(t, found)
+	require.Equal(t, 2, v)
+}
+
+func TestLenPrefix(t *testing.T) {
+	keys := []string{"", "foo", "foo/", "foo/bar", "foo/bar/baz", "foo/zip", "foobar", "zip"}
+	r := NewRadixTree[int]()
+	require.Zero(t, r.LenPrefix(nil))
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	require.Equal(t, r.Len(), r.LenPrefix(nil))
+	require.Equal(t, r.Len(), r.LenPrefix([]byte{}))
+	for _, prefix := range []string{"f", "foo", "foo/", "foo/b", "foo/bar", "foo/bar/", "foo/bar/baz",
+		"foo/bar/bazz", "foob", "z", "zip", "zipper", "x", "foo/z"} {
+		want := 0
+		for _, k := range keys {
+			if strings.HasPrefix(k, prefix) {
+				want++
+			}
+		}
+		require.Equal(t, want, r.LenPrefix([]byte(prefix)), "prefix %q", prefix)
+	}
+
+	// Each version counts its own keys
+	r2, _ := r.DeletePrefix([]byte("foo/"))
+	require.Equal(t, 4, r.LenPrefix([]byte("foo/")))
+	require.Zero(t, r2.LenPrefix([]byte("foo/")))
+	require.Equal(t, 2, r2.LenPrefix([]byte("foo")))
+}
+
+func TestEstimatePrefixCount(t *testing.T) {
+	r := NewRadixTree[int]()
+	rnd := rand.New(rand.NewSource(42))
+	namespaces := []string{"alpha/", "beta/", "gamma/", "delta/"}
+	for i := 0; i < 20000; i++ {
+		ns := namespaces[i%len(namespaces)]
+		r, _, _ = r.Insert([]byte(fmt.Sprintf("%s%08x", ns, rnd.Uint32())), i)
+	}
+
+	require.Equal(t, r.Len(), r.EstimatePrefixCount(nil))
+	require.Equal(t, r.Len(), r.CountPrefix(nil))
+	for _, prefix := range []string{"alpha/", "beta/", "gamma/1", "delta/a", "delta/ab"} {
+		exact := r.CountPrefix([]byte(prefix))
+		require.NotZero(t, exact, "prefix %q", prefix)
+		est := r.EstimatePrefixCount([]byte(prefix))
+		require.InDelta(t, exact, est, 0.25*float64(exact)+2, "prefix %q", prefix)
+	}
+
+	for _, prefix := range []string{"omega/", "alpha/x", "alphabet"} {
+		require.Zero(t, r.CountPrefix([]byte(prefix)), "prefix %q", prefix)
+		require.Zero(t, r.EstimatePrefixCount([]byte(prefix)), "prefix %q", prefix)
+	}
+
+	// A full key counts itself along with anything it prefixes
+	r, _, _ = r.Insert([]byte("beta"), 0)
+	r, _, _ = r.Insert([]byte("betamax"), 0)
+	require.Equal(t, r.CountPrefix([]byte("beta/"))+2, r.CountPrefix([]byte("beta")))
+	require.Equal(t, 1, r.EstimatePrefixCount([]byte("betam")))
+	require.Equal(t, 1, r.CountPrefix([]byte("betamax")))
+}
+
+func TestWalkDuringTxns(t *testing.T) {
+	r := NewRadixTree[int]()
+	var want []string
+	for i := 0; i < 1000; i++ {
+		k := fmt.Sprintf("key/%04d", i)
+		r, _, _ = r.Insert([]byte(k), i)
+		want = append(want, k)
+	}
+
+	// Walk the snapshot while transactions started from it rewrite the
+	// shared nodes underneath. Run with -race to catch shared state being
+	// written by either side.
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			var got []string
+			r.Walk(func(k []byte, v int) bool {
+				got = append(got, string(k))
+				return false
+			})
+			if !slices.Equal(want, got) {
+				t.Errorf("walk %d saw %d keys, want %d", i, len(got), len(want))
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			txn := r.Txn(false)
+			txn.TrackMutate(true)
+			for j := 0; j < 100; j++ {
+				txn.Insert([]byte(fmt.Sprintf("key/%04d", (i*100+j)%1500)), -1)
+				txn.Delete([]byte(fmt.Sprintf("key/%04d", (i*37+j)%1000)))
+			}
+			txn.DeletePrefix([]byte(fmt.Sprintf("key/0%d", i%10)))
+			txn.Commit()
+		}
+	}()
+	wg.Wait()
+
+	require.Equal(t, len(want), r.Len())
+	for i, k := range want {
+		v, ok := r.Get([]byte(k))
+		require.True(t, ok, "key %q", k)
+		require.Equal(t, i, v)
+	}
+}
+
+func TestConcurrentTxnsFromSnapshot(t *testing.T) {
+	r := NewRadixTree[int]()
+	for i := 0; i < 1000; i++ {
+		r, _, _ = r.Insert([]byte(fmt.Sprintf("key/%04d", i)), i)
+	}
+
+	// Transactions on separate goroutines start from the same tree, so
+	// reference counts on its shared nodes are updated from both at once.
+	// Run with -race to catch unsynchronized updates.
+	results := make([]*RadixTree[int], 4)
+	var wg sync.WaitGroup
+	for g := range results {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			tree := r
+			for i := 0; i < 20; i++ {
+				txn := r.Txn(false)
+				for j := 0; j < 50; j++ {
+					txn.Insert([]byte(fmt.Sprintf("key/%04d", (i*50+j)%1000)), g)
+				}
+				txn.Delete([]byte(fmt.Sprintf("key/%04d", i)))
+				tree = txn.Commit()
+				_ = r.Clone(false)
+			}
+			results[g] = tree
+		}(g)
+	}
+	wg.Wait()
+
+	for i := 0; i < 1000; i++ {
+		v, ok := r.Get([]byte(fmt.Sprintf("key/%04d", i)))
+		require.True(t, ok)
+		require.Equal(t, i, v)
+	}
+	for g, tree := range results {
+		require.Equal(t, 999, tree.Len())
+		v, ok := tree.Get([]byte("key/0950"))
+		require.True(t, ok)
+		require.Equal(t, g, v)
+		verifyTree(t, tree)
+	}
+}
+
+func TestConcurrentTxnCreation(t *testing.T) {
+	r := NewRadixTree[int]()
+	for i := 0; i < 500; i++ {
+		r, _, _ = r.Insert([]byte(fmt.Sprintf("base/%03d", i)), i)
+	}
+	watch := r.RootWatch()
+
+	// Every goroutine opens its own transaction on the same tree at the
+	// same time. Some track mutations, so they also swap and close the
+	// watch channels of the nodes they share. Run with -race.
+	results := make([]*RadixTree[int], 64)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for g := range results {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			<-start
+			txn := r.Txn(g%4 == 0)
+			txn.TrackMutate(g%2 == 0)
+			txn.Insert([]byte(fmt.Sprintf("g/%02d", g)), g)
+			results[g] = txn.Commit()
+		}(g)
+	}
+	close(start)
+	wg.Wait()
+
+	select {
+	case <-watch:
+	default:
+		t.Fatalf("watch should have fired")
+	}
+	require.Equal(t, 500, r.Len())
+	_, ok := r.Get([]byte("g/00"))
+	require.False(t, ok)
+
+	// Each result holds the base keys and its own key only, so merging the
+	// keys they added gives every key exactly once
+	merged := r.Txn(false)
+	for g, tree := range results {
+		require.Equal(t, 501, tree.Len())
+		verifyTree(t, tree)
+		for k, v := range tree.ChangedSince(r) {
+			require.Equal(t, fmt.Sprintf("g/%02d", g), string(k))
+			merged.Insert(k, v)
+		}
+	}
+	all := merged.Commit()
+	require.Equal(t, 500+len(results), all.Len())
+	for g := range results {
+		v, ok := all.Get([]byte(fmt.Sprintf("g/%02d", g)))
+		require.True(t, ok)
+		require.Equal(t, g, v)
+	}
+}
+
+func TestEmptyTree(t *testing.T) {
+	empty := EmptyTree[int]()
+	require.Same(t, empty, EmptyTree[int]())
+	require.Equal(t, 0, empty.Len())
+
+	txn1 := empty.Txn(false)
+	txn2 := empty.Txn(false)
+	txn1.Insert([]byte("foo"), 1)
+	txn1.Insert([]byte("foobar"), 2)
+	txn2.Insert([]byte("foo"), 3)
+	txn2.Insert([]byte("zip"), 4)
+	r1 := txn1.Commit()
+	r2 := txn2.Commit()
+	r3, _, _ := empty.Insert([]byte("zap"), 5)
+
+	require.Equal(t, []string{"foo", "foobar"}, walkKeys(r1))
+	require.Equal(t, []string{"foo", "zip"}, walkKeys(r2))
+	require.Equal(t, []string{"zap"}, walkKeys(r3))
+	v, _ := r1.Get([]byte("foo"))
+	require.Equal(t, 1, v)
+	v, _ = r2.Get([]byte("foo"))
+	require.Equal(t, 3, v)
+
+	// The shared tree is still empty, for this and every other value type
+	require.Same(t, empty, EmptyTree[int]())
+	require.Equal(t, 0, empty.Len())
+	require.Empty(t, walkKeys(empty))
+	require.Equal(t, 0, EmptyTree[string]().Len())
+	require.Equal(t, 0, EmptyTree[any]().Len())
+}
+
+func walkKeys[T any](r *RadixTree[T]) []string {
+	var keys []string
+	r.Walk(func(k []byte, v T) bool {
+		keys = append(keys, string(k))
+		return false
+	})
+	return keys
+}
+
+func TestCompact(t *testing.T) {
+	// Grow a node under "k" to all 256 children, then delete most of them
+	build := func(keep int) *RadixTree[int] {
+		r := NewRadixTree[int]()
+		r, _, _ = r.Insert([]byte("a"), -1)
+		for c := 0; c < 256; c++ {
+			r, _, _ = r.Insert([]byte{'k', byte(c)}, c)
+		}
+		require.Equal(t, 1, r.Stats().Node256)
+		for c := keep; c < 256; c++ {
+			r, _, _ = r.Delete([]byte{'k', byte(c)})
+		}
+		return r
+	}
+
+	for _, tc := range []struct {
+		keep int
+		want TreeStats
+	}{
+		{10, TreeStats{Node16: 1}},
+		{40, TreeStats{Node48: 1}},
+		{60, TreeStats{Node256: 1}},
+	} {
+		r := build(tc.keep)
+		before := r.Stats()
+		c := r.Compact()
+		// Each key sits in a node4 of its own, and the root is a node4 too
+		tc.want.Node4 = before.Node4
+		tc.want.Leaves = tc.keep + 1
+		require.Equal(t, tc.want, c.Stats(), "keep %d", tc.keep)
+		require.Equal(t, before, r.Stats(), "keep %d", tc.keep)
+		require.Equal(t, r.Len(), c.Len())
+		require.Equal(t, walkKeys(r), walkKeys(c))
+		verifyTree(t, c)
+	}
+
+	// A node48 left above the shrink threshold is rebuilt as a node16, and
+	// the compacted tree can still be changed
+	r := NewRadixTree[int]()
+	for c := 0; c < 17; c++ {
+		r, _, _ = r.Insert([]byte{'k', byte(c)}, c)
+	}
+	for c := 14; c < 17; c++ {
+		r, _, _ = r.Delete([]byte{'k', byte(c)})
+	}
+	require.Equal(t, 1, r.Stats().Node48)
+	c := r.Compact()
+	require.Equal(t, TreeStats{Node4: 14, Node16: 1, Leaves: 14}, c.Stats())
+	for i := 0; i < 14; i++ {
+		v, ok := c.Get([]byte{'k', byte(i)})
+		require.True(t, ok)
+		require.Equal(t, i, v)
+	}
+	c, _, _ = c.Insert([]byte{'k', 20}, 20)
+	c, _, _ = c.Delete([]byte{'k', 0})
+	require.Equal(t, 14, c.Len())
+	verifyTree(t, c)
+
+	// Compacting a compact tree changes nothing
+	require.Equal(t, c.Stats(), c.Compact().Stats())
+}
+
+func TestNodeResizeHysteresis(t *testing.T) {
+	key := func(c int) []byte { return []byte{'k', byte(c)} }
+	build := func(n int) *RadixTree[int] {
+		r := NewRadixTree[int]()
+		for c := 0; c < n; c++ {
+			r, _, _ = r.Insert(key(c), c)
+		}
+		return r
+	}
+	typeOf := func(r *RadixTree[int]) string { return fmt.Sprintf("%T", r.root) }
+
+	// Moving one child back and forth across a grow or shrink boundary must
+	// not change the node type after the first crossing.
+	for _, tc := range []struct {
+		from, to int
+		want     string
+	}{
+		{4, 5, "*adaptive.Node16[int]"},
+		{16, 17, "*adaptive.Node48[int]"},
+		{48, 49, "*adaptive.Node256[int]"},
+		{4, 3, "*adaptive.Node4[int]"},
+		{13, 12, "*adaptive.Node16[int]"},
+		{38, 37, "*adaptive.Node48[int]"},
+	} {
+		// Start with a node256 and delete down, so every node got its type
+		// by shrinking
+		r := build(64)
+		for c := 63; c >= tc.from; c-- {
+			r, _, _ = r.Delete(key(c))
+		}
+		require.Equal(t, tc.from, r.Len())
+		for i := 0; i < 10; i++ {
+			if tc.to > tc.from {
+				r, _, _ = r.Insert(key(tc.from), tc.from)
+				require.Equal(t, tc.want, typeOf(r), "%d -> %d", tc.from, tc.to)
+				r, _, _ = r.Delete(key(tc.from))
+			} else {
+				r, _, _ = r.Delete(key(tc.to))
+				require.Equal(t, tc.want, typeOf(r), "%d -> %d", tc.from, tc.to)
+				r, _, _ = r.Insert(key(tc.to), tc.to)
+			}
+			require.Equal(t, tc.want, typeOf(r), "%d <- %d", tc.from, tc.to)
+			require.Equal(t, tc.from, r.Len())
+		}
+		verifyTree(t, r)
+	}
+
+	// A full node256 wraps its uint8 child count around to 0, which must not
+	// make it look like a node without children.
+	r := build(256)
+	r, _, _ = r.Insert([]byte("k"), -1)
+	require.Equal(t, "*adaptive.Node256[int]", typeOf(r))
+	for c := 0; c < 256; c++ {
+		v, ok := r.Get(key(c))
+		require.True(t, ok, "key %d", c)
+		require.Equal(t, c, v)
+	}
+	r, _, _ = r.Delete([]byte("k"))
+	require.Equal(t, 256, r.Len())
+	require.Len(t, walkKeys(r), 256)
+	verifyTree(t, r)
+}
+
+func TestStrictNoOverwrite(t *testing.T) {
+	r := NewRadixTreeWithOptions[int](Options{StrictNoOverwrite: true})
+	for i, k := range []string{"foo", "foobar", "zip"} {
+		var existed bool
+		r, _, existed = r.Insert([]byte(k), i)
+		require.False(t, existed)
+	}
+
+	// Both a key stored in its own leaf and one stored on an inner node
+	for i, k := range []string{"foo", "foobar", "zip"} {
+		nr, old, existed := r.Insert([]byte(k), 100)
+		require.True(t, existed, "key %q", k)
+		require.Equal(t, i, old)
+		v, _ := nr.Get([]byte(k))
+		require.Equal(t, i, v, "key %q", k)
+		require.Equal(t, r.Len(), nr.Len())
+		r = nr
+	}
+
+	// New keys still go in, and the option carries over to derived trees
+	txn := r.Txn(false)
+	_, existed := txn.Insert([]byte("zap"), 3)
+	require.False(t, existed)
+	_, existed = txn.Insert([]byte("zap"), 4)
+	require.True(t, existed)
+	r = txn.Commit()
+	v, _ := r.Get([]byte("zap"))
+	require.Equal(t, 3, v)
+	r, _, _ = r.Clone(false).Insert([]byte("zip"), 100)
+	v, _ = r.Get([]byte("zip"))
+	require.Equal(t, 2, v)
+	require.Equal(t, 4, r.Len())
+
+	// Without the option a second insert replaces the value
+	d := NewRadixTree[int]()
+	d, _, _ = d.Insert([]byte("foo"), 1)
+	d, _, _ = d.Insert([]byte("foo"), 2)
+	v, _ = d.Get([]byte("foo"))
+	require.Equal(t, 2, v)
+}
+
+func TestNodeWalk(t *testing.T) {
+	r := NewRadixTree[int]()
+	keys := []string{"bar", "foo", "foo/", "foo/bar", "foo/bar/baz", "foo/zip", "foobar", "zip"}
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	walk := func(n Node[int]) []string {
+		var out []string
+		n.Walk(func(k []byte, v int) bool {
+			out = append(out, string(k))
+			return false
+		})
+		return out
+	}
+
+	n := r.Root().Iterator().SeekPrefix([]byte("foo/"))
+	require.Equal(t, []string{"foo/", "foo/bar", "foo/bar/baz", "foo/zip"}, walk(n))
+
+	n = r.Root().Iterator().SeekPrefix([]byte("foo/bar/baz"))
+	require.Equal(t, []string{"foo/bar/baz"}, walk(n))
+
+	require.Equal(t, keys, walk(r.Root()))
+
+	// Returning true stops the walk
+	var first []string
+	r.Root().Walk(func(k []byte, v int) bool {
+		first = append(first, string(k))
+		return len(first) == 2
+	})
+	require.Equal(t, keys[:2], first)
+}
+
+func TestNodeSize(t *testing.T) {
+	r := NewRadixTree[int]()
+	require.Equal(t, 0, r.Root().Size())
+
+	keys := []string{"bar", "foo", "foo/", "foo/bar", "foo/bar/baz", "foo/zip", "foobar", "zip"}
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+	require.Equal(t, r.Len(), r.Root().Size())
+
+	for prefix, want := range map[string]int{"foo/": 4, "foo": 6, "foo/bar": 2, "zip": 1, "b": 1} {
+		n := r.Root().Iterator().SeekPrefix([]byte(prefix))
+		require.Equal(t, want, n.Size(), "prefix %q", prefix)
+		require.Equal(t, r.CountPrefix([]byte(prefix)), n.Size(), "prefix %q", prefix)
+	}
+}
+
+func TestInsertKeyEndingAtSplit(t *testing.T) {
+	long := "0123456789abcdefghij"
+	cases := [][]string{
+		// A key and the same key plus one byte
+		{"foo", "foob"},
+		{"foo", "foo$"},
+		{"", "$"},
+		// A key ending exactly at the end of a node's prefix, short and longer
+		// than the stored partial
+		{"foobar", "foobaz", "fooba"},
+		{long + "x", long + "y", long},
+		{long + "x", long + "y", long[:15]},
+		// Keys whose next byte is the terminator itself
+		{"a$", "a$a", "a"},
+		{"a", "aa", "", "$"},
+		{"", "$$", "$$$", "$"},
+		{"$$$", "$a", "$"},
+	}
+	for _, keys := range cases {
+		want := slices.Clone(keys)
+		sort.Strings(want)
+		reversed := slices.Clone(keys)
+		slices.Reverse(reversed)
+		for _, order := range [][]string{keys, reversed} {
+			r := NewRadixTree[int]()
+			for _, k := range order {
+				r, _, _ = r.Insert([]byte(k), len(k))
+			}
+			require.Equal(t, len(keys), r.Len(), "keys %q", order)
+			for _, k := range order {
+				v, ok := r.Get([]byte(k))
+				require.True(t, ok, "keys %q missing %q", order, k)
+				require.Equal(t, len(k), v)
+			}
+			require.Equal(t, want, walkKeys(r), "keys %q", order)
+			verifyTree(t, r)
+		}
+	}
+}
+
+func TestWalkTyped(t *testing.T) {
+	r := NewRadixTree[any]()
+	for k, v := range map[string]any{"a": 1, "b": "two", "c": 3, "d": "four", "e": nil, "f": 6} {
+		r, _, _ = r.Insert([]byte(k), v)
+	}
+
+	var keys []string
+	var sum int
+	WalkTyped(r, func(k []byte, v int) bool {
+		keys = append(keys, string(k))
+		sum += v
+		return false
+	})
+	require.Equal(t, []string{"a", "c", "f"}, keys)
+	require.Equal(t, 10, sum)
+
+	var strs []string
+	WalkTyped(r, func(k []byte, v string) bool {
+		strs = append(strs, v)
+		return false
+	})
+	require.Equal(t, []string{"two", "four"}, strs)
+
+	// Returning true stops the walk
+	keys = nil
+	WalkTyped(r, func(k []byte, v int) bool {
+		keys = append(keys, string(k))
+		return true
+	})
+	require.Equal(t, []string{"a"}, keys)
+}
+
+func TestTxn_Dirty(t *testing.T) {
+	r := NewRadixTreeWithOptions[int](Options{StrictNoOverwrite: true})
+	r, _, _ = r.Insert([]byte("foo"), 1)
+	r, _, _ = r.Insert([]byte("foobar"), 2)
+
+	// Nothing here changes the tree
+	txn := r.Txn(false)
+	require.False(t, txn.Dirty())
+	txn.Insert([]byte("foo"), 10)
+	txn.Insert([]byte("foobar"), 20)
+	txn.Delete([]byte("zip"))
+	txn.DeletePrefix([]byte("zip"))
+	require.False(t, txn.Dirty())
+	require.Equal(t, walkKeys(r), walkKeys(txn.Commit()))
+
+	for name, write := range map[string]func(*Txn[int]){
+		"insert":        func(txn *Txn[int]) { txn.Insert([]byte("zip"), 3) },
+		"delete":        func(txn *Txn[int]) { txn.Delete([]byte("foo")) },
+		"delete prefix": func(txn *Txn[int]) { txn.DeletePrefix([]byte("foo")) },
+	} {
+		txn := r.Txn(false)
+		write(txn)
+		require.True(t, txn.Dirty(), name)
+		require.True(t, txn.Clone(false).Dirty(), name)
+		txn.Abort()
+		require.False(t, txn.Dirty(), name)
+	}
+
+	// Without StrictNoOverwrite an existing key gets its new value
+	txn = NewRadixTree[int]().Txn(false)
+	txn.Insert([]byte("foo"), 1)
+	r = txn.Commit()
+	txn = r.Txn(false)
+	txn.Insert([]byte("foo"), 2)
+	require.True(t, txn.Dirty())
+}
+
+func TestDisableWatch(t *testing.T) {
+	r := NewRadixTreeWithOptions[int](Options{DisableWatch: true})
+	txn := r.Txn(false)
+	txn.TrackMutate(true)
+	for i, k := range []string{"foo", "foobar", "zip"} {
+		txn.Insert([]byte(k), i)
+	}
+	r = txn.Commit()
+
+	watch, v, ok := r.GetWatch([]byte("foobar"))
+	require.Nil(t, watch)
+	require.True(t, ok)
+	require.Equal(t, 1, v)
+	watch, _, ok = r.Txn(false).GetWatch([]byte("nope"))
+	require.Nil(t, watch)
+	require.False(t, ok)
+
+	// Writes and clones no longer allocate a channel for every node
+	insert := func(opts Options) float64 {
+		base := NewRadixTreeWithOptions[int](opts)
+		for i := 0; i < 1000; i++ {
+			base, _, _ = base.Insert([]byte(fmt.Sprintf("key%d", i)), i)
+		}
+		return testing.AllocsPerRun(100, func() {
+			base.Insert([]byte("key500x"), 0)
+			base.Clone(true)
+		})
+	}
+	require.Less(t, insert(Options{DisableWatch: true}), insert(Options{}))
+
+	// Watching still works without the option
+	r = NewRadixTree[int]()
+	r, _, _ = r.Insert([]byte("foo"), 1)
+	watch, _, _ = r.GetWatch([]byte("foo"))
+	require.NotNil(t, watch)
+	txn = r.Txn(false)
+	txn.TrackMutate(true)
+	txn.Insert([]byte("foo"), 2)
+	txn.Commit()
+	select {
+	case <-watch:
+	default:
+		t.Fatalf("watch should have fired")
+	}
+}
+
+func TestNodeTypeName(t *testing.T) {
+	for want, n := range map[string]Node[int]{
+		"leaf":    &NodeLeaf[int]{},
+		"node4":   &Node4[int]{},
+		"node16":  &Node16[int]{},
+		"node48":  &Node48[int]{},
+		"node256": &Node256[int]{},
+	} {
+		require.Equal(t, want, NodeTypeName(n))
+	}
+	require.Equal(t, "nodeType(9)", nodeType(9).String())
+}
+
+func TestChangedSince(t *testing.T) {
+	r := NewRadixTree[int]()
+	for i, k := range loadTestFile("test-text/uuid.txt") {
+		r, _, _ = r.Insert(k, i)
+	}
+	old := r.Clone(false)
+
+	// Nothing has changed yet
+	for range r.ChangedSince(old) {
+		t.Fatal("unexpected change")
+	}
+
+	// Update three keys and insert two
+	keys := walkKeys(r)
+	want := map[string]int{
+		keys[0]:                 -1,
+		keys[len(keys)/2]:       -2,
+		keys[len(keys)-1]:       -3,
+		"new-key":               -4,
+		keys[len(keys)/3] + "x": -5,
+	}
+	txn := r.Txn(false)
+	for k, v := range want {
+		txn.Insert([]byte(k), v)
+	}
+	r = txn.Commit()
+
+	got := map[string]int{}
+	var order []string
+	for k, v := range r.ChangedSince(old) {
+		got[string(k)] = v
+		order = append(order, string(k))
+	}
+	require.Equal(t, want, got)
+	require.True(t, slices.IsSorted(order))
+
+	// The old tree is untouched and reports nothing against itself
+	for range old.ChangedSince(old) {
+		t.Fatal("unexpected change")
+	}
+
+	// Breaking out stops the iteration
+	n := 0
+	for range r.ChangedSince(old) {
+		n++
+		break
+	}
+	require.Equal(t, 1, n)
+}
+
+func TestDeleteAll(t *testing.T) {
+	r := NewRadixTreeWithOptions[int](Options{StrictNoOverwrite: true})
+	keys := loadTestFile("test-text/words.txt")
+	for i, k := range keys {
+		r, _, _ = r.Insert(k, i)
+	}
+	prior := r.Len()
+
+	empty, n := r.DeleteAll()
+	require.Equal(t, prior, n)
+	require.Zero(t, empty.Len())
+	require.Empty(t, walkKeys(empty))
+	_, ok := empty.Get(keys[0])
+	require.False(t, ok)
+	require.Equal(t, r.Generation()+1, empty.Generation())
+	require.Equal(t, r.opts, empty.opts)
+	verifyTree(t, empty)
+
+	// The original tree is untouched
+	require.Equal(t, prior, r.Len())
+	_, ok = r.Get(keys[0])
+	require.True(t, ok)
+
+	// The empty tree is usable, and clearing it again removes nothing
+	empty, _, _ = empty.Insert([]byte("foo"), 1)
+	require.Equal(t, []string{"foo"}, walkKeys(empty))
+	empty, n = empty.DeleteAll()
+	require.Equal(t, 1, n)
+	_, n = empty.DeleteAll()
+	require.Zero(t, n)
+}
+
+func TestIsEmpty(t *testing.T) {
+	r := NewRadixTree[int]()
+	require.True(t, r.IsEmpty())
+	require.Equal(t, node4, r.RootType())
+
+	keys := loadTestFile("test-text/words.txt")[:1000]
+	for i, k := range keys {
+		r, _, _ = r.Insert(k, i)
+		require.False(t, r.IsEmpty())
+	}
+	require.Equal(t, NodeTypeName(r.Root()), r.RootType().String())
+
+	// Deleting every key one by one leaves a root node behind, but the tree
+	// is empty again
+	for _, k := range keys {
+		require.False(t, r.IsEmpty())
+		r, _, _ = r.Delete(k)
+	}
+	require.True(t, r.IsEmpty())
+	require.Equal(t, node4, r.RootType())
+
+	r, _, _ = r.Insert([]byte("foo"), 1)
+	require.False(t, r.IsEmpty())
+	r, _ = r.DeletePrefix([]byte("f"))
+	require.True(t, r.IsEmpty())
+}
+
+func TestInsertFunc_RunningMax(t *testing.T) {
+	words := loadTestFile("test-text/words.txt")
+	rng := rand.New(rand.NewSource(1))
+	want := map[string]int{}
+	txn := NewRadixTree[int]().Txn(false)
+	for round := 0; round < 3; round++ {
+		for _, w := range words {
+			v := rng.Intn(1000)
+			calls := 0
+			prev, existed := want[string(w)]
+			old, ok := txn.InsertFunc(w, func(old int, existed bool) int {
+				calls++
+				if existed && old > v {
+					return old
+				}
+				return v
+			})
+			require.Equal(t, 1, calls)
+			require.Equal(t, existed, ok)
+			require.Equal(t, prev, old)
+			want[string(w)] = max(prev, v)
+		}
+	}
+	r := txn.Commit()
+	require.Equal(t, len(want), r.Len())
+	for k, v := range want {
+		got, ok := r.Get([]byte(k))
+		require.True(t, ok)
+		require.Equal(t, v, got, k)
+	}
+	verifyTree(t, r)
+}
+
+func TestInsertFunc_SetUnion(t *testing.T) {
+	union := func(add ...string) func([]string, bool) []string {
+		return func(old []string, existed bool) []string {
+			// Stored values are shared with older trees, so build a new slice
+			out := slices.Clone(old)
+			for _, s := range add {
+				if !slices.Contains(out, s) {
+					out = append(out, s)
+				}
+			}
+			slices.Sort(out)
+			return out
+		}
+	}
+
+	r := NewRadixTree[[]string]()
+	txn := r.Txn(false)
+	txn.InsertFunc([]byte("foo"), union("a", "b"))
+	txn.InsertFunc([]byte("foobar"), union("x"))
+	txn.InsertFunc([]byte("fo"), union("y"))
+	r1 := txn.Commit()
+
+	txn = r1.Txn(false)
+	old, ok := txn.InsertFunc([]byte("foo"), union("b", "c"))
+	require.True(t, ok)
+	require.Equal(t, []string{"a", "b"}, old)
+	txn.InsertFunc([]byte("fo"), union("y", "z"))
+	r2 := txn.Commit()
+
+	for k, v := range map[string][]string{"foo": {"a", "b", "c"}, "foobar": {"x"}, "fo": {"y", "z"}} {
+		got, _ := r2.Get([]byte(k))
+		require.Equal(t, v, got, k)
+	}
+	// The older tree keeps its sets
+	got, _ := r1.Get([]byte("foo"))
+	require.Equal(t, []string{"a", "b"}, got)
+
+	// An existing key is left alone, without calling produce, when overwrites
+	// are not allowed
+	strict := NewRadixTreeWithOptions[int](Options{StrictNoOverwrite: true})
+	strict, _, _ = strict.Insert([]byte("foo"), 1)
+	txn2 := strict.Txn(false)
+	old2, ok := txn2.InsertFunc([]byte("foo"), func(int, bool) int {
+		t.Fatal("produce called")
+		return 0
+	})
+	require.True(t, ok)
+	require.Equal(t, 1, old2)
+	v, _ := txn2.Commit().Get([]byte("foo"))
+	require.Equal(t, 1, v)
+}
+
+func TestInternValues(t *testing.T) {
+	calls := 0
+	intern := func(v string) string {
+		calls++
+		return unique.Make(v).Value()
+	}
+	r := NewRadixTreeWithOptions[string](Options{InternValues: intern})
+
+	// Two equal strings built separately, so they start out apart
+	a, b := strings.Repeat("value", 10), strings.Repeat("value", 10)
+	require.NotSame(t, unsafe.StringData(a), unsafe.StringData(b))
+	r, _, _ = r.Insert([]byte("a"), a)
+	r, _, _ = r.Insert([]byte("b"), b)
+	txn := r.Txn(false)
+	txn.InsertFunc([]byte("c"), func(string, bool) string { return strings.Repeat("value", 10) })
+	r = txn.Commit()
+	require.Equal(t, 3, calls)
+
+	va, _ := r.Get([]byte("a"))
+	vb, _ := r.Get([]byte("b"))
+	vc, _ := r.Get([]byte("c"))
+	require.Equal(t, a, va)
+	require.Same(t, unsafe.StringData(va), unsafe.StringData(vb))
+	require.Same(t, unsafe.StringData(va), unsafe.StringData(vc))
+
+	require.Panics(t, func() {
+		NewRadixTreeWithOptions[int](Options{InternValues: intern})
+	})
+}
+
+func TestInsertWatch(t *testing.T) {
+	closed := func(ch <-chan struct{}) bool {
+		select {
+		case <-ch:
+			return true
+		default:
+			return false
+		}
+	}
+	r := NewRadixTree[int]()
+	r, _, _ = r.Insert([]byte("foo"), 1)
+
+	for _, key := range []string{"foo", "foobar"} {
+		txn := r.Txn(false)
+		txn.TrackMutate(true)
+		_, _, ch := txn.InsertWatch([]byte(key), 2)
+		require.NotNil(t, ch)
+		r1 := txn.Commit()
+		require.False(t, closed(ch), "key %q", key)
+
+		// Other keys changing leave it alone
+		txn = r1.Txn(false)
+		txn.TrackMutate(true)
+		txn.Insert([]byte("zip"), 3)
+		r2 := txn.Commit()
+		require.False(t, closed(ch), "key %q", key)
+
+		// The next change to the key fires it
+		txn = r2.Txn(false)
+		txn.TrackMutate(true)
+		txn.Insert([]byte(key), 4)
+		txn.Commit()
+		require.True(t, closed(ch), "key %q", key)
+	}
+
+	// So does deleting it
+	txn := r.Txn(false)
+	txn.TrackMutate(true)
+	_, _, fooCh := txn.InsertWatch([]byte("foo"), 5)
+	r = txn.Commit()
+	txn = r.Txn(false)
+	txn.TrackMutate(true)
+	txn.Delete([]byte("foo"))
+	txn.Commit()
+	require.True(t, closed(fooCh))
+
+	// A later write to the key in the same transaction fires it on commit
+	txn = r.Txn(false)
+	txn.TrackMutate(true)
+	_, _, fooCh = txn.InsertWatch([]byte("foo"), 6)
+	txn.Insert([]byte("foo"), 7)
+	require.False(t, closed(fooCh))
+	txn.Commit()
+	require.True(t, closed(fooCh))
+
+	// Taking the channel leaves the transaction's nodes free to be recycled
+	txn = r.Txn(false)
+	txn.RecycleNodes(true)
+	_, _, fooCh = txn.InsertWatch([]byte("foo"), 8)
+	_, _, barCh := txn.InsertWatch([]byte("bar"), 9)
+	txn.Delete([]byte("bar"))
+	require.NotEmpty(t, txn.freeLeaves)
+
+	// A recycled leaf does not pass the dropped key's channel on
+	txn.Insert([]byte("baz"), 10)
+	require.Empty(t, txn.freeLeaves)
+	bazCh, _, _ := txn.GetWatch([]byte("baz"))
+	require.NotEqual(t, barCh, bazCh)
+
+	// It is the channel GetWatch finds for the key
+	gotFooCh, _, _ := txn.GetWatch([]byte("foo"))
+	require.Equal(t, fooCh, gotFooCh)
+
+	old, ok, ch := NewRadixTreeWithOptions[int](Options{DisableWatch: true}).Txn(false).InsertWatch([]byte("foo"), 1)
+	require.False(t, ok)
+	require.Zero(t, old)
+	require.Nil(t, ch)
+}
+
+func TestInsertIf(t *testing.T) {
+	// Move 30 from one balance to another only if the first can cover it,
+	// and record the transfer only if the debit went through
+	r := NewRadixTree[int]()
+	r, _, _ = r.Insert([]byte("balance/a"), 50)
+
+	transfer := func(r *RadixTree[int], amount int) *RadixTree[int] {
+		txn := r.Txn(false)
+		a, _ := txn.Get([]byte("balance/a"))
+		debited := txn.InsertIf([]byte("balance/a"), a-amount, func(cur int, existed bool) bool {
+			return existed && cur >= amount
+		})
+		txn.InsertIf([]byte("transfer"), amount, func(int, bool) bool {
+			cur, _ := txn.Get([]byte("balance/a"))
+			return debited && cur == a-amount
+		})
+		return txn.Commit()
+	}
+
+	r1 := transfer(r, 30)
+	v, _ := r1.Get([]byte("balance/a"))
+	require.Equal(t, 20, v)
+	v, ok := r1.Get([]byte("transfer"))
+	require.True(t, ok)
+	require.Equal(t, 30, v)
+
+	// The second transfer fails its first condition, so neither key changes
+	r2 := transfer(r1, 30)
+	require.Equal(t, walkKeys(r1), walkKeys(r2))
+	v, _ = r2.Get([]byte("balance/a"))
+	require.Equal(t, 20, v)
+	v, _ = r2.Get([]byte("transfer"))
+	require.Equal(t, 30, v)
+
+	// A condition on a missing key sees no value
+	txn := r.Txn(false)
+	require.True(t, txn.InsertIf([]byte("new"), 1, func(cur int, existed bool) bool {
+		return !existed && cur == 0
+	}))
+	require.False(t, txn.InsertIf([]byte("new"), 2, func(_ int, existed bool) bool {
+		return !existed
+	}))
+	v, _ = txn.Get([]byte("new"))
+	require.Equal(t, 1, v)
+
+	strict := NewRadixTreeWithOptions[int](Options{StrictNoOverwrite: true})
+	strict, _, _ = strict.Insert([]byte("foo"), 1)
+	require.False(t, strict.Txn(false).InsertIf([]byte("foo"), 2, func(int, bool) bool { return true }))
+}
+
+func TestNilKey(t *testing.T) {
+	for name, keys := range map[string][]string{
+		"empty":         nil,
+		"with empty":    {"", "a", "ab"},
+		"without empty": {"a", "ab", "b"},
+	} {
+		build := func() *RadixTree[int] {
+			r := NewRadixTree[int]()
+			for i, k := range keys {
+				r, _, _ = r.Insert([]byte(k), i+1)
+			}
+			return r
+		}
+		r := build()
+
+		// Each call returns everything it observed, and is run once with a
+		// nil key and once with an empty one
+		calls := map[string]func(key []byte) []any{
+			"Get": func(key []byte) []any {
+				v, ok := r.Get(key)
+				return []any{v, ok}
+			},
+			"Contains": func(key []byte) []any {
+				return []any{r.Contains(key)}
+			},
+			"GetWatch": func(key []byte) []any {
+				_, v, ok := r.GetWatch(key)
+				return []any{v, ok}
+			},
+			"LongestPrefix": func(key []byte) []any {
+				k, v, ok := r.LongestPrefix(key)
+				return []any{k, v, ok}
+			},
+			"Insert": func(key []byte) []any {
+				nr, old, ok := build().Insert(key, 9)
+				return []any{walkKeys(nr), nr.Len(), old, ok}
+			},
+			"Delete": func(key []byte) []any {
+				nr, old, ok := build().Delete(key)
+				return []any{walkKeys(nr), nr.Len(), old, ok}
+			},
+			"DeletePrefix": func(key []byte) []any {
+				nr, ok := build().DeletePrefix(key)
+				return []any{walkKeys(nr), nr.Len(), ok}
+			},
+			"SeekPrefix": func(key []byte) []any {
+				it := r.Root().Iterator()
+				it.SeekPrefix(key)
+				var out []string
+				for k, _, ok := it.Next(); ok; k, _, ok = it.Next() {
+					out = append(out, string(k))
+				}
+				return []any{out}
+			},
+		}
+		for call, fn := range calls {
+			require.Equal(t, fn([]byte{}), fn(nil), "%s: %s", name, call)
+		}
+	}
+
+	// An empty tree has no prefix of anything, not even the empty key
+	_, _, ok := NewRadixTree[int]().LongestPrefix(nil)
+	require.False(t, ok)
+	r, _, _ := NewRadixTree[int]().Insert([]byte("a"), 1)
+	r, _, _ = r.Delete([]byte("a"))
+	_, _, ok = r.LongestPrefix([]byte("a"))
+	require.False(t, ok)
+}
+
+func TestRootWatch(t *testing.T) {
+	fired := func(ch <-chan struct{}) bool {
+		select {
+		case <-ch:
+			return true
+		default:
+			return false
+		}
+	}
+
+	r := NewRadixTree[int]()
+	for i, w := range loadTestFile("test-text/words.txt")[:1000] {
+		watch := r.RootWatch()
+		require.NotNil(t, watch)
+		txn := r.Txn(false)
+		txn.TrackMutate(true)
+		txn.Insert(w, i)
+		r = txn.Commit()
+		require.True(t, fired(watch), "insert of %q", w)
+	}
+
+	// Updates and deletes fire it too
+	watch := r.RootWatch()
+	txn := r.Txn(false)
+	txn.TrackMutate(true)
+	txn.Insert([]byte("A"), 2)
+	r = txn.Commit()
+	require.True(t, fired(watch))
+
+	watch = r.RootWatch()
+	txn = r.Txn(false)
+	txn.TrackMutate(true)
+	txn.Delete([]byte("A"))
+	r = txn.Commit()
+	require.True(t, fired(watch))
+
+	// A transaction that changes nothing leaves it open
+	watch = r.RootWatch()
+	txn = r.Txn(false)
+	txn.TrackMutate(true)
+	txn.Delete([]byte("missing"))
+	r = txn.Commit()
+	require.False(t, fired(watch))
+
+	r = NewRadixTreeWithOptions[int](Options{DisableWatch: true})
+	require.Nil(t, r.RootWatch())
+}
+
+func TestDepthHistogram(t *testing.T) {
+	require.Empty(t, NewRadixTree[int]().DepthHistogram())
+
+	r := NewRadixTree[int]()
+	for _, k := range []string{"a", "b", "c"} {
+		r, _, _ = r.Insert([]byte(k), 0)
+	}
+	require.Equal(t, map[int]int{1: 3}, r.DepthHistogram())
+
+	// A key below another sits one node further down
+	r, _, _ = r.Insert([]byte("ab"), 0)
+	r, _, _ = r.Insert([]byte("abc"), 0)
+	require.Equal(t, map[int]int{1: 3, 2: 1, 3: 1}, r.DepthHistogram())
+
+	// Alone in the tree, the empty key is the root's own leaf
+	e, _, _ := NewRadixTree[int]().Insert([]byte(""), 0)
+	require.Equal(t, map[int]int{0: 1}, e.DepthHistogram())
+
+	// A shared prefix is stored once, so it adds no depth
+	r = NewRadixTree[int]()
+	for _, k := range []string{"prefix/a", "prefix/b", "prefix/c/d", "prefix/c/e"} {
+		r, _, _ = r.Insert([]byte(k), 0)
+	}
+	require.Equal(t, map[int]int{1: 2, 2: 2}, r.DepthHistogram())
+
+	r = NewRadixTree[int]()
+	for i, w := range loadTestFile("test-text/words.txt") {
+		r, _, _ = r.Insert(w, i)
+	}
+	sum := 0
+	for depth, n := range r.DepthHistogram() {
+		require.Positive(t, depth)
+		sum += n
+	}
+	require.Equal(t, r.Len(), sum)
+}
+
+// longKeys returns n random keys that share all but their last 8 bytes.
+func longKeys(n, size int, seed int64) [][]byte {
+	rng := rand.New(rand.NewSource(seed))
+	shared := make([]byte, size-8)
+	rng.Read(shared)
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = append(slices.Clone(shared), make([]byte, 8)...)
+		rng.Read(keys[i][size-8:])
+	}
+	return keys
+}
+
+func TestKeyFingerprints(t *testing.T) {
+	keys := longKeys(2000, 256, 1)
+	r := NewRadixTreeWithOptions[int](Options{KeyFingerprints: true})
+	for i, k := range keys[:1000] {
+		r, _, _ = r.Insert(k, i)
+	}
+	// Updates and deletes keep the fingerprints of the other keys
+	for i, k := range keys[:500] {
+		r, _, _ = r.Insert(k, -i)
+	}
+	r, _, _ = r.Delete(keys[999])
+	r, _, _ = r.Insert([]byte("short"), 7)
+
+	it := r.RawIterator()
+	for it.Next(); it.Front() != nil; it.Next() {
+		if l, ok := it.Front().(*NodeLeaf[int]); ok && len(l.key) > 0 {
+			require.Equal(t, keyFingerprint(l.key), l.fingerprint, "key %q", l.key)
+		}
+	}
+
+	for i, k := range keys {
+		v, ok := r.Get(k)
+		_, wv, wok := r.GetWatch(k)
+		switch {
+		case i < 500:
+			require.True(t, ok)
+			require.Equal(t, -i, v)
+		case i < 999:
+			require.True(t, ok)
+			require.Equal(t, i, v)
+		default:
+			require.False(t, ok)
+		}
+		require.Equal(t, ok, wok)
+		require.Equal(t, v, wv)
+	}
+	v, ok := r.Get([]byte("short"))
+	require.True(t, ok)
+	require.Equal(t, 7, v)
+}
+
+func TestKeyFingerprints_Collisions(t *testing.T) {
+	defer func(f func([]byte) uint64) { keyFingerprint = f }(keyFingerprint)
+
+	for name, fp := range map[string]func([]byte) uint64{
+		"constant": func([]byte) uint64 { return 1 },
+		"length":   func(k []byte) uint64 { return uint64(len(k)) | 1 },
+	} {
+		keyFingerprint = fp
+		keys := loadTestFile("test-text/words.txt")
+		r := NewRadixTreeWithOptions[int](Options{KeyFingerprints: true})
+		for i, k := range keys[:5000] {
+			r, _, _ = r.Insert(k, i)
+		}
+		for i, k := range keys {
+			v, ok := r.Get(k)
+			require.Equal(t, i < 5000, ok, "%s: key %q", name, k)
+			if ok {
+				require.Equal(t, i, v)
+			}
+		}
+		r, _, ok := r.Delete(keys[0])
+		require.True(t, ok)
+		require.False(t, r.Contains(keys[0]))
+		require.True(t, r.Contains(keys[1]))
+	}
+}
+
+func BenchmarkGetLongKeyMissing(b *testing.B) {
+	keys := longKeys(20000, 4096, 1)
+	for _, fingerprints := range []bool{false, true} {
+		b.Run(fmt.Sprintf("fingerprints=%v", fingerprints), func(b *testing.B) {
+			txn := NewRadixTreeWithOptions[int](Options{KeyFingerprints: fingerprints}).Txn(false)
+			for i, k := range keys[:10000] {
+				txn.Insert(k, i)
+			}
+			r := txn.Commit()
+			// Missing keys that still end at a leaf, as they differ from a
+			// stored key only in their last byte
+			missing := make([][]byte, 10000)
+			for i, k := range keys[:10000] {
+				missing[i] = slices.Clone(k)
+				missing[i][len(k)-1]++
+			}
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				r.Get(missing[n%len(missing)])
+			}
+		})
+	}
+}
+
+func TestAllRef(t *testing.T) {
+	r := NewRadixTree[int]()
+	for i, k := range loadTestFile("test-text/words.txt") {
+		r, _, _ = r.Insert(k, i)
+	}
+	r, _, _ = r.Insert([]byte(""), -1)
+
+	var keys []string
+	var values []int
+	r.Walk(func(k []byte, v int) bool {
+		keys = append(keys, string(k))
+		values = append(values, v)
+		return false
+	})
+	var gotKeys []string
+	var gotValues []int
+	for k, v := range r.AllRef() {
+		gotKeys = append(gotKeys, string(k))
+		gotValues = append(gotValues, *v)
+	}
+	require.Equal(t, keys, gotKeys)
+	require.Equal(t, values, gotValues)
+
+	// The pointers lead to the stored values rather than to copies
+	for k, v := range r.AllRef() {
+		l := r.searchFrom(r.root, 0, getTreeKey(k), nil)
+		require.Same(t, &l.value, v)
+		break
+	}
+
+	n := 0
+	for range r.AllRef() {
+		n++
+		if n == 3 {
+			break
+		}
+	}
+	require.Equal(t, 3, n)
+
+	for range NewRadixTree[int]().AllRef() {
+		t.Fatal("empty tree yielded a key")
+	}
+}
+
+type largeValue struct {
+	data [256]uint64
+}
+
+func BenchmarkScanLargeValues(b *testing.B) {
+	txn := NewRadixTree[largeValue]().Txn(false)
+	for i := 0; i < 10000; i++ {
+		var v largeValue
+		v.data[0] = uint64(i)
+		txn.Insert(EncodeUint64BigEndian(uint64(i)), v)
+	}
+	r := txn.Commit()
+
+	b.Run("value", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			var sum uint64
+			r.Walk(func(k []byte, v largeValue) bool {
+				sum += v.data[0]
+				return false
+			})
+		}
+	})
+	b.Run("ref", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			var sum uint64
+			for _, v := range r.AllRef() {
+				sum += v.data[0]
+			}
+		}
+	})
+}
+
+func TestInsertAll(t *testing.T) {
+	var pairs []Pair[int]
+	for i := 0; i < 1000; i++ {
+		pairs = append(pairs, Pair[int]{[]byte(fmt.Sprintf("key/%04d", i)), i})
+	}
+	base := NewRadixTree[int]()
+	r := base.InsertAll(pairs)
+	require.Equal(t, 1000, r.Len())
+	require.Zero(t, base.Len())
+	v, ok := r.Get([]byte("key/0500"))
+	require.True(t, ok)
+	require.Equal(t, 500, v)
+	require.Equal(t, r.Generation()-1, base.Generation())
+
+	// The last of several pairs for a key wins, and existing keys are kept
+	r = r.InsertAll([]Pair[int]{{[]byte("key/0001"), -1}, {[]byte("new"), 1}, {[]byte("key/0001"), -2}})
+	require.Equal(t, 1001, r.Len())
+	v, _ = r.Get([]byte("key/0001"))
+	require.Equal(t, -2, v)
+	require.Equal(t, walkKeys(r), walkKeys(r.InsertAll(nil)))
+}
+
+func TestReturnedKeysAppend(t *testing.T) {
+	r := NewRadixTree[int]()
+	words := loadTestFile("test-text/words.txt")[:2000]
+	for i, w := range words {
+		r, _, _ = r.Insert(w, i)
+	}
+	want := walkKeys(r)
+
+	// Appending to any key handed out must leave the stored key alone
+	scribble := func(k []byte) {
+		_ = append(k, "XYZ"...)
+	}
+	r.Walk(func(k []byte, v int) bool {
+		scribble(k)
+		return false
+	})
+	it := r.Root().Iterator()
+	it.SeekPrefix(nil)
+	for k, _, ok := it.Next(); ok; k, _, ok = it.Next() {
+		scribble(k)
+		scribble(it.RawKey())
+	}
+	rit := r.Root().ReverseIterator()
+	for k, _, ok := rit.Previous(); ok; k, _, ok = rit.Previous() {
+		scribble(k)
+	}
+	for k := range r.AllRef() {
+		scribble(k)
+	}
+	for _, w := range words {
+		k, _, _ := r.GetExactKey(w)
+		scribble(k)
+		k, _, _ = r.LongestPrefix(append(slices.Clone(w), '!'))
+		scribble(k)
+		k, _, _ = r.MinimumPrefix(w)
+		scribble(k)
+	}
+	segments, _ := r.ListChildren(nil, 'a')
+	for _, s := range segments {
+		scribble(s)
+	}
+
+	require.Equal(t, want, walkKeys(r))
+	for i, w := range words {
+		v, ok := r.Get(w)
+		require.True(t, ok, "key %q", w)
+		require.Equal(t, i, v)
+	}
+}
+
+// spareCapKeys returns copies of keys with room for one more byte
+func spareCapKeys(keys [][]byte) [][]byte {
+	out := make([][]byte, len(keys))
+	for i, k := range keys {
+		out[i] = append(make([]byte, 0, len(k)+1), k...)
+	}
+	return out
+}
+
+func TestZeroCopyKeys(t *testing.T) {
+	keys := longKeys(1000, 64, 1)
+	spare := spareCapKeys(keys[:500])
+	r := NewRadixTreeWithOptions[int](Options{ZeroCopyKeys: true})
+	txn := r.Txn(false)
+	for i, k := range spare {
+		txn.Insert(k, i)
+	}
+	// Keys without spare capacity are copied
+	for i, k := range keys[500:] {
+		txn.Insert(k[:len(k):len(k)], 500+i)
+	}
+	txn.Insert([]byte{}, -1)
+	r = txn.Commit()
+	require.Equal(t, 1001, r.Len())
+
+	for i, k := range keys {
+		v, ok := r.Get(k)
+		require.True(t, ok, "key %q", k)
+		require.Equal(t, i, v)
+	}
+	v, ok := r.Get(nil)
+	require.True(t, ok)
+	require.Equal(t, -1, v)
+
+	// The callers' slices are stored as they are
+	stored := make(map[*byte]bool)
+	for k := range r.AllRef() {
+		if len(k) > 0 {
+			stored[&k[0]] = true
+		}
+	}
+	for _, k := range spare {
+		require.True(t, stored[&k[0]], "key %q was copied", k)
+	}
+	for _, k := range keys[500:] {
+		require.False(t, stored[&k[0]], "key %q was not copied", k)
+	}
+}
+
+func TestKeyTransform(t *testing.T) {
+	r := NewRadixTreeWithOptions[int](Options{KeyTransform: bytes.ToLower})
+	r, _, _ = r.Insert([]byte("foo"), 1)
+	r, _, _ = r.Insert([]byte("Foo/Bar"), 2)
+	r, _, _ = r.Insert([]byte("BAZ"), 3)
+
+	// Lookups match whatever the case
+	v, ok := r.Get([]byte("FOO"))
+	require.True(t, ok)
+	require.Equal(t, 1, v)
+	_, v, ok = r.GetWatch([]byte("foo/bar"))
+	require.True(t, ok)
+	require.Equal(t, 2, v)
+	k, v, ok := r.LongestPrefix([]byte("FOO/BAR/QUX"))
+	require.True(t, ok)
+	require.Equal(t, "Foo/Bar", string(k))
+	require.Equal(t, 2, v)
+	values, found := r.GetMulti([][]byte{[]byte("Baz"), []byte("FOO"), []byte("qux")})
+	require.Equal(t, []int{3, 1, 0}, values)
+	require.Equal(t, []bool{true, true, false}, found)
+
+	// Keys come back as they were inserted, ordered by their normalized form
+	require.Equal(t, []string{"BAZ", "foo", "Foo/Bar"}, walkKeys(r))
+	var reversed []string
+	it := r.Root().ReverseIterator()
+	for k, _, ok := it.Previous(); ok; k, _, ok = it.Previous() {
+		reversed = append(reversed, string(k))
+	}
+	require.Equal(t, []string{"Foo/Bar", "foo", "BAZ"}, reversed)
+
+	// Inserting another spelling updates the key and keeps the latest one
+	r, old, ok := r.Insert([]byte("FOO"), 10)
+	require.True(t, ok)
+	require.Equal(t, 1, old)
+	require.Equal(t, 3, r.Len())
+	k, v, ok = r.GetExactKey([]byte("foo"))
+	require.True(t, ok)
+	require.Equal(t, "FOO", string(k))
+	require.Equal(t, 10, v)
+
+	r, old, ok = r.Delete([]byte("baz"))
+	require.True(t, ok)
+	require.Equal(t, 3, old)
+	require.Equal(t, []string{"FOO", "Foo/Bar"}, walkKeys(r))
+}
+
+func TestKeyTransform_Bounds(t *testing.T) {
+	opts := Options{KeyTransform: bytes.ToLower}
+	r := NewRadixTreeWithOptions[int](opts)
+	for i, k := range []string{"Apple", "BANANA", "cherry", "Date"} {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+	strs := func(keys [][]byte) []string {
+		var out []string
+		for _, k := range keys {
+			out = append(out, string(k))
+		}
+		return out
+	}
+
+	// Bounds are compared with the normalized keys, which order the tree
+	keys, _ := r.Range(nil, []byte("b"))
+	require.Equal(t, []string{"Apple"}, strs(keys))
+	keys, _ = r.Range([]byte("b"), []byte("d"))
+	require.Equal(t, []string{"BANANA", "cherry"}, strs(keys))
+
+	var got []string
+	it := r.Root().LowerBoundIterator()
+	it.SeekPrefixLowerBound([]byte("b"), nil)
+	for k, _, ok := it.Next(); ok; k, _, ok = it.Next() {
+		got = append(got, string(k))
+	}
+	require.Equal(t, []string{"BANANA"}, got)
+
+	got = nil
+	ri := r.Root().ReverseIterator()
+	ri.SeekReverseRange([]byte("a"), []byte("c"))
+	for k, _, ok := ri.Previous(); ok; k, _, ok = ri.Previous() {
+		got = append(got, string(k))
+	}
+	require.Equal(t, []string{"BANANA", "Apple"}, got)
+
+	// Prefix methods hand back the keys as inserted, and CommonPrefix the
+	// normalized prefix the keys share
+	k, _, ok := r.MinimumPrefix(nil)
+	require.True(t, ok)
+	require.Equal(t, "Apple", string(k))
+	k, _, ok = r.MaximumPrefix(nil)
+	require.True(t, ok)
+	require.Equal(t, "Date", string(k))
+	require.Equal(t, "banana", string(r.CommonPrefix([]byte("b"))))
+
+	// Split boundaries cover every key in order
+	var split []string
+	for _, b := range r.Split(2) {
+		keys, _ := r.Range(b.Lo, b.Hi)
+		split = append(split, strs(keys)...)
+	}
+	require.Equal(t, walkKeys(r), split)
+
+	// Merging orders keys from every tree by their normalized form
+	other := NewRadixTreeWithOptions[int](opts)
+	other, _, _ = other.Insert([]byte("Blueberry"), 4)
+	other, _, _ = other.Insert([]byte("avocado"), 5)
+	got = nil
+	m := NewMergeIterator(MergeFirstWins, r, other)
+	for k, _, ok := m.Next(); ok; k, _, ok = m.Next() {
+		got = append(got, string(k))
+	}
+	require.Equal(t, []string{"Apple", "avocado", "BANANA", "Blueberry", "cherry", "Date"}, got)
+
+	txn := r.Txn(false)
+	require.Equal(t, 2, txn.DeleteRangeFunc([]byte("b"), []byte("d"), func([]byte, int) bool { return true }))
+	require.Equal(t, []string{"Apple", "Date"}, walkKeys(txn.Commit()))
+}
+
+func TestKeyTransform_LengthChange(t *testing.T) {
+	// The normalized keys are longer than the inserted ones, so the prefixes
+	// only line up with the stored keys
+	opts := Options{KeyTransform: func(k []byte) []byte {
+		return bytes.ReplaceAll(k, []byte("x"), []byte("xxxx"))
+	}}
+	r := NewRadixTreeWithOptions[int](opts)
+	for i, k := range []string{"x", "x/a", "x/b/c", "y"} {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	var suffixes []string
+	r.WalkPrefixStripped([]byte("xxxx/"), func(k []byte, _ int) bool {
+		suffixes = append(suffixes, string(k))
+		return false
+	})
+	require.Equal(t, []string{"a", "b/c"}, suffixes)
+
+	txn := r.Txn(false)
+	require.True(t, txn.DeleteChildren([]byte("xxxx/"), '/'))
+	require.Equal(t, []string{"x", "x/b/c", "y"}, walkKeys(txn.Commit()))
+
+	txn = r.Txn(false)
+	require.Equal(t, 2, txn.RetainPrefixes([][]byte{[]byte("xxxx/")}))
+	require.Equal(t, []string{"x/a", "x/b/c"}, walkKeys(txn.Commit()))
+}
+
+func BenchmarkInsertZeroCopyKeys(b *testing.B) {
+	keys := longKeys(10000, 1024, 1)
+	for _, zeroCopy := range []bool{false, true} {
+		b.Run(fmt.Sprintf("zeroCopy=%v", zeroCopy), func(b *testing.B) {
+			spare := spareCapKeys(keys)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				txn := NewRadixTreeWithOptions[int](Options{ZeroCopyKeys: zeroCopy}).Txn(false)
+				for i, k := range spare {
+					txn.Insert(k, i)
+				}
+				txn.Commit()
+			}
+		})
+	}
+}
+
+// hasMutateCh returns whether n has made its watch channel
+func hasMutateCh[T any](n Node[T]) bool {
+	switch n := n.(type) {
+	case *NodeLeaf[T]:
+		return n.mutateCh.Load() != nil
+	case *Node4[T]:
+		return n.mutateCh.Load() != nil
+	case *Node16[T]:
+		return n.mutateCh.Load() != nil
+	case *Node48[T]:
+		return n.mutateCh.Load() != nil
+	case *Node256[T]:
+		return n.mutateCh.Load() != nil
+	}
+	return false
+}
+
+// evenKeysTree returns a decoded tree holding even numbered keys, whose nodes
+// have not made their watch channels, along with the odd numbered keys
+func evenKeysTree(tb testing.TB, n int, opts Options) (*RadixTree[int], [][]byte) {
+	txn := NewRadixTree[int]().Txn(false)
+	missing := make([][]byte, n)
+	for i := 0; i < n; i++ {
+		txn.Insert([]byte(fmt.Sprintf("key%06d", 2*i)), i)
+		missing[i] = []byte(fmt.Sprintf("key%06d", 2*i+1))
+	}
+	data, err := txn.Commit().MarshalBinary()
+	require.NoError(tb, err)
+	r := NewRadixTreeWithOptions[int](opts)
+	require.NoError(tb, r.UnmarshalBinary(data))
+	return r, missing
+}
+
+func TestGetWatch_MissingKeyChannels(t *testing.T) {
+	countChannels := func(r *RadixTree[int]) int {
+		count := 0
+		it := r.RawIterator()
+		for it.Next(); it.Front() != nil; it.Next() {
+			if hasMutateCh(it.Front()) {
+				count++
+			}
+		}
+		return count
+	}
+
+	// With watching disabled misses make no channels, and cost no more than
+	// a Get
+	r, missing := evenKeysTree(t, 1000, Options{DisableWatch: true})
+	for _, k := range missing {
+		ch, _, ok := r.GetWatch(k)
+		require.False(t, ok)
+		require.Nil(t, ch)
+	}
+	require.Zero(t, countChannels(r))
+	i := 0
+	watchAllocs := testing.AllocsPerRun(1000, func() {
+		r.GetWatch(missing[i%len(missing)])
+		i++
+	})
+	getAllocs := testing.AllocsPerRun(1000, func() {
+		r.Get(missing[i%len(missing)])
+		i++
+	})
+	require.LessOrEqual(t, watchAllocs, getAllocs)
+
+	// Otherwise a miss makes the channel of the node it reached, once
+	r, missing = evenKeysTree(t, 1000, Options{})
+	require.Zero(t, countChannels(r))
+	watches := make([]<-chan struct{}, len(missing))
+	for i, k := range missing {
+		watches[i], _, _ = r.GetWatch(k)
+		require.NotNil(t, watches[i])
+	}
+	made := countChannels(r)
+	require.NotZero(t, made)
+	for i, k := range missing {
+		ch, _, _ := r.GetWatch(k)
+		require.Equal(t, watches[i], ch)
+	}
+	require.Equal(t, made, countChannels(r))
+
+	// and adding the key closes it
+	txn := r.Txn(false)
+	txn.TrackMutate(true)
+	txn.Insert(missing[0], 0)
+	txn.Commit()
+	select {
+	case <-watches[0]:
+	default:
+		t.Fatal("watch for missing key was not closed by inserting it")
+	}
+}
+
+func BenchmarkGetWatchMissing(b *testing.B) {
+	for _, disable := range []bool{false, true} {
+		b.Run(fmt.Sprintf("disableWatch=%v", disable), func(b *testing.B) {
+			r, missing := evenKeysTree(b, 10000, Options{DisableWatch: disable})
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				r.GetWatch(missing[n%len(missing)])
+			}
+		})
+	}
+}
+
+func TestRecycleNodes(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	keys := make([][]byte, 300)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key/%d/%d", i%7, i))
+	}
+
+	type snapshot struct {
+		tree *RadixTree[int]
+		want map[string]int
+	}
+	var snapshots []snapshot
+	want := make(map[string]int)
+	r := NewRadixTree[int]()
+	txn := r.Txn(false)
+	txn.RecycleNodes(true)
+	recycled := 0
+	for i := 0; i < 20000; i++ {
+		k := keys[rng.Intn(len(keys))]
+		if rng.Intn(2) == 0 {
+			txn.Insert(k, i)
+			want[string(k)] = i
+		} else {
+			txn.Delete(k)
+			delete(want, string(k))
+		}
+		recycled += len(txn.freeLeaves)
+		if i%1000 == 999 {
+			r = txn.Commit()
+			snapshots = append(snapshots, snapshot{r, maps.Clone(want)})
+			txn = r.Txn(false)
+			txn.RecycleNodes(true)
+		}
+	}
+	require.NotZero(t, recycled)
+
+	// Every committed tree still holds what it held when it was committed
+	for _, s := range snapshots {
+		verifyTree(t, s.tree)
+		require.Equal(t, len(s.want), s.tree.Len())
+		for k, v := range s.want {
+			got, ok := s.tree.Get([]byte(k))
+			require.True(t, ok, "key %q", k)
+			require.Equal(t, v, got)
+		}
+	}
+}
+
+func TestRecycleNodes_Sealed(t *testing.T) {
+	txn := NewRadixTree[int]().Txn(false)
+	txn.RecycleNodes(true)
+	txn.Insert([]byte("foo"), 1)
+	txn.Insert([]byte("bar"), 2)
+	txn.Delete([]byte("bar"))
+	require.NotEmpty(t, txn.freeLeaves)
+	require.NotEmpty(t, txn.freeNode4s)
+
+	// Inserting takes the dropped nodes back
+	txn.Insert([]byte("baz"), 3)
+	require.Empty(t, txn.freeLeaves)
+
+	// Nodes reachable from a root that was handed out are not recycled, as
+	// an iterator may still be walking them
+	txn.Root()
+	txn.Delete([]byte("baz"))
+	require.Empty(t, txn.freeLeaves)
+	require.Empty(t, txn.freeNode4s)
+
+	// Nor are nodes of the tree the transaction started from
+	txn = txn.Commit().Txn(false)
+	txn.RecycleNodes(true)
+	txn.Delete([]byte("foo"))
+	require.Empty(t, txn.freeLeaves)
+	require.Empty(t, txn.freeNode4s)
+
+	// Without recycling nothing is kept
+	txn = NewRadixTree[int]().Txn(false)
+	txn.Insert([]byte("foo"), 1)
+	txn.Delete([]byte("foo"))
+	require.Empty(t, txn.freeLeaves)
+}
+
+func BenchmarkInsertDeleteCycle(b *testing.B) {
+	keys := make([][]byte, 1000)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key/%d/%d", i%7, i))
+	}
+	for _, recycle := range []bool{false, true} {
+		b.Run(fmt.Sprintf("recycle=%v", recycle), func(b *testing.B) {
+			txn := NewRadixTree[int]().Txn(false)
+			for i, k := range keys[:500] {
+				txn.Insert(k, i)
+			}
+			txn = txn.Commit().Txn(false)
+			txn.RecycleNodes(recycle)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				k := keys[500+n%500]
+				txn.Insert(k, n)
+				txn.Delete(k)
+			}
+		})
+	}
+}
+
+func TestChildAt(t *testing.T) {
+	r := NewRadixTree[int]()
+	for i, k := range []string{"abc", "abd", "ab", "x"} {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+
+	// Follow "abd" down from the root, skipping over each node's prefix
+	key := getTreeKey([]byte("abd"))
+	n := r.Root()
+	for depth := 0; !n.isLeaf(); depth++ {
+		depth += int(n.getPartialLen())
+		next, ok := n.ChildAt(key[depth])
+		require.True(t, ok, "no edge for %q at depth %d", key[depth], depth)
+		n = next
+	}
+	var got []string
+	n.Walk(func(k []byte, v int) bool {
+		got = append(got, string(k))
+		require.Equal(t, 1, v)
+		return false
+	})
+	require.Equal(t, []string{"abd"}, got)
+
+	// "ab" was added after "abc" and "abd", but ends at their node, so it is
+	// the node's own leaf rather than a child along the terminator
+	a, ok := r.Root().ChildAt('a')
+	require.True(t, ok)
+	_, ok = a.ChildAt('$')
+	require.False(t, ok)
+	require.Equal(t, "ab", string(getKey(a.getNodeLeaf().getKey())))
+
+	_, ok = r.Root().ChildAt('q')
+	require.False(t, ok)
+	_, ok = a.ChildAt('e')
+	require.False(t, ok)
+	_, ok = n.ChildAt('$')
+	require.False(t, ok)
+	_, ok = n.getNodeLeaf().ChildAt('a')
+	require.False(t, ok)
+}
+
+func TestRootFanout(t *testing.T) {
+	r := NewRadixTree[int]()
+	require.Zero(t, r.RootFanout())
+
+	for i, k := range []string{"apple", "avocado", "banana", "cherry"} {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+	require.Equal(t, 3, r.RootFanout())
+	r, _, _ = r.Insert(nil, 0)
+	require.Equal(t, 4, r.RootFanout())
+
+	// A key ending at a node counts as a branch, whichever order the keys
+	// were inserted in
+	for _, keys := range [][]string{{"foo", "foo/x", "foo/y"}, {"foo/x", "foo/y", "foo"}} {
+		r = NewRadixTree[int]()
+		for i, k := range keys {
+			r, _, _ = r.Insert([]byte(k), i)
+		}
+		require.Equal(t, 2, r.RootFanout(), "keys %q", keys)
+	}
+
+	// Every first byte
+	r = NewRadixTree[int]()
+	for c := 0; c < 256; c++ {
+		r, _, _ = r.Insert([]byte{byte(c), 'x'}, c)
+	}
+	require.Equal(t, 256, r.RootFanout())
+	leaf, _ := r.Root().ChildAt('x')
+	require.Zero(t, leaf.getNodeLeaf().Fanout())
+}
+
+func TestInsert_SingleByteFanout(t *testing.T) {
+	// Keys differing only in their last byte all hang off one node, which has
+	// to grow through every node type to hold them
+	key := func(i int) []byte { return []byte{'p', 'r', 'e', byte(i)} }
+	r := NewRadixTree[int]()
+	for i := 0; i < 200; i++ {
+		r, _, _ = r.Insert(key(i), i)
+		stats := r.Stats()
+		switch n := i + 1; {
+		case n > 48:
+			require.Equal(t, 1, stats.Node256, "%d keys", n)
+		case n > 16:
+			require.Equal(t, 1, stats.Node48, "%d keys", n)
+		case n > 4:
+			require.Equal(t, 1, stats.Node16, "%d keys", n)
+		}
+	}
+	require.Equal(t, 200, r.Len())
+	for i := 0; i < 200; i++ {
+		v, ok := r.Get(key(i))
+		require.True(t, ok, "key %d", i)
+		require.Equal(t, i, v)
+	}
+	verifyTree(t, r)
+}
+
+func TestTerminatorLikeKeys(t *testing.T) {
+	// Keys are stored with a '$' terminator, which must not make keys that
+	// contain '$' or a zero byte, or are prefixes of each other, collide
+	keys := []string{"foo", "foobar", "foo$", "foo$$", "foo\x00", "fo", "$", ""}
+	r := NewRadixTree[int]()
+	for i, k := range keys[:2] {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+	for _, k := range keys[2:] {
+		_, ok := r.Get([]byte(k))
+		require.False(t, ok, "key %q", k)
+	}
+
+	for i, k := range keys {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+	require.Equal(t, len(keys), r.Len())
+	for i, k := range keys {
+		v, ok := r.Get([]byte(k))
+		require.True(t, ok, "key %q", k)
+		require.Equal(t, i, v, "key %q", k)
+	}
+	require.Equal(t, []string{"", "$", "fo", "foo", "foo\x00", "foo$", "foo$$", "foobar"}, walkKeys(r))
+	for q, want := range map[string]string{"foo$x": "foo$", "foo\x00x": "foo\x00", "fooba": "foo", "foo$$$": "foo$$"} {
+		k, _, ok := r.LongestPrefix([]byte(q))
+		require.True(t, ok)
+		require.Equal(t, want, string(k), "longest prefix of %q", q)
+	}
+	verifyTree(t, r)
+
+	for i, k := range keys {
+		var ok bool
+		r, _, ok = r.Delete([]byte(k))
+		require.True(t, ok, "key %q", k)
+		require.Equal(t, len(keys)-i-1, r.Len())
+	}
+}
+
+func TestNodePrefix(t *testing.T) {
+	r := NewRadixTree[int]()
+	r, _, _ = r.Insert([]byte("abcdef/1"), 1)
+	r, _, _ = r.Insert([]byte("abcdef/2"), 2)
+	require.Equal(t, "abcdef/", string(r.Root().Prefix()))
+	require.Equal(t, uint32(7), r.Root().getPartialLen())
+
+	// A shared run longer than the partial buffer is only stored in part
+	long := "0123456789abcdefghij"
+	r = NewRadixTree[int]()
+	r, _, _ = r.Insert([]byte(long+"x"), 1)
+	r, _, _ = r.Insert([]byte(long+"y"), 2)
+	require.Equal(t, long[:maxPrefixLen], string(r.Root().Prefix()))
+	require.Equal(t, uint32(len(long)), r.Root().getPartialLen())
+
+	// Appending to the prefix leaves the node alone
+	p := append(r.Root().Prefix(), 'z')
+	require.Equal(t, long[:maxPrefixLen]+"z", string(p))
+	require.Equal(t, long[:maxPrefixLen], string(r.Root().Prefix()))
+
+	child, ok := r.Root().ChildAt('x')
+	require.True(t, ok)
+	require.Empty(t, child.Prefix())
+	require.Empty(t, NewRadixTree[int]().Root().Prefix())
+}
+
+func TestSplit(t *testing.T) {
+	r := NewRadixTree[int]()
+	for i, k := range loadTestFile("test-text/words.txt")[:20000] {
+		r, _, _ = r.Insert(k, i)
+	}
+	all := walkKeys(r)
+
+	check := func(r *RadixTree[int], ranges []RangeBound) {
+		var got []string
+		for i, rb := range ranges {
+			if i > 0 {
+				require.Equal(t, ranges[i-1].Hi, rb.Lo)
+			}
+			keys, _ := r.Range(rb.Lo, rb.Hi)
+			for _, k := range keys {
+				got = append(got, string(k))
+			}
+		}
+		require.Nil(t, ranges[0].Lo)
+		require.Nil(t, ranges[len(ranges)-1].Hi)
+		require.Equal(t, walkKeys(r), got)
+	}
+
+	for _, n := range []int{1, 2, 7, 16} {
+		ranges := r.Split(n)
+		require.Len(t, ranges, n)
+		check(r, ranges)
+		for _, rb := range ranges {
+			keys, _ := r.Range(rb.Lo, rb.Hi)
+			want := len(all) / n
+			require.InDelta(t, want, len(keys), float64(want)/4, "n=%d", n)
+		}
+	}
+	require.Equal(t, r.Split(7), r.Split(7))
+
+	// Fewer keys than ranges
+	small := NewRadixTree[int]()
+	for i, k := range []string{"a", "b", "c"} {
+		small, _, _ = small.Insert([]byte(k), i)
+	}
+	ranges := small.Split(5)
+	require.LessOrEqual(t, len(ranges), 3)
+	check(small, ranges)
+
+	require.Equal(t, []RangeBound{{}}, NewRadixTree[int]().Split(4))
+	require.Nil(t, r.Split(0))
+}
+
+func TestPartitions(t *testing.T) {
+	r := NewRadixTree[int]()
+	words := loadTestFile("test-text/words.txt")[:20000]
+	for i, k := range words {
+		r, _, _ = r.Insert(k, i)
+	}
+	// Keys ending at nodes and prefixes too long to store on a node
+	long := strings.Repeat("x", 30)
+	for i, k := range []string{"", "a", "ab", long, long + "a", long + "ab", long + "b"} {
+		r, _, _ = r.Insert([]byte(k), -i)
+	}
+
+	for _, size := range []int{1, 10, 500, 5000} {
+		var got []string
+		parts := 0
+		for p := range r.Partitions(size) {
+			parts++
+			keys := walkKeys(p)
+			require.Equal(t, len(keys), p.Len())
+			require.NotZero(t, p.Len())
+			// Each partition is a working tree of its own
+			for _, k := range keys {
+				want, _ := r.Get([]byte(k))
+				v, ok := p.Get([]byte(k))
+				require.True(t, ok, "size %d key %q", size, k)
+				require.Equal(t, want, v)
+			}
+			got = append(got, keys...)
+		}
+		require.Equal(t, walkKeys(r), got, "size %d", size)
+		require.GreaterOrEqual(t, parts, r.Len()/size)
+	}
+
+	// Stopping early
+	n := 0
+	for range r.Partitions(100) {
+		n++
+		if n == 3 {
+			break
+		}
+	}
+	require.Equal(t, 3, n)
+
+	// Writing to a partition leaves the tree alone
+	for p := range r.Partitions(100) {
+		k := getKey(p.Minimum().getKey())
+		p, _, _ = p.Delete(k)
+		p, _, _ = p.Insert([]byte("aaaa-new"), 1)
+		require.True(t, p.Contains([]byte("aaaa-new")))
+		require.False(t, r.Contains([]byte("aaaa-new")))
+		require.True(t, r.Contains(k))
+		break
+	}
+
+	var whole []*RadixTree[int]
+	for p := range r.Partitions(r.Len()) {
+		whole = append(whole, p)
+	}
+	require.Equal(t, []*RadixTree[int]{r}, whole)
+	for range NewRadixTree[int]().Partitions(10) {
+		t.Fatal("partition of an empty tree")
+	}
+}
+
+func TestSharedNodeCount(t *testing.T) {
+	r := NewRadixTree[int]()
+	for i, k := range loadTestFile("test-text/words.txt")[:5000] {
+		r, _, _ = r.Insert(k, i)
+	}
+	total := countNodes(r.root)
+	require.Equal(t, total, SharedNodeCount(r, r))
+
+	// Updating one key copies the nodes on its path and nothing else
+	key := []byte("abandon")
+	_, ok := r.Get(key)
+	require.True(t, ok)
+	r2, _, _ := r.Insert(key, -1)
+	var path []Node[int]
+	tk := getTreeKey(key)
+	n := r2.Root()
+	for depth := 0; ; depth++ {
+		path = append(path, n)
+		if l := n.getNodeLeaf(); l != nil && bytes.Equal(l.getKey(), tk) {
+			path = append(path, l)
+			break
+		}
+		depth += int(n.getPartialLen())
+		n, ok = n.ChildAt(tk[depth])
+		require.True(t, ok)
+	}
+	require.Equal(t, countNodes(r2.root), total)
+	require.Equal(t, total-len(path), SharedNodeCount(r, r2))
+	require.Equal(t, total-len(path), SharedNodeCount(r2, r))
+
+	// Transactions cloned from the same tree reuse ids, but not nodes
+	txn := r.Txn(false)
+	clone := txn.Clone(false)
+	txn.Insert([]byte("zzz1"), 1)
+	clone.Insert([]byte("zzz2"), 2)
+	a, b := txn.Commit(), clone.Commit()
+	shared := SharedNodeCount(a, b)
+	require.Less(t, shared, total)
+	require.Greater(t, shared, total/2)
+
+	require.Zero(t, SharedNodeCount(r, NewRadixTree[int]()))
+}
+
+// recordingAllocator remembers every node it hands out.
+type recordingAllocator[T any] struct {
+	nodes map[Node[T]]bool
+}
+
+func (a *recordingAllocator[T]) NewLeaf() *NodeLeaf[T] {
+	n := &NodeLeaf[T]{}
+	a.nodes[n] = true
+	return n
+}
+
+func (a *recordingAllocator[T]) NewNode4() *Node4[T] {
+	n := &Node4[T]{}
+	a.nodes[n] = true
+	return n
+}
+
+func (a *recordingAllocator[T]) NewNode16() *Node16[T] {
+	n := &Node16[T]{}
+	a.nodes[n] = true
+	return n
+}
+
+func (a *recordingAllocator[T]) NewNode48() *Node48[T] {
+	n := &Node48[T]{}
+	a.nodes[n] = true
+	return n
+}
+
+func (a *recordingAllocator[T]) NewNode256() *Node256[T] {
+	n := &Node256[T]{}
+	a.nodes[n] = true
+	return n
+}
+
+func TestAllocator(t *testing.T) {
+	alloc := &recordingAllocator[int]{nodes: make(map[Node[int]]bool)}
+	r := NewRadixTreeWithOptions[int](Options{Allocator: alloc})
+
+	txn := r.Txn(false)
+	for i := 0; i < 1000; i++ {
+		txn.Insert([]byte(fmt.Sprintf("key%d", i)), i)
+	}
+	for i := 0; i < 256; i++ {
+		txn.Insert([]byte{'k', byte(i), 'x'}, i)
+	}
+	r = txn.Commit()
+	require.Equal(t, 1256, r.Len())
+
+	// The first insert puts its key on the transaction's copy of the empty
+	// tree's root, which later inserts push down the tree. Every other node
+	// was made by the allocator.
+	var others []Node[int]
+	walkNodes(r.Root(), func(n Node[int]) bool {
+		if !alloc.nodes[n] {
+			others = append(others, n)
+		}
+		return true
+	})
+	require.Len(t, others, 1)
+
+	v, ok := r.Get([]byte("key500"))
+	require.True(t, ok)
+	require.Equal(t, 500, v)
+
+	require.Panics(t, func() {
+		NewRadixTreeWithOptions[string](Options{Allocator: alloc})
+	})
+}
+
+func TestDistinctValues(t *testing.T) {
+	eq := func(a, b int) bool { return a == b }
+	r := NewRadixTree[int]()
+	require.Empty(t, r.DistinctValues(eq))
+
+	const (
+		pending = iota
+		running
+		done
+	)
+	states := map[string]int{
+		"job/a": running,
+		"job/b": done,
+		"job/c": running,
+		"job/d": pending,
+		"job/e": done,
+	}
+	for k, v := range states {
+		r, _, _ = r.Insert([]byte(k), v)
+	}
+	// In the order of the first key holding each value
+	require.Equal(t, []int{running, done, pending}, r.DistinctValues(eq))
+
+	// eq decides what counts as the same value
+	require.Equal(t, []int{running, done}, r.DistinctValues(func(a, b int) bool {
+		return (a == done) == (b == done)
+	}))
+}
+
+func TestDelete_CollapseOntoLeafNode(t *testing.T) {
+	txn := NewRadixTree[int]().Txn(false)
+	txn.Insert([]byte("a"), 1)
+	txn.Delete([]byte("a"))
+	txn.Insert([]byte("aaaaaaaaaaaaaaa"), 2)
+	txn.Insert([]byte("aa\xff\xff!"), 3)
+	txn.Delete([]byte("aa\xff\xff!"))
+	_, ok := txn.Delete([]byte("aaaab"))
+	require.False(t, ok)
+
+	r := txn.Commit()
+	require.Equal(t, 1, r.Len())
+	v, ok := r.Get([]byte("aaaaaaaaaaaaaaa"))
+	require.True(t, ok)
+	require.Equal(t, 2, v)
+}
+
+func TestTxn_MixedOperationsRandom(t *testing.T) {
+	// Short keys over a few bytes either side of the terminator, so that keys
+	// are often prefixes of one another and nodes collapse and split a lot
+	randKey := func(rnd *rand.Rand) []byte {
+		b := make([]byte, rnd.Intn(16))
+		for i := range b {
+			b[i] = "!ab\xff"[rnd.Intn(4)]
+		}
+		return b
+	}
+	for seed := int64(0); seed < 500; seed++ {
+		rnd := rand.New(rand.NewSource(seed))
+		txn := NewRadixTree[int]().Txn(false)
+		expect := make(map[string]int)
+		for op := 0; op < 60; op++ {
+			k := randKey(rnd)
+			switch rnd.Intn(6) {
+			case 0, 1, 2:
+				txn.Insert(k, op)
+				expect[string(k)] = op
+			case 3:
+				txn.Delete(k)
+				delete(expect, string(k))
+			case 4:
+				p := k[:min(len(k), 2)]
+				txn.DeletePrefix(p)
+				for ek := range expect {
+					if strings.HasPrefix(ek, string(p)) {
+						delete(expect, ek)
+					}
+				}
+			case 5:
+				txn = txn.Commit().Txn(false)
+			}
+		}
+
+		r := txn.Commit()
+		require.Equal(t, len(expect), r.Len(), "seed %d", seed)
+		got := make(map[string]int)
+		r.Walk(func(k []byte, v int) bool {
+			got[string(k)] = v
+			return false
+		})
+		require.Equal(t, expect, got, "seed %d", seed)
+	}
+}
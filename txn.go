@@ -5,6 +5,9 @@ package adaptive
 
 import (
 	"bytes"
+	"slices"
+	"sort"
+	"sync"
 )
 
 const defaultModifiedCache = 8192
@@ -12,13 +15,32 @@ const defaultModifiedCache = 8192
 type Txn[T any] struct {
 	tree *RadixTree[T]
 
+	// base is the tree the transaction was started from, kept for Abort
+	base *RadixTree[T]
+
 	size uint64
 
 	oldMaxNodeId uint64
 
 	trackMutate bool
 
+	// dirty is set once a write changes the contents of the tree
+	dirty bool
+
 	trackChnSlice []chan struct{}
+
+	// recycle turns on reusing the nodes that deletes drop, as set by
+	// RecycleNodes. Nodes up to sealedId have been handed out through the
+	// root or a commit and may still be in use, so only newer ones are
+	// reused.
+	recycle    bool
+	sealedId   uint64
+	freeLeaves []*NodeLeaf[T]
+	freeNode4s []*Node4[T]
+
+	// origKey is the key being inserted as the caller gave it, while the
+	// tree's KeyTransform has changed it, and is stored on its leaf
+	origKey []byte
 }
 
 func (t *Txn[T]) writeNode(n Node[T], trackCh bool) Node[T] {
@@ -28,30 +50,35 @@ func (t *Txn[T]) writeNode(n Node[T], trackCh bool) Node[T] {
 			t.trackChannel(n.getNodeLeaf())
 		}
 	}
+	// Only nodes allocated by this transaction are private to it; anything
+	// older is reachable from a committed tree and must be copied first.
 	if n.getId() > t.oldMaxNodeId {
 		return n
 	}
-	if n.getRefCount() <= 1 {
-		return n
-	}
-	nc := n.clone(!trackCh, false)
+	nc := n.clone(!trackCh && !t.tree.opts.DisableWatch, false)
 	t.tree.maxNodeId++
 	nc.setId(t.tree.maxNodeId)
 	return nc
 }
 
-// Txn starts a new transaction that can be used to mutate the tree
+// Txn starts a new transaction that can be used to mutate the tree. It is safe
+// to call from several goroutines on the same tree at once, and each call
+// returns a transaction independent of the others. A transaction itself must
+// only be used by one goroutine at a time.
 func (t *RadixTree[T]) Txn(clone bool) *Txn[T] {
 	newTree := &RadixTree[T]{
-		t.root.clone(true, clone),
+		t.root.clone(!t.opts.DisableWatch, clone),
 		t.size,
 		t.maxNodeId,
+		t.generation,
+		t.opts,
 	}
 	newTree.root.incrementLazyRefCount(1)
 	newTree.root.processRefCount()
 	txn := &Txn[T]{
 		size:         t.size,
 		tree:         newTree,
+		base:         t,
 		oldMaxNodeId: t.maxNodeId,
 	}
 	return txn
@@ -60,16 +87,22 @@ func (t *RadixTree[T]) Txn(clone bool) *Txn[T] {
 // Clone makes an independent copy of the transaction. The new transaction
 // does not track any nodes and has TrackMutate turned off. The cloned transaction will contain any uncommitted writes in the original transaction but further mutations to either will be independent and result in different radix trees on Commit. A cloned transaction may be passed to another goroutine and mutated there independently however each transaction may only be mutated in a single thread.
 func (t *Txn[T]) Clone(deep bool) *Txn[T] {
-	// reset the writable node cache to avoid leaking future writes into the clone
+	// Nodes written so far are now shared by both transactions, so raise the
+	// watermark on the original as well to make it copy them before mutating.
+	t.oldMaxNodeId = t.tree.maxNodeId
 	newTree := &RadixTree[T]{
-		t.tree.root.clone(true, deep),
+		t.tree.root.clone(!t.tree.opts.DisableWatch, deep),
 		t.size,
 		t.tree.maxNodeId,
+		t.tree.generation,
+		t.tree.opts,
 	}
 	txn := &Txn[T]{
 		size:         t.size,
 		tree:         newTree,
+		base:         t.base,
 		oldMaxNodeId: t.tree.maxNodeId,
+		dirty:        t.dirty,
 	}
 	return txn
 }
@@ -81,6 +114,16 @@ func (t *Txn[T]) TrackMutate(track bool) {
 	t.trackMutate = track
 }
 
+// RecycleNodes can be used to toggle reusing the leaves and node4s that
+// deletes drop for the nodes later inserts need, which cuts garbage when keys
+// are inserted and deleted over and over in one transaction. Only nodes made
+// by the transaction since its root was last handed out, by Root, GetTree,
+// GetWatch or a commit, are reused, so recycling never hands a node that an
+// earlier tree or iterator can reach to another key.
+func (t *Txn[T]) RecycleNodes(recycle bool) {
+	t.recycle = recycle
+}
+
 // Get is used to look up a specific key, returning
 // the value and if it was found
 func (t *Txn[T]) Get(k []byte) (T, bool) {
@@ -89,188 +132,373 @@ func (t *Txn[T]) Get(k []byte) (T, bool) {
 }
 
 func (t *Txn[T]) Insert(key []byte, value T) (T, bool) {
+	old, ok, _ := t.insert(key, value, nil)
+	return old, ok
+}
+
+// InsertFunc inserts or updates key with the value returned by produce, which
+// is given the value already stored and whether there was one. Both the lookup
+// and the write happen in a single descent, so merging into the current value,
+// such as adding to a counter or a set, needs no separate Get. produce is
+// called exactly once, unless the tree has StrictNoOverwrite set and the key
+// exists, in which case it is not called and the value is left alone. Like
+// Insert, it returns the previous value and whether there was one.
+func (t *Txn[T]) InsertFunc(key []byte, produce func(old T, existed bool) T) (T, bool) {
+	var zero T
+	old, ok, _ := t.insert(key, zero, produce)
+	return old, ok
+}
+
+// InsertWatch is like Insert but also returns the watch channel of key as it
+// is stored after the write, so a caller can write and subscribe in one step.
+// The channel comes from the leaf the insert leaves key on, so the tree is
+// only walked once. It is closed by the next change to key made with
+// TrackMutate set, whether in this transaction or a later one, once that
+// change is committed. It is nil if the tree has DisableWatch.
+func (t *Txn[T]) InsertWatch(key []byte, value T) (T, bool, <-chan struct{}) {
+	old, ok, leaf := t.insert(key, value, nil)
+	if t.tree.opts.DisableWatch || leaf == nil {
+		return old, ok, nil
+	}
+	return old, ok, leaf.getMutateCh()
+}
+
+// InsertIf inserts or updates key only if cond, given the value stored for
+// key and whether there was one, returns true. The stored value is read from
+// the transaction, so it reflects earlier writes in it, and several
+// conditional writes can be checked and applied together before a single
+// Commit. It returns whether the write happened, which it never does for an
+// existing key in a tree with StrictNoOverwrite.
+func (t *Txn[T]) InsertIf(key []byte, value T, cond func(current T, existed bool) bool) bool {
+	current, existed := t.Get(key)
+	if !cond(current, existed) || existed && t.tree.opts.StrictNoOverwrite {
+		return false
+	}
+	t.Insert(key, value)
+	return true
+}
+
+// insert writes key and returns the previous value, whether there was one and
+// the leaf now holding key.
+func (t *Txn[T]) insert(key []byte, value T, produce func(T, bool) T) (T, bool, *NodeLeaf[T]) {
+	if transform := t.tree.opts.KeyTransform; transform != nil {
+		if norm := transform(key); !bytes.Equal(norm, key) {
+			t.origKey = bytes.Clone(key)
+			key = norm
+		}
+	}
+	if intern, ok := t.tree.opts.InternValues.(func(T) T); ok {
+		if produce == nil {
+			value = intern(value)
+		} else {
+			p := produce
+			produce = func(old T, existed bool) T { return intern(p(old, existed)) }
+		}
+	}
 	var old int
-	newRoot, oldVal, _ := t.recursiveInsert(t.tree.root, getTreeKey(key), value, 0, &old)
+	newRoot, oldVal, mutated, leaf := t.iterativeInsert(t.tree.root, t.insertKey(key), value, produce, &old)
+	t.origKey = nil
+	if mutated {
+		t.dirty = true
+	}
 	if old == 0 {
 		t.size++
 		t.tree.size++
 	}
 	t.tree.root = newRoot
-	return oldVal, old == 1
+	return oldVal, old == 1, leaf
 }
 
-func (t *Txn[T]) recursiveInsert(node Node[T], key []byte, value T, depth int, old *int) (Node[T], T, bool) {
+func (t *Txn[T]) iterativeInsert(node Node[T], key []byte, value T, produce func(T, bool) T, old *int) (Node[T], T, bool, *NodeLeaf[T]) {
 	var zero T
 
-	node.processRefCount()
+	// With produce set, the value stored depends on what the descent finds,
+	// so it is only worked out once the key's place is known
+	valueFor := func(oldVal T, existed bool) T {
+		if produce == nil {
+			return value
+		}
+		return produce(oldVal, existed)
+	}
 
-	if t.tree.size == 0 {
-		node = t.writeNode(node, true)
-		newLeaf := t.allocNode(leafType)
-		newLeaf.setKey(key)
-		newLeaf.setValue(value)
-		node.setNodeLeaf(newLeaf.(*NodeLeaf[T]))
-		return node, zero, true
-	}
-
-	// If we are at a leaf, we need to replace it with a node
-	if node.isLeaf() && node.getNodeLeaf() != nil {
-		// Check if we are updating an existing value
-		nodeLeafStored := node.getNodeLeaf()
-		nodeKey := nodeLeafStored.getKey()
-		if len(key) == len(nodeKey) && bytes.Equal(nodeKey, key) {
-			*old = 1
-			oldVal := nodeLeafStored.getValue()
+	// Walk down iteratively rather than recursing so that the goroutine stack
+	// does not grow with the depth of the tree. Every node passed through is
+	// remembered so the path can be rewritten bottom-up once the leaf has been
+	// placed. leaf is the leaf left holding key.
+	var parents []insertFrame[T]
+	var result Node[T]
+	var resultVal T
+	var mutated bool
+	var leaf *NodeLeaf[T]
+	depth := 0
+
+	for {
+		node.processRefCount()
+
+		if t.tree.size == 0 {
 			node = t.writeNode(node, true)
 			newLeaf := t.allocNode(leafType)
-			newLeaf.setKey(key)
-			newLeaf.setValue(value)
-			node.setNodeLeaf(newLeaf.(*NodeLeaf[T]))
-			return node, oldVal, true
+			t.setLeafKey(newLeaf, key)
+			newLeaf.setValue(valueFor(zero, false))
+			leaf = newLeaf.(*NodeLeaf[T])
+			node.setNodeLeaf(leaf)
+			result, resultVal, mutated = node, zero, true
+			break
 		}
 
-		// New value, we must split the leaf into a node4
-		newLeaf2 := t.makeLeaf(key, value)
-		newLeaf2L := newLeaf2.getNodeLeaf()
+		// The edge into this node was the key's terminator, so unless the key
+		// is stored right here everything below is longer, and the new key
+		// becomes the parent's own leaf
+		if depth >= len(key) && len(parents) > 0 &&
+			(node.getNodeLeaf() == nil || !bytes.Equal(node.getNodeLeaf().getKey(), key)) {
+			p := parents[len(parents)-1]
+			parents = parents[:len(parents)-1]
+			node = t.writeNode(p.node, true)
+			leaf = t.makeLeaf(key, valueFor(zero, false)).getNodeLeaf()
+			node.setNodeLeaf(leaf)
+			result, resultVal, mutated = node, zero, true
+			break
+		}
 
-		nodeLeaf := node.getNodeLeaf()
+		// If we are at a leaf, we need to replace it with a node
+		if node.isLeaf() && node.getNodeLeaf() != nil {
+			// Check if we are updating an existing value
+			nodeLeafStored := node.getNodeLeaf()
+			nodeKey := nodeLeafStored.getKey()
+			if len(key) == len(nodeKey) && bytes.Equal(nodeKey, key) {
+				*old = 1
+				oldVal := nodeLeafStored.getValue()
+				if t.tree.opts.StrictNoOverwrite {
+					result, resultVal, leaf = node, oldVal, nodeLeafStored
+					break
+				}
+				node = t.writeNode(node, true)
+				newLeaf := t.allocNode(leafType)
+				t.setLeafKey(newLeaf, key)
+				newLeaf.setValue(valueFor(oldVal, true))
+				leaf = newLeaf.(*NodeLeaf[T])
+				node.setNodeLeaf(leaf)
+				result, resultVal, mutated = node, oldVal, true
+				break
+			}
 
-		t.trackChannel(node)
-		node = t.writeNode(node, false)
+			// The stored key ended at the edge into this leaf, so it moves up
+			// to be the parent's own leaf and the new key takes its place
+			if len(nodeLeafStored.getKey()) <= depth && len(parents) > 0 {
+				p := parents[len(parents)-1]
+				parents = parents[:len(parents)-1]
+				t.trackChannel(node)
+				parent := t.writeNode(p.node, true)
+				parent.setNodeLeaf(nodeLeafStored)
+				newLeaf := t.makeLeaf(key, valueFor(zero, false))
+				leaf = newLeaf.getNodeLeaf()
+				parent.setChild(p.idx, newLeaf)
+				result, resultVal, mutated = parent, zero, true
+				break
+			}
 
-		// Determine longest prefix
-		longestPrefix := longestCommonPrefix[T](newLeaf2L, nodeLeaf, depth)
-		newNode := t.allocNode(node4)
-		newNode.setPartialLen(uint32(longestPrefix))
-		copy(newNode.getPartial()[:], key[depth:depth+min(maxPrefixLen, longestPrefix)])
+			// New value, we must split the leaf into a node4
+			newLeaf2 := t.makeLeaf(key, valueFor(zero, false))
+			newLeaf2L := newLeaf2.getNodeLeaf()
+			leaf = newLeaf2L
 
-		if bytes.HasPrefix(getKey(nodeLeaf.getKey()), getKey(newLeaf2L.getKey())) {
+			nodeLeaf := node.getNodeLeaf()
 
-			t.trackChannel(nodeLeaf)
-			newNode.setNodeLeaf(newLeaf2L)
-			newNode = t.addChild(newNode, nodeLeaf.getKey()[depth+longestPrefix], node)
+			t.trackChannel(node)
+			node = t.writeNode(node, false)
 
-		} else if bytes.HasPrefix(getKey(newLeaf2L.getKey()), getKey(nodeLeaf.getKey())) {
+			// Determine longest prefix
+			longestPrefix := longestCommonPrefix[T](newLeaf2L, nodeLeaf, depth)
+			// The shorter key's terminator is never shared, even if the longer
+			// key has a '$' in the same place
+			longestPrefix = min(longestPrefix, min(len(key), len(nodeLeaf.getKey()))-1-depth)
+			newNode := t.allocNode(node4)
+			newNode.setPartialLen(uint32(longestPrefix))
+			copy(newNode.getPartial()[:], key[depth:depth+min(maxPrefixLen, longestPrefix)])
 
-			newNode.setNodeLeaf(nodeLeaf)
-			newNode = t.addChild(newNode, newLeaf2L.getKey()[depth+longestPrefix], newLeaf2)
+			if bytes.HasPrefix(getKey(nodeLeaf.getKey()), getKey(newLeaf2L.getKey())) {
 
-		} else {
-			if len(nodeLeaf.getKey()) > depth+longestPrefix {
-				// Add the leafs to the new node4
+				t.trackChannel(nodeLeaf)
+				newNode.setNodeLeaf(newLeaf2L)
 				newNode = t.addChild(newNode, nodeLeaf.getKey()[depth+longestPrefix], node)
-			}
 
-			if len(newLeaf2L.getKey()) > depth+longestPrefix {
+			} else if bytes.HasPrefix(getKey(newLeaf2L.getKey()), getKey(nodeLeaf.getKey())) {
+
+				newNode.setNodeLeaf(nodeLeaf)
 				newNode = t.addChild(newNode, newLeaf2L.getKey()[depth+longestPrefix], newLeaf2)
+
+			} else {
+				if len(nodeLeaf.getKey()) > depth+longestPrefix {
+					// Add the leafs to the new node4
+					newNode = t.addChild(newNode, nodeLeaf.getKey()[depth+longestPrefix], node)
+				}
+
+				if len(newLeaf2L.getKey()) > depth+longestPrefix {
+					newNode = t.addChild(newNode, newLeaf2L.getKey()[depth+longestPrefix], newLeaf2)
+				}
 			}
+
+			result, resultVal, mutated = newNode, zero, true
+			break
 		}
 
-		return newNode, zero, true
-	}
+		if node.getNodeLeaf() != nil && leafMatches(node.getNodeLeaf().getKey(), key) == 0 {
+			*old = 1
+			oldVal := node.getNodeLeaf().getValue()
+			if t.tree.opts.StrictNoOverwrite {
+				result, resultVal, leaf = node, oldVal, node.getNodeLeaf()
+				break
+			}
+			newLeaf := t.writeNode(node.getNodeLeaf(), true)
+			newLeaf.setValue(valueFor(oldVal, true))
+			leaf = newLeaf.(*NodeLeaf[T])
+			leaf.origKey = t.origKey
+			node = t.writeNode(node, true)
+			node.setNodeLeaf(leaf)
+			result, resultVal, mutated = node, oldVal, true
+			break
+		}
 
-	if node.getNodeLeaf() != nil && leafMatches(node.getNodeLeaf().getKey(), key) == 0 {
-		newLeaf := t.writeNode(node.getNodeLeaf(), true)
-		newLeaf.setValue(value)
-		node = t.writeNode(node, true)
-		node.setNodeLeaf(newLeaf.(*NodeLeaf[T]))
-		return node, zero, true
-	}
+		// Check if given node has a prefix
+		if node.getPartialLen() > 0 {
+			// Determine if the prefixes differ, since we need to split
+			prefixDiff := prefixMismatch[T](node, key, len(key), depth)
+			// A key that ends within the prefix sorts before everything below,
+			// so split just before its terminator and make it the new node's leaf.
+			// The same goes for a key whose terminator is where it differs.
+			endsInPrefix := depth+min(prefixDiff, int(node.getPartialLen())) >= len(key) ||
+				prefixDiff < int(node.getPartialLen()) && depth+prefixDiff == len(key)-1
+			if endsInPrefix {
+				prefixDiff = len(key) - depth - 1
+			}
+			if prefixDiff >= int(node.getPartialLen()) {
+				depth += int(node.getPartialLen())
+				if depth < len(key) {
+					child, idx := t.findChild(node, key[depth])
+					if child != nil {
+						parents = append(parents, insertFrame[T]{node, child, idx})
+						node = child
+						depth++
+						continue
+					}
+				}
 
-	// Check if given node has a prefix
-	if node.getPartialLen() > 0 {
-		// Determine if the prefixes differ, since we need to split
-		prefixDiff := prefixMismatch[T](node, key, len(key), depth)
-		if prefixDiff >= int(node.getPartialLen()) {
-			depth += int(node.getPartialLen())
-			if depth < len(key) {
-				child, idx := t.findChild(node, key[depth])
-				if child != nil {
-					newChild, val, mutatedSubTree := t.recursiveInsert(child, key, value, depth+1, old)
-					if mutatedSubTree || newChild != child {
+				newLeaf := t.makeLeaf(key, valueFor(zero, false))
+				newLeafL := newLeaf.getNodeLeaf()
+				leaf = newLeafL
+				nL := node.getNodeLeaf()
+				if nL != nil && nL.getKeyLen() != 0 {
+					if bytes.HasPrefix(getKey(nL.getKey()), getKey(newLeafL.getKey())) {
 						t.trackChannel(node)
 						node = t.writeNode(node, false)
-						node.setChild(idx, newChild)
+						newNode := t.allocNode(node4)
+						newNode.setNodeLeaf(newLeaf.(*NodeLeaf[T]))
+						newNode = t.addChild(newNode, key[depth], node)
+						result, resultVal, mutated = newNode, zero, true
+						break
 					}
-					return node, val, mutatedSubTree
 				}
-			}
-
-			newLeaf := t.makeLeaf(key, value)
-			newLeafL := newLeaf.getNodeLeaf()
-			nL := node.getNodeLeaf()
-			if nL != nil && nL.getKeyLen() != 0 {
-				if bytes.HasPrefix(getKey(nL.getKey()), getKey(newLeafL.getKey())) {
-					t.trackChannel(node)
-					node = t.writeNode(node, false)
-					newNode := t.allocNode(node4)
-					newNode.setNodeLeaf(newLeaf.(*NodeLeaf[T]))
-					newNode = t.addChild(newNode, key[depth], node)
-					return newNode, zero, true
+				t.trackChannel(node)
+				node = t.writeNode(node, false)
+				if depth == len(key)-1 {
+					// The key ends at this node, so it is the node's own leaf
+					node.setNodeLeaf(newLeafL)
+				} else if depth < len(key) {
+					// No child, node goes within us
+					node = t.addChild(node, key[depth], newLeaf)
+					// newNode was created
 				}
+				result, resultVal, mutated = node, zero, true
+				break
 			}
+
+			// Create a new node
+			newNode := t.allocNode(node4)
+			newNode.setPartialLen(uint32(prefixDiff))
+			copy(newNode.getPartial()[:], node.getPartial()[:min(maxPrefixLen, prefixDiff)])
 			t.trackChannel(node)
 			node = t.writeNode(node, false)
-			if depth < len(key) {
-				// No child, node goes within us
-				node = t.addChild(node, key[depth], newLeaf)
-				// newNode was created
+
+			// Adjust the prefix of the old node
+			if node.getPartialLen() <= maxPrefixLen {
+				newNode = t.addChild(newNode, node.getPartial()[prefixDiff], node)
+				node.setPartialLen(node.getPartialLen() - uint32(prefixDiff+1))
+				length := min(maxPrefixLen, int(node.getPartialLen()))
+				copy(node.getPartial(), node.getPartial()[prefixDiff+1:prefixDiff+1+length])
+			} else {
+				node.setPartialLen(node.getPartialLen() - uint32(prefixDiff+1))
+				l := minimum[T](node)
+				newNode = t.addChild(newNode, l.key[depth+prefixDiff], node)
+				length := min(maxPrefixLen, int(node.getPartialLen()))
+				copy(node.getPartial(), l.key[depth+prefixDiff+1:depth+prefixDiff+1+length])
 			}
-			return node, zero, true
-		}
-
-		// Create a new node
-		newNode := t.allocNode(node4)
-		newNode.setPartialLen(uint32(prefixDiff))
-		copy(newNode.getPartial()[:], node.getPartial()[:min(maxPrefixLen, prefixDiff)])
-		t.trackChannel(node)
-		node = t.writeNode(node, false)
-
-		// Adjust the prefix of the old node
-		if node.getPartialLen() <= maxPrefixLen {
-			newNode = t.addChild(newNode, node.getPartial()[prefixDiff], node)
-			node.setPartialLen(node.getPartialLen() - uint32(prefixDiff+1))
-			length := min(maxPrefixLen, int(node.getPartialLen()))
-			copy(node.getPartial(), node.getPartial()[prefixDiff+1:prefixDiff+1+length])
-		} else {
-			node.setPartialLen(node.getPartialLen() - uint32(prefixDiff+1))
-			l := minimum[T](node)
-			newNode = t.addChild(newNode, l.key[depth+prefixDiff], node)
-			length := min(maxPrefixLen, int(node.getPartialLen()))
-			copy(node.getPartial(), l.key[depth+prefixDiff+1:depth+prefixDiff+1+length])
+			// Insert the new leaf
+			newLeaf := t.makeLeaf(key, valueFor(zero, false))
+			leaf = newLeaf.getNodeLeaf()
+			if endsInPrefix {
+				newNode.setNodeLeaf(newLeaf.getNodeLeaf())
+			} else {
+				newNode = t.addChild(newNode, key[depth+prefixDiff], newLeaf)
+			}
+			result, resultVal, mutated = newNode, zero, true
+			break
 		}
-		// Insert the new leaf
-		newLeaf := t.makeLeaf(key, value)
-		if depth+prefixDiff < len(key) {
-			newNode = t.addChild(newNode, key[depth+prefixDiff], newLeaf)
+
+		// Find a child to recurse to
+		child, idx := t.findChild(node, key[depth])
+		if child != nil {
+			parents = append(parents, insertFrame[T]{node, child, idx})
+			node = child
+			depth++
+			continue
 		}
-		return newNode, zero, true
-	}
 
-	// Find a child to recurse to
-	child, idx := t.findChild(node, key[depth])
-	if child != nil {
-		newChild, val, mutatedSubtree := t.recursiveInsert(child, key, value, depth+1, old)
-		if mutatedSubtree || newChild != child {
+		if depth < len(key) {
+			newLeaf := t.makeLeaf(key, valueFor(zero, false))
+			leaf = newLeaf.getNodeLeaf()
 			t.trackChannel(node)
 			node = t.writeNode(node, false)
-			node.setChild(idx, newChild)
+			// A key ending at the node becomes its own leaf rather than the
+			// child along its terminator, which would sort it after children
+			// for bytes below '$' and out of order in both directions
+			if depth == len(key)-1 {
+				node.setNodeLeaf(newLeaf.getNodeLeaf())
+				result, resultVal, mutated = node, zero, true
+				break
+			}
+			result, resultVal, mutated = t.addChild(node, key[depth], newLeaf), zero, true
+			break
 		}
-		return node, val, mutatedSubtree
+		result, resultVal, mutated = node, zero, false
+		break
 	}
 
-	newLeaf := t.makeLeaf(key, value)
-	if depth < len(key) {
-		t.trackChannel(node)
-		node = t.writeNode(node, false)
-		return t.addChild(node, key[depth], newLeaf), zero, true
+	// Point each parent at its rewritten child, copying any that are shared
+	for i := len(parents) - 1; i >= 0; i-- {
+		p := parents[i]
+		if mutated || result != p.child {
+			t.trackChannel(p.node)
+			n := t.writeNode(p.node, false)
+			n.setChild(p.idx, result)
+			result = n
+		} else {
+			result = p.node
+		}
 	}
-	return node, zero, false
+	return result, resultVal, mutated, leaf
+}
+
+// insertFrame records a node passed through on the way down during an insert
+// and the index of the child that was followed.
+type insertFrame[T any] struct {
+	node  Node[T]
+	child Node[T]
+	idx   int
 }
 
 func (t *Txn[T]) Delete(key []byte) (T, bool) {
 	var zero T
-	newRoot, l, _ := t.recursiveDelete(t.tree.root, getTreeKey(key), 0)
+	newRoot, l, _ := t.iterativeDelete(t.tree.root, t.tree.lookupKey(key))
 
 	if newRoot == nil {
 		t.tree.root = &Node4[T]{
@@ -285,93 +513,132 @@ func (t *Txn[T]) Delete(key []byte) (T, bool) {
 	}
 	if l != nil {
 		t.trackChannel(t.tree.root)
+		t.dirty = true
 		t.size--
 		t.tree.size--
 		old := l.getValue()
+		t.release(l)
 		return old, true
 	}
 	return zero, false
 }
 
-func (t *Txn[T]) recursiveDelete(node Node[T], key []byte, depth int) (Node[T], Node[T], bool) {
-	// Get terminated
+func (t *Txn[T]) iterativeDelete(node Node[T], key []byte) (Node[T], Node[T], bool) {
+	// As with inserts, walk down iteratively and remember the path so the
+	// parents can be rewritten bottom-up once the leaf has been removed.
+	var parents []deleteFrame[T]
+	var result, val Node[T]
+	var mutate bool
+	depth := 0
+
+	for {
+		// Get terminated
+		if node == nil {
+			break
+		}
 
-	if node == nil {
-		return nil, nil, false
-	}
+		node.processRefCount()
 
-	node.processRefCount()
+		if node.isLeaf() {
+			t.trackChannel(node)
+			if leafMatches(node.getKey(), key) == 0 {
+				val, mutate = node, true
+				break
+			}
+		}
+
+		// Handle hitting a leaf node
+		if node.getNodeLeaf() != nil {
+			nodeL := node.getNodeLeaf()
+			if leafMatches(nodeL.getKey(), key) == 0 {
+				node = t.writeNode(node, true)
+				node.setNodeLeaf(nil)
+				if node.getNumChildren() == 1 && node.getArtNodeType() == node4 {
+					result, val, mutate = t.collapse(node), nodeL, true
+				} else if numChildren(node) > 0 {
+					result, val, mutate = node, nodeL, true
+				} else {
+					val = nodeL
+				}
+				break
+			}
+		}
 
-	if node.isLeaf() {
-		t.trackChannel(node)
-		if leafMatches(node.getKey(), key) == 0 {
-			return nil, node, true
+		// A node holding only a leaf has nothing below it to search
+		if node.isLeaf() {
+			result = node
+			break
 		}
-	}
 
-	// Handle hitting a leaf node
-	if node.getNodeLeaf() != nil {
-		nodeL := node.getNodeLeaf()
-		if leafMatches(nodeL.getKey(), key) == 0 {
-			node = t.writeNode(node, true)
-			node.setNodeLeaf(nil)
-			if node.getNumChildren() > 0 {
-				return node, nodeL, true
-			} else {
-				return nil, nodeL, false
+		// Bail if the prefix does not match
+		if node.getPartialLen() > 0 {
+			prefixLen := checkPrefix(node.getPartial(), int(node.getPartialLen()), key, depth)
+			if prefixLen != min(maxPrefixLen, int(node.getPartialLen())) {
+				result = node
+				break
 			}
+			depth += int(node.getPartialLen())
 		}
-	}
 
-	// Bail if the prefix does not match
-	if node.getPartialLen() > 0 {
-		prefixLen := checkPrefix(node.getPartial(), int(node.getPartialLen()), key, depth)
-		if prefixLen != min(maxPrefixLen, int(node.getPartialLen())) {
-			return node, nil, false
+		// Find child node, leaving this subtree untouched if there is none
+		if depth >= len(key) {
+			result = node
+			break
+		}
+		child, idx := t.findChild(node, key[depth])
+		if child == nil {
+			result = node
+			break
 		}
-		depth += int(node.getPartialLen())
-	}
 
-	// Find child node
-	child, idx := t.findChild(node, key[depth])
-	if child == nil {
-		return nil, nil, false
+		parents = append(parents, deleteFrame[T]{node, child, idx, depth})
+		node = child
+		depth++
 	}
 
-	// Recurse
-	newChild, val, mutate := t.recursiveDelete(child, key, depth+1)
-
-	if newChild != child || val != nil {
-		t.trackChannel(node)
-		node = t.writeNode(node, false)
-		node.setChild(idx, newChild)
-		if newChild == nil {
-			node = t.removeChild(node, key[depth])
+	for i := len(parents) - 1; i >= 0; i-- {
+		p := parents[i]
+		node = p.node
+		if result != p.child || val != nil {
+			t.trackChannel(node)
+			node = t.writeNode(node, false)
+			node.setChild(p.idx, result)
+			if result == nil {
+				node = t.removeChild(node, key[p.depth])
+			}
 		}
-	}
 
-	if node.getNumChildren() == 0 {
-		if node.getNodeLeaf() != nil {
-			return node, val, mutate
-		} else {
-			return nil, val, mutate
+		if numChildren(node) == 0 && node.getNodeLeaf() == nil {
+			node = nil
 		}
+		result = node
 	}
+	return result, val, mutate
+}
 
-	return node, val, mutate
+// deleteFrame records a node passed through on the way down during a delete,
+// the child that was followed and the key depth used to select it.
+type deleteFrame[T any] struct {
+	node  Node[T]
+	child Node[T]
+	idx   int
+	depth int
 }
 
 func (t *Txn[T]) Root() Node[T] {
+	t.seal()
 	return t.tree.root
 }
 
 func (t *Txn[T]) GetTree() *RadixTree[T] {
+	t.seal()
 	return t.tree
 }
 
 // GetWatch is used to lookup a specific key, returning
 // the watch channel, value and if it was found
 func (t *Txn[T]) GetWatch(k []byte) (<-chan struct{}, T, bool) {
+	t.seal()
 	return t.tree.GetWatch(k)
 }
 
@@ -399,20 +666,54 @@ func (t *Txn[T]) Commit() *RadixTree[T] {
 // CommitOnly is used to finalize the transaction and return a new tree, but
 // does not issue any notifications until Notify is called.
 func (t *Txn[T]) CommitOnly() *RadixTree[T] {
+	t.seal()
 	t.tree.root.incrementLazyRefCount(-1)
 	t.tree.root.processRefCount()
 	nt := &RadixTree[T]{t.tree.root,
 		t.size,
 		t.tree.maxNodeId,
+		t.tree.generation + 1,
+		t.tree.opts,
 	}
 	return nt
 
 }
 
+// Abort discards every change made in the transaction, leaving it as it was
+// when it was started from its tree so that it can be used again. Calling
+// Abort is never needed just to drop a transaction: writes only ever go to
+// copies of the tree's nodes, so a transaction that is not committed has no
+// effect on the tree it came from. Pending notifications are dropped as well.
+func (t *Txn[T]) Abort() {
+	t.tree.root.incrementLazyRefCount(-1)
+	t.tree.root.processRefCount()
+	fresh := t.base.Txn(false)
+	t.tree = fresh.tree
+	t.size = fresh.size
+	t.oldMaxNodeId = fresh.oldMaxNodeId
+	t.dirty = false
+	t.trackChnSlice = nil
+}
+
+// Dirty returns true if any write in the transaction has changed the tree.
+// Writes that leave it as it was, such as deleting a key that is not there or
+// inserting an existing key with StrictNoOverwrite set, do not count, so a
+// caller can skip publishing the result of a transaction that changed nothing.
+func (t *Txn[T]) Dirty() bool {
+	return t.dirty
+}
+
+// notifyLock serializes closing watch channels. Transactions started from the
+// same tree can each pick up a channel of a node they share before either
+// replaces it, so two commits may try to close the same channel at once.
+var notifyLock sync.Mutex
+
 // slowNotify does a complete comparison of the before and after trees in order
 // to trigger notifications. This doesn't require any additional state but it
 // is very expensive to compute.
 func (t *Txn[T]) slowNotify() {
+	notifyLock.Lock()
+	defer notifyLock.Unlock()
 	for _, ch := range t.trackChnSlice {
 		if ch != nil && !isClosed(ch) {
 			close(ch)
@@ -428,8 +729,7 @@ func (t *Txn[T]) LongestPrefix(prefix []byte) ([]byte, T, bool) {
 // DeletePrefix is used to delete an entire subtree that matches the prefix
 // This will delete all nodes under that prefix
 func (t *Txn[T]) DeletePrefix(prefix []byte) bool {
-	key := getTreeKey(prefix)
-	newRoot, numDeletions := t.deletePrefix(t.tree.root, key, 0)
+	newRoot, numDeletions := t.deletePrefix(t.tree.root, prefix)
 	if newRoot == nil {
 		t.tree.root = &Node4[T]{
 			leaf: &NodeLeaf[T]{
@@ -442,6 +742,7 @@ func (t *Txn[T]) DeletePrefix(prefix []byte) bool {
 		t.tree.root = newRoot
 	}
 	if numDeletions != 0 {
+		t.dirty = true
 		if t.trackMutate {
 			t.trackChannel(t.tree.root)
 		}
@@ -452,79 +753,239 @@ func (t *Txn[T]) DeletePrefix(prefix []byte) bool {
 	return false
 }
 
-func (t *Txn[T]) deletePrefix(node Node[T], key []byte, depth int) (Node[T], int) {
-	// Get terminated
-	if node == nil {
-		return nil, 0
+// DeleteChildren is used to delete the keys one level below the prefix,
+// leaving deeper keys in place. A key is a child of the prefix if it starts
+// with the prefix, is longer than it, and the remainder after the prefix does
+// not contain sep. The prefix itself is not deleted. With sep '/' and prefix
+// "foo/", the keys "foo/a" and "foo/b" are deleted but "foo/a/b" is kept.
+func (t *Txn[T]) DeleteChildren(prefix []byte, sep byte) bool {
+	var children [][]byte
+	it := t.tree.root.Iterator()
+	it.SeekPrefix(prefix)
+	for key, _, ok := it.Next(); ok; key, _, ok = it.Next() {
+		stored := it.CurrentPath()
+		if len(stored) > len(prefix) && bytes.IndexByte(stored[len(prefix):], sep) < 0 {
+			children = append(children, key)
+		}
 	}
-	// Handle hitting a leaf node
-	if isLeaf[T](node) {
-		nL := node.getNodeLeaf()
-		if nL != nil && bytes.HasPrefix(getKey(nL.getKey()), getKey(key)) {
-			t.trackChannel(node)
-			t.trackChannel(nL)
-			return nil, 1
+	for _, key := range children {
+		t.Delete(key)
+	}
+	return len(children) > 0
+}
+
+// RetainPrefixes deletes every key that does not start with one of prefixes,
+// keeping only the namespaces they name, and returns the number of keys
+// deleted. An empty prefix keeps every key, and no prefixes delete them all.
+func (t *Txn[T]) RetainPrefixes(prefixes [][]byte) int {
+	if len(prefixes) == 0 {
+		n := t.tree.Len()
+		t.DeletePrefix(nil)
+		return n
+	}
+	// Keys sort after every prefix of theirs, so the only prefix a key can
+	// start with is the largest one sorting at or before it, once prefixes
+	// covered by a shorter one are dropped
+	sorted := slices.Clone(prefixes)
+	slices.SortFunc(sorted, bytes.Compare)
+	kept := sorted[:1]
+	for _, p := range sorted[1:] {
+		if !bytes.HasPrefix(p, kept[len(kept)-1]) {
+			kept = append(kept, p)
 		}
-		return node, 0
 	}
 
-	// Bail if the prefix does not match
-	if node.getPartialLen() > 0 {
-		prefixLen := checkPrefix(node.getPartial(), int(node.getPartialLen()), key, depth)
-		if prefixLen < min(maxPrefixLen, len(getKey(key))) {
-			depth += prefixLen
+	var keys [][]byte
+	it := t.tree.root.Iterator()
+	it.SeekPrefix(nil)
+	for key, _, ok := it.Next(); ok; key, _, ok = it.Next() {
+		stored := it.CurrentPath()
+		i := sort.Search(len(kept), func(i int) bool { return bytes.Compare(kept[i], stored) > 0 })
+		if i == 0 || !bytes.HasPrefix(stored, kept[i-1]) {
+			keys = append(keys, key)
 		}
 	}
+	for _, key := range keys {
+		t.Delete(key)
+	}
+	return len(keys)
+}
 
-	numDel := 0
+// RenamePrefix moves every key starting with old to start with new instead,
+// keeping its value, and returns the number of keys moved. A moved key
+// replaces a key already stored under its new name, unless StrictNoOverwrite
+// is set, in which case the key keeps its old name and is not counted.
+// Renaming a prefix to itself changes nothing. For a tree with a KeyTransform
+// the prefixes are normalized, and moved keys take their normalized spelling.
+func (t *Txn[T]) RenamePrefix(old, new []byte) int {
+	if bytes.Equal(old, new) {
+		return t.tree.CountPrefix(old)
+	}
+	// Keys are renamed by their normalized form, but deleted by the one they
+	// were inserted with, which Delete normalizes again
+	var keys, userKeys [][]byte
+	var values []T
+	it := t.tree.root.Iterator()
+	it.SeekPrefix(old)
+	for key, val, ok := it.Next(); ok; key, val, ok = it.Next() {
+		keys = append(keys, it.CurrentPath())
+		userKeys = append(userKeys, key)
+		values = append(values, val)
+	}
+	if len(keys) == 0 {
+		return 0
+	}
+	rename := func(key []byte) []byte {
+		renamed := make([]byte, 0, len(new)+len(key)-len(old))
+		return append(append(renamed, new...), key[len(old):]...)
+	}
 
-	if node.getNodeLeaf() != nil {
-		if bytes.HasPrefix(getKey(node.getNodeLeaf().getKey()), getKey(key)) {
-			t.trackChannel(node.getNodeLeaf())
-			numDel++
+	// A new name is taken by a key that is not moving away, which includes
+	// keys kept for the same reason, so keep going until no more are kept
+	kept := make([]bool, len(keys))
+	numKept := 0
+	if t.tree.opts.StrictNoOverwrite {
+		moving := make(map[string]int, len(keys))
+		for i, key := range keys {
+			moving[string(key)] = i
+		}
+		for changed := true; changed; {
+			changed = false
+			for i, key := range keys {
+				if kept[i] {
+					continue
+				}
+				renamed := rename(key)
+				j, ok := moving[string(renamed)]
+				if ok && kept[j] || !ok && t.tree.Contains(renamed) {
+					kept[i] = true
+					numKept++
+					changed = true
+				}
+			}
 		}
 	}
 
-	// Recurse on the children
-	var newChIndxMap = make(map[int]Node[T])
-	for idx, ch := range node.getChildren() {
-		if ch != nil {
-			newCh, del := t.deletePrefix(ch, key, depth+1)
-			newChIndxMap[idx] = newCh
-			numDel += del
-			if del > 0 && t.trackMutate {
-				t.trackChannel(ch)
+	if numKept == 0 {
+		t.DeletePrefix(old)
+	} else {
+		for i, key := range userKeys {
+			if !kept[i] {
+				t.Delete(key)
 			}
 		}
 	}
+	for i, key := range keys {
+		if !kept[i] {
+			t.Insert(rename(key), values[i])
+		}
+	}
+	return len(keys) - numKept
+}
 
-	slow := 0
-	numCh := 0
+// DeleteRangeFunc is used to delete the keys in [lo, hi) for which
+// shouldDelete returns true, leaving the others in place. As with Range, a nil
+// lo starts at the first key and a nil hi runs to the last one. It returns the
+// number of keys deleted. Only the deleted keys have their watches fired.
+func (t *Txn[T]) DeleteRangeFunc(lo, hi []byte, shouldDelete func(k []byte, v T) bool) int {
+	if t.tree.size == 0 {
+		return 0
+	}
+	var keys [][]byte
+	it := t.tree.root.LowerBoundIterator()
+	it.SeekLowerBound(lo)
+	for key, val, ok := it.Next(); ok; key, val, ok = it.Next() {
+		if hi != nil && bytes.Compare(it.storedKey(), hi) >= 0 {
+			break
+		}
+		if shouldDelete(key, val) {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		t.Delete(key)
+	}
+	return len(keys)
+}
 
-	node = t.writeNode(node, true)
+func (t *Txn[T]) deletePrefix(node Node[T], prefix []byte) (Node[T], int) {
+	// Walk down along the prefix to the subtree holding every key that starts
+	// with it, remembering the path so the parents can be rewritten after.
+	root := node
+	var parents []deleteFrame[T]
+	depth := 0
+	for {
+		if node.isLeaf() {
+			l := node.getNodeLeaf()
+			if !bytes.HasPrefix(getKey(l.getKey()), prefix) {
+				return root, 0
+			}
+			break
+		}
+		if depth >= len(prefix) {
+			break
+		}
 
-	for itr := 0; itr < int(node.getNumChildren()); itr++ {
-		newCh, ok := newChIndxMap[itr]
-		if ok {
-			if newCh == nil {
-				continue
-			} else {
-				numCh++
-				node.setChild(slow, newCh)
-				slow++
+		// Long partials are compared against a leaf beyond the stored part,
+		// so only the partial itself tells whether the whole subtree matches
+		if node.getPartialLen() > 0 {
+			partialLen := int(node.getPartialLen())
+			mismatch := min(prefixMismatch[T](node, prefix, len(prefix), depth), partialLen)
+			if depth+mismatch >= len(prefix) {
+				break
 			}
-		} else {
-			numCh++
-			node.setChild(slow, node.getChild(itr))
-			slow++
+			if mismatch < partialLen {
+				return root, 0
+			}
+			depth += partialLen
+		}
+
+		child, idx := t.findChild(node, prefix[depth])
+		if child == nil {
+			return root, 0
 		}
+		parents = append(parents, deleteFrame[T]{node, child, idx, depth})
+		node = child
+		depth++
 	}
-	for itr := slow; itr < len(node.getChildren()); itr++ {
-		node.setChild(itr, nil)
+	numDel := subtreeSize[T](node)
+	t.trackSubtree(node)
+
+	// Unlink the subtree and rewrite the parents, letting removeChild shrink
+	// or collapse any node that is left with too few children
+	var result Node[T]
+	for i := len(parents) - 1; i >= 0; i-- {
+		p := parents[i]
+		t.trackChannel(p.node)
+		node = t.writeNode(p.node, false)
+		if result == nil {
+			node = t.removeChild(node, prefix[p.depth])
+		} else {
+			node.setChild(p.idx, result)
+		}
+		if numChildren(node) == 0 && node.getNodeLeaf() == nil {
+			node = nil
+		}
+		result = node
 	}
-	node.setNumChildren(uint8(numCh))
+	return result, numDel
+}
 
-	return node, numDel
+// trackSubtree tracks the channels of n and of everything below it, for a
+// subtree that is removed as a whole.
+func (t *Txn[T]) trackSubtree(n Node[T]) {
+	if !t.trackMutate {
+		return
+	}
+	t.trackChannel(n)
+	if l := n.getNodeLeaf(); l != nil {
+		t.trackChannel(l)
+	}
+	for _, ch := range n.getChildren() {
+		if ch != nil {
+			t.trackSubtree(ch)
+		}
+	}
 }
 
 func (t *Txn[T]) makeLeaf(key []byte, value T) Node[T] {
@@ -540,7 +1001,7 @@ func (t *Txn[T]) makeLeaf(key []byte, value T) Node[T] {
 	// Set the value and key length
 	l.setValue(value)
 	l.setKeyLen(uint32(len(key)))
-	l.setKey(key)
+	t.setLeafKey(l, key)
 
 	n4 := t.allocNode(node4)
 	n4.setNodeLeaf(l.(*NodeLeaf[T]))
@@ -549,42 +1010,138 @@ func (t *Txn[T]) makeLeaf(key []byte, value T) Node[T] {
 	return n4
 }
 
+// insertKey returns key as it is stored in the tree, followed by its
+// terminator. With ZeroCopyKeys the terminator goes into key's spare capacity
+// so that key's memory can be stored as it is.
+func (t *Txn[T]) insertKey(key []byte) []byte {
+	n := len(key)
+	if !t.tree.opts.ZeroCopyKeys || cap(key) == n {
+		return getTreeKey(key)
+	}
+	key = key[: n+1 : n+1]
+	key[n] = '$'
+	return key
+}
+
+// setLeafKey stores key on the leaf l, along with its fingerprint if the tree
+// keeps them and the key as it was inserted if it was normalized.
+func (t *Txn[T]) setLeafKey(l Node[T], key []byte) {
+	l.setKey(key)
+	l.(*NodeLeaf[T]).origKey = t.origKey
+	if t.tree.opts.KeyFingerprints {
+		l.(*NodeLeaf[T]).fingerprint = keyFingerprint(key)
+	}
+}
+
 func (t *Txn[T]) allocNode(ntype nodeType) Node[T] {
 	var n Node[T]
 	switch ntype {
 	case leafType:
-		n = &NodeLeaf[T]{
-			refCount: 1,
+		if k := len(t.freeLeaves); k > 0 {
+			n = t.freeLeaves[k-1]
+			t.freeLeaves = t.freeLeaves[:k-1]
+		} else {
+			n = t.newNode(ntype)
 		}
 	case node4:
-		n = &Node4[T]{
-			refCount: 1,
-		}
-	case node16:
-		n = &Node16[T]{
-			refCount: 1,
-		}
-	case node48:
-		n = &Node48[T]{
-			refCount: 1,
-		}
-	case node256:
-		n = &Node256[T]{
-			refCount: 1,
+		if k := len(t.freeNode4s); k > 0 {
+			n = t.freeNode4s[k-1]
+			t.freeNode4s = t.freeNode4s[:k-1]
+		} else {
+			n = t.newNode(ntype)
 		}
+	case node16, node48, node256:
+		n = t.newNode(ntype)
 	default:
 		panic("Unknown node type")
 	}
 	t.tree.maxNodeId++
 	n.setId(t.tree.maxNodeId)
 	if n.getArtNodeType() != leafType {
-		n.setPartial(make([]byte, maxPrefixLen))
+		if p := n.getPartial(); len(p) == maxPrefixLen {
+			clear(p)
+		} else {
+			n.setPartial(make([]byte, maxPrefixLen))
+		}
 		n.setPartialLen(maxPrefixLen)
 	}
-	n.getMutateCh()
+	if !t.tree.opts.DisableWatch {
+		n.getMutateCh()
+	}
 	return n
 }
 
+// newNode returns a new node of type ntype with a reference count of 1,
+// taken from the tree's Allocator if it has one.
+func (t *Txn[T]) newNode(ntype nodeType) Node[T] {
+	if a, ok := t.tree.opts.Allocator.(Allocator[T]); ok {
+		switch ntype {
+		case leafType:
+			n := a.NewLeaf()
+			n.refCount = 1
+			return n
+		case node4:
+			n := a.NewNode4()
+			n.refCount = 1
+			return n
+		case node16:
+			n := a.NewNode16()
+			n.refCount = 1
+			return n
+		case node48:
+			n := a.NewNode48()
+			n.refCount = 1
+			return n
+		default:
+			n := a.NewNode256()
+			n.refCount = 1
+			return n
+		}
+	}
+	switch ntype {
+	case leafType:
+		return &NodeLeaf[T]{refCount: 1}
+	case node4:
+		return &Node4[T]{refCount: 1}
+	case node16:
+		return &Node16[T]{refCount: 1}
+	case node48:
+		return &Node48[T]{refCount: 1}
+	default:
+		return &Node256[T]{refCount: 1}
+	}
+}
+
+// seal marks every node made so far as seen outside the transaction, so that
+// none of them is recycled.
+func (t *Txn[T]) seal() {
+	t.sealedId = t.tree.maxNodeId
+}
+
+// release hands a node dropped from the tree back for allocNode to reuse, if
+// recycling is on and the node is private to the transaction. A node4 takes
+// its leaf with it. A node4's partial buffer and watch channel are kept, as
+// nothing outside the transaction can hold either, but a leaf's channel may
+// have been handed out by InsertWatch and goes with the key.
+func (t *Txn[T]) release(n Node[T]) {
+	if !t.recycle || n.getId() <= max(t.oldMaxNodeId, t.sealedId) {
+		return
+	}
+	switch n := n.(type) {
+	case *NodeLeaf[T]:
+		*n = NodeLeaf[T]{refCount: 1}
+		t.freeLeaves = append(t.freeLeaves, n)
+	case *Node4[T]:
+		if n.leaf != nil {
+			t.release(n.leaf)
+		}
+		ch := n.mutateCh.Load()
+		*n = Node4[T]{partial: n.partial, refCount: 1}
+		n.mutateCh.Store(ch)
+		t.freeNode4s = append(t.freeNode4s, n)
+	}
+}
+
 // trackChannel safely attempts to track the given mutation channel, setting the
 // overflow flag if we can no longer track any more. This limits the amount of
 // state that will accumulate during a transaction and we have a slower algorithm
@@ -593,7 +1150,7 @@ func (t *Txn[T]) trackChannel(node Node[T]) {
 	// In overflow, make sure we don't store any more objects.
 	// If this would overflow the state we reject it and set the flag (since
 
-	if !t.trackMutate {
+	if !t.trackMutate || t.tree.opts.DisableWatch {
 		return
 	}
 